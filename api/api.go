@@ -1,22 +1,55 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-contrib/static"
 	"github.com/gin-gonic/gin"
 	"github.com/miekg/dns"
 
+	"github.com/ray-g/dnsproxy/blocker"
 	c "github.com/ray-g/dnsproxy/cache"
 	"github.com/ray-g/dnsproxy/logger"
+	"github.com/ray-g/dnsproxy/records"
 	"github.com/ray-g/dnsproxy/stats"
 )
 
+// answerKey is the cache key of the A answer to name for the clients outside
+// of the client groups
+func answerKey(name string) string {
+	return c.GlobalPrefix + name
+}
+
 // StartAPIServer starts the API server
 func StartAPIServer(addr string, debugMode bool, cache c.Cache) error {
+	server := &http.Server{
+		Addr:    addr,
+		Handler: newRouter(debugMode, cache),
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := server.Serve(listener); err != http.ErrServerClosed {
+			logger.Fatal(err)
+		}
+	}()
+
+	logger.Infof("API server listening on %s", addr)
+	return err
+}
+
+// newRouter routes the API and the Web GUI
+func newRouter(debugMode bool, cache c.Cache) *gin.Engine {
 	var router *gin.Engine
 	if !debugMode {
 		gin.SetMode(gin.ReleaseMode)
@@ -26,11 +59,6 @@ func StartAPIServer(addr string, debugMode bool, cache c.Cache) error {
 		router = gin.Default()
 	}
 
-	server := &http.Server{
-		Addr:    addr,
-		Handler: router,
-	}
-
 	router.Use(cors.Default())
 
 	router.GET("/cache", func(c *gin.Context) {
@@ -38,8 +66,18 @@ func StartAPIServer(addr string, debugMode bool, cache c.Cache) error {
 	})
 
 	router.GET("/cache/:key", func(c *gin.Context) {
-		r, err := cache.Get(c.Param("key"))
-		if err != nil {
+		r, err := cache.Get(answerKey(c.Param("key")))
+		if sources, ok := blocker.Listed(cache, c.Param("key")); ok {
+			var categories []string
+			for _, source := range sources {
+				categories = append(categories, blocker.Categories(source)...)
+			}
+			resp := gin.H{"blocked": true, "sources": sources, "categories": categories}
+			if err == nil {
+				resp["answer"] = r.Msg.Answer
+			}
+			c.JSON(http.StatusOK, resp)
+		} else if err != nil {
 			c.JSON(http.StatusOK, gin.H{"error": c.Param("key") + " not found"})
 		} else {
 			c.JSON(http.StatusOK, gin.H{"answer": r.Msg.Answer})
@@ -48,7 +86,8 @@ func StartAPIServer(addr string, debugMode bool, cache c.Cache) error {
 
 	router.DELETE("/cache/:key", func(c *gin.Context) {
 		key := c.Param("key")
-		cache.Remove(key)
+		cache.Remove(answerKey(key))
+		cache.Remove(answerKey(key) + ":AAAA")
 		c.JSON(http.StatusOK, gin.H{"key": key})
 	})
 
@@ -59,7 +98,7 @@ func StartAPIServer(addr string, debugMode bool, cache c.Cache) error {
 	router.GET("/query/:key", func(c *gin.Context) {
 		key := c.Param("key")
 		// check cache first
-		cr, ce := cache.Get(key)
+		cr, ce := cache.Get(answerKey(key))
 
 		// resolve name on localhost
 		m := new(dns.Msg)
@@ -85,31 +124,182 @@ func StartAPIServer(addr string, debugMode bool, cache c.Cache) error {
 		c.JSON(http.StatusOK, resp)
 	})
 
+	// formats are hosts, domains, dnsmasq, unbound and rpz
+	router.GET("/blocker/export/:format", func(c *gin.Context) {
+		export := blocker.CurrentExport()
+		if export == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Blocklist not loaded"})
+			return
+		}
+
+		format := strings.ToLower(c.Param("format"))
+		known := false
+		for _, f := range blocker.ExportFormats() {
+			known = known || f == format
+		}
+		if !known {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Unknown format " + format, "formats": blocker.ExportFormats()})
+			return
+		}
+
+		etag := fmt.Sprintf("\"%s-%s\"", export.ETag, format)
+		c.Header("ETag", etag)
+		if c.GetHeader("If-None-Match") == etag {
+			c.Status(http.StatusNotModified)
+			return
+		}
+
+		c.Header("Content-Type", "text/plain; charset=utf-8")
+		c.Status(http.StatusOK)
+		if err := export.Write(c.Writer, format); err != nil {
+			logger.Warningf("error exporting blocklist: %s", err)
+		}
+	})
+
+	router.GET("/blocker/updates", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"updates": blocker.Updates()})
+	})
+
+	router.GET("/blocker/updates/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Illegal value for 'id'"})
+			return
+		}
+
+		update, ok := blocker.GetUpdate(id)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Unknown update " + c.Param("id")})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"update": update})
+	})
+
+	router.GET("/records", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"records": records.List(), "types": records.Types})
+	})
+
+	router.GET("/records/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Illegal value for 'id'"})
+			return
+		}
+
+		record, err := records.Get(id)
+		if err != nil {
+			recordError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"record": record})
+	})
+
+	router.POST("/records", func(c *gin.Context) {
+		var record records.Record
+		if err := c.ShouldBindJSON(&record); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		record, err := records.Add(record)
+		if err != nil {
+			recordError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"record": record})
+	})
+
+	router.PUT("/records/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Illegal value for 'id'"})
+			return
+		}
+
+		var record records.Record
+		if err := c.ShouldBindJSON(&record); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		record, err = records.Update(id, record)
+		if err != nil {
+			recordError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"record": record})
+	})
+
+	router.DELETE("/records/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Illegal value for 'id'"})
+			return
+		}
+
+		if err := records.Delete(id); err != nil {
+			recordError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"id": id})
+	})
+
 	router.GET("/stats", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"stats": stats.Dump()})
 	})
 
-	router.GET("/application/active", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"active": stats.Active()})
+	// switches are active, blocking, caching and hosts
+	router.GET("/application/:switch", func(c *gin.Context) {
+		sw, ok := stats.GetSwitch(c.Param("switch"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Unknown switch " + c.Param("switch")})
+			return
+		}
+
+		resp := gin.H{c.Param("switch"): sw.On(), "resume_in": int64(sw.ResumeIn() / time.Second)}
+		if c.Param("switch") == "active" {
+			resp["switches"] = stats.DumpSwitches()
+		}
+		c.JSON(http.StatusOK, resp)
 	})
 
-	router.PUT("/application/active", func(c *gin.Context) {
+	// state=Off&minutes=N pauses the switch for N minutes
+	router.PUT("/application/:switch", func(c *gin.Context) {
+		name := c.Param("switch")
 		active := c.Query("state")
 		version := c.Query("v")
+
+		sw, ok := stats.GetSwitch(name)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Unknown switch " + name})
+			return
+		}
+
 		if version != "1" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Illegal value for 'version'"})
-		} else {
-			switch active {
-			case "On":
-				stats.Activate()
-				c.JSON(http.StatusOK, gin.H{"active": stats.Active()})
-			case "Off":
-				stats.Deactivate()
-				c.JSON(http.StatusOK, gin.H{"active": stats.Active()})
-			default:
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Illegal value for 'state'"})
+			return
+		}
+
+		switch active {
+		case "On":
+			sw.TurnOn()
+		case "Off":
+			if m := c.Query("minutes"); m != "" {
+				minutes, err := strconv.Atoi(m)
+				if err != nil || minutes <= 0 {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Illegal value for 'minutes'"})
+					return
+				}
+				sw.Pause(time.Duration(minutes) * time.Minute)
+			} else {
+				sw.TurnOff()
 			}
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Illegal value for 'state'"})
+			return
 		}
+
+		c.JSON(http.StatusOK, gin.H{name: sw.On(), "resume_in": int64(sw.ResumeIn() / time.Second)})
 	})
 
 	// Serve Web GUI
@@ -119,16 +309,17 @@ func StartAPIServer(addr string, debugMode bool, cache c.Cache) error {
 		router.Use(static.Serve("/", BinaryFileSystem("")))
 	}
 
-	listener, err := net.Listen("tcp", addr)
-	if err != nil {
-		return err
-	}
-	go func() {
-		if err := server.Serve(listener); err != http.ErrServerClosed {
-			logger.Fatal(err)
-		}
-	}()
+	return router
+}
 
-	logger.Infof("API server listening on %s", addr)
-	return err
+// recordError answers a failed change of the custom records
+func recordError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, records.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, records.ErrInvalid):
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
 }
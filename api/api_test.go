@@ -0,0 +1,202 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/ray-g/dnsproxy/blocker"
+	c "github.com/ray-g/dnsproxy/cache"
+	"github.com/ray-g/dnsproxy/cache/memcache"
+	r "github.com/ray-g/dnsproxy/cache/record"
+	conf "github.com/ray-g/dnsproxy/config"
+	"github.com/ray-g/dnsproxy/logger"
+	"github.com/ray-g/dnsproxy/records"
+	"github.com/ray-g/dnsproxy/stats"
+)
+
+func TestMain(m *testing.M) {
+	logger.SetOutput(ioutil.Discard)
+	logger.InitLogger("api", false)
+	os.Exit(m.Run())
+}
+
+func serve(router http.Handler, method string, path string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestBlockerExport(t *testing.T) {
+	cache := memcache.NewCache()
+	router := newRouter(false, cache)
+
+	config := &conf.BlockerConfig{SourceDir: t.TempDir(), Blocklist: []string{"ads.example.com"}}
+	blocker.PerformUpdate(config, cache, false)
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/blocker/export/rpz", http.StatusOK, "$ORIGIN " + blocker.RPZOrigin},
+		{"/blocker/export/RPZ", http.StatusOK, "ads.example.com CNAME ."},
+		{"/blocker/export/Hosts", http.StatusOK, "0.0.0.0 ads.example.com"},
+		{"/blocker/export/bind", http.StatusNotFound, "Unknown format bind"},
+	}
+
+	for _, test := range tests {
+		w := serve(router, http.MethodGet, test.path, nil)
+		if w.Code != test.status || !strings.Contains(w.Body.String(), test.body) {
+			t.Errorf("GET %s = %d %q, want %d with %q", test.path, w.Code, w.Body.String(), test.status, test.body)
+		}
+	}
+
+	lower := serve(router, http.MethodGet, "/blocker/export/rpz", nil).Header().Get("ETag")
+	upper := serve(router, http.MethodGet, "/blocker/export/RPZ", nil).Header().Get("ETag")
+	if lower == "" || lower != upper {
+		t.Errorf("ETag of rpz %q and RPZ %q differ", lower, upper)
+	}
+	if w := serve(router, http.MethodGet, "/blocker/export/Rpz", map[string]string{"If-None-Match": lower}); w.Code != http.StatusNotModified {
+		t.Errorf("GET with the ETag of rpz = %d, want %d", w.Code, http.StatusNotModified)
+	}
+}
+
+func TestCacheKeys(t *testing.T) {
+	cache := memcache.NewCache()
+	router := newRouter(false, cache)
+
+	msg := new(dns.Msg)
+	msg.SetQuestion("www.example.com.", dns.TypeA)
+	rr, _ := dns.NewRR("www.example.com. 60 IN A 192.0.2.1")
+	msg.Answer = append(msg.Answer, rr)
+	cache.Set(c.GlobalPrefix+"www.example.com", r.NewResolvedRecord(msg, time.Minute))
+	cache.Set(c.GlobalPrefix+"www.example.com:AAAA", r.NewResolvedRecord(msg, time.Minute))
+	cache.Set("kids@www.example.com", r.NewResolvedRecord(msg, time.Minute))
+
+	w := serve(router, http.MethodGet, "/cache/www.example.com", nil)
+	var resp struct {
+		Answer []interface{} `json:"answer"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp.Answer) != 1 {
+		t.Errorf("GET /cache/www.example.com = %s", w.Body.String())
+	}
+
+	serve(router, http.MethodDelete, "/cache/www.example.com", nil)
+	for key, exists := range map[string]bool{
+		c.GlobalPrefix + "www.example.com":      false,
+		c.GlobalPrefix + "www.example.com:AAAA": false,
+		"kids@www.example.com":                  true,
+	} {
+		if cache.Exists(key) != exists {
+			t.Errorf("%s exists = %v after DELETE, want %v", key, !exists, exists)
+		}
+	}
+}
+
+func TestApplicationSwitches(t *testing.T) {
+	router := newRouter(false, memcache.NewCache())
+	stats.Activate()
+	t.Cleanup(func() {
+		sw, _ := stats.GetSwitch("blocking")
+		sw.TurnOn()
+	})
+
+	tests := []struct {
+		method   string
+		path     string
+		status   int
+		blocking bool
+	}{
+		{http.MethodPut, "/application/blocking?state=Off&minutes=5&v=1", http.StatusOK, false},
+		{http.MethodGet, "/application/blocking", http.StatusOK, false},
+		{http.MethodPut, "/application/blocking?state=On&v=1", http.StatusOK, true},
+		{http.MethodPut, "/application/blocking?state=Off&minutes=-1&v=1", http.StatusBadRequest, true},
+		{http.MethodPut, "/application/blocking?state=Off", http.StatusBadRequest, true},
+		{http.MethodPut, "/application/blocking?state=Off&v=1", http.StatusOK, false},
+		{http.MethodPut, "/application/blocking?state=On&v=1", http.StatusOK, true},
+		{http.MethodGet, "/application/dhcp", http.StatusNotFound, true},
+	}
+
+	for _, test := range tests {
+		w := serve(router, test.method, test.path, nil)
+		if w.Code != test.status || stats.BlockingActive() != test.blocking {
+			t.Errorf("%s %s = %d %s, blocking %v, want %d, blocking %v", test.method, test.path, w.Code, w.Body.String(),
+				stats.BlockingActive(), test.status, test.blocking)
+		}
+	}
+
+	serve(router, http.MethodPut, "/application/blocking?state=Off&minutes=5&v=1", nil)
+	var resp struct {
+		Blocking bool  `json:"blocking"`
+		ResumeIn int64 `json:"resume_in"`
+	}
+	w := serve(router, http.MethodGet, "/application/blocking", nil)
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Blocking || resp.ResumeIn <= 240 || resp.ResumeIn > 300 {
+		t.Errorf("GET /application/blocking after a pause = %s", w.Body.String())
+	}
+}
+
+func TestRecords(t *testing.T) {
+	router := newRouter(false, memcache.NewCache())
+	if err := records.Load(&conf.RecordsConfig{StateFile: filepath.Join(t.TempDir(), "records.json"), TTL: 300}); err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(method string, path string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+		answer string
+	}{
+		{http.MethodPost, "/records", `{"name": "api.local.test", "type": "A", "value": "192.168.1.20"}`, http.StatusCreated, ""},
+		{http.MethodPost, "/records", `{"name": "api.local.test", "type": "CNAME", "value": "dev.local.test"}`, http.StatusBadRequest, ""},
+		{http.MethodPost, "/records", `{"name": "api.local.test", "type": "A", "value": "fd00::1"}`, http.StatusBadRequest, ""},
+		{http.MethodPost, "/records", `{"name": `, http.StatusBadRequest, ""},
+		{http.MethodGet, "/records/1", "", http.StatusOK, ""},
+		{http.MethodGet, "/records/2", "", http.StatusNotFound, ""},
+		{http.MethodGet, "/records/one", "", http.StatusBadRequest, ""},
+		{http.MethodPut, "/records/1", `{"name": "api.local.test", "type": "A", "value": "192.168.1.21", "ttl": 60}`, http.StatusOK,
+			"api.local.test.\t60\tIN\tA\t192.168.1.21"},
+		{http.MethodPut, "/records/2", `{"name": "api.local.test", "type": "A", "value": "192.168.1.21"}`, http.StatusNotFound, ""},
+		{http.MethodDelete, "/records/1", "", http.StatusOK, ""},
+		{http.MethodDelete, "/records/1", "", http.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		if w := send(test.method, test.path, test.body); w.Code != test.status {
+			t.Errorf("%s %s %s = %d %s, want %d", test.method, test.path, test.body, w.Code, w.Body.String(), test.status)
+		}
+		// the answers follow the changes at once
+		if test.answer != "" {
+			if rrs, ok := records.Lookup("api.local.test.", dns.TypeA); !ok || len(rrs) != 1 || rrs[0].String() != test.answer {
+				t.Errorf("api.local.test answered %v after %s %s", rrs, test.method, test.path)
+			}
+		}
+	}
+
+	if _, ok := records.Lookup("api.local.test.", dns.TypeA); ok {
+		t.Error("deleted record still answered")
+	}
+}
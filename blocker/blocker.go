@@ -9,6 +9,9 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/miekg/dns"
 
 	c "github.com/ray-g/dnsproxy/cache"
 	r "github.com/ray-g/dnsproxy/cache/record"
@@ -18,17 +21,70 @@ import (
 	"github.com/ray-g/dnsproxy/utils"
 )
 
-var whitelist = make(map[string]bool)
+var (
+	mu        sync.RWMutex
+	updateMu  sync.Mutex
+	whitelist = make(map[string]bool)
+	responses = make(map[string]*Response)
+	rules     = make(map[string]*Response)
+	scheduler = &Scheduler{Now: time.Now}
+
+	defaultDeny bool
+	allowlist   *DomainSet
+)
+
+const (
+	sourceBlocklist = "blocklist"
+	sourceRules     = "rules"
+
+	// SourceDefaultDeny blocks names missing from the allowlist
+	SourceDefaultDeny = "default-deny"
+)
+
+// entries maps every blocked domain to the sources listing it
+type entries map[string][]string
+
+func (e entries) add(domain string, source string) {
+	domain = strings.ToLower(domain)
+	if Whitelisted(domain) {
+		return
+	}
+
+	sources := e[domain]
+	for _, s := range sources {
+		if s == source {
+			return
+		}
+	}
+	e[domain] = append(sources, source)
+}
 
 // Update downloads all of the blocklists and imports them into the database
-func update(config *conf.BlockerConfig, cache c.Cache, force bool) error {
+func update(config *conf.BlockerConfig, blocked entries, force bool) error {
+	mu.Lock()
 	for _, entry := range config.Whitelist {
-		whitelist[entry] = true
+		whitelist[strings.ToLower(entry)] = true
+	}
+	defaultDeny = config.DefaultDeny
+	allowlist = NewDomainSet(config.Allowlist)
+	mu.Unlock()
+
+	if err := loadResponses(config); err != nil {
+		return err
+	}
+
+	loadCategories(config)
+
+	if err := loadSchedules(config); err != nil {
+		return err
+	}
+
+	for _, rule := range config.Rules {
+		blocked.add(rule.Domain, sourceRules)
 	}
 
 	for _, entry := range config.Blocklist {
-		cache.Set(entry, r.NewBlockedRecord())
-		stats.AddBlockedDomain()
+		blocked.add(entry, sourceBlocklist)
 	}
 
 	if err := fetchSources(config.SourceURLs, config.SourceDir, force); err != nil {
@@ -38,15 +94,71 @@ func update(config *conf.BlockerConfig, cache c.Cache, force bool) error {
 	return nil
 }
 
-func downloadFile(uri string, name string, sourcedir string) error {
-	utils.EnsureDirectory(sourcedir)
-	filePath := filepath.FromSlash(filepath.Join(sourcedir, name))
+func loadResponses(config *conf.BlockerConfig) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, s := range allSources(config) {
+		resp, err := NewResponse(&s.Block)
+		if err == nil {
+			err = resp.Inherit(defaultResponse).Validate()
+		}
+		if err != nil {
+			return fmt.Errorf("error in block response of source %s: %s", s.Name, err)
+		}
+		responses[s.Name] = resp
+	}
+
+	for _, rule := range config.Rules {
+		resp, err := NewResponse(&rule.Block)
+		if err == nil {
+			err = resp.Inherit(defaultResponse).Validate()
+		}
+		if err != nil {
+			return fmt.Errorf("error in block response of rule %s: %s", rule.Domain, err)
+		}
+		rules[strings.ToLower(rule.Domain)] = resp
+	}
+
+	return nil
+}
 
-	output, err := os.Create(filePath)
+func loadSchedules(config *conf.BlockerConfig) error {
+	s, err := NewScheduler(config.Schedules, allSources(config))
 	if err != nil {
-		return fmt.Errorf("error creating file: %s", err)
+		return err
 	}
-	defer output.Close()
+
+	mu.Lock()
+	s.Now = scheduler.Now
+	scheduler = s
+	mu.Unlock()
+
+	return nil
+}
+
+func currentScheduler() *Scheduler {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return scheduler
+}
+
+// SetClock replaces the clock used to evaluate schedules
+func SetClock(now func() time.Time) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	s := *scheduler
+	s.Now = now
+	scheduler = &s
+}
+
+// downloadFile replaces the file only once the download completed, a failed
+// refresh keeps the previous list
+func downloadFile(uri string, name string, sourcedir string) error {
+	utils.EnsureDirectory(sourcedir)
+	filePath := filepath.FromSlash(filepath.Join(sourcedir, name))
 
 	response, err := http.Get(uri)
 	if err != nil {
@@ -54,11 +166,27 @@ func downloadFile(uri string, name string, sourcedir string) error {
 	}
 	defer response.Body.Close()
 
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("error downloading source %s: %s", uri, response.Status)
+	}
+
+	output, err := os.Create(filePath + ".part")
+	if err != nil {
+		return fmt.Errorf("error creating file: %s", err)
+	}
+
 	if _, err := io.Copy(output, response.Body); err != nil {
+		output.Close()
+		os.Remove(output.Name())
 		return fmt.Errorf("error copying output: %s", err)
 	}
 
-	return nil
+	if err := output.Close(); err != nil {
+		os.Remove(output.Name())
+		return fmt.Errorf("error writing file: %s", err)
+	}
+
+	return os.Rename(output.Name(), filePath)
 }
 
 func fetchSources(sources []conf.DNSBlockSource, sourceDir string, force bool) error {
@@ -89,15 +217,54 @@ func fetchSources(sources []conf.DNSBlockSource, sourceDir string, force bool) e
 	return nil
 }
 
-// UpdateBlockCache updates the BlockCache
-func updateBlockCache(cache c.Cache, sourceDir string) error {
+// UpdateBlockCache loads blocked into the cache, replacing the records whose
+// sources changed
+func updateBlockCache(cache c.Cache, blocked entries) {
+	for domain, sources := range blocked {
+		record, err := cache.Get(domain)
+		switch {
+		case err != nil:
+			cache.Set(domain, r.NewBlockedRecord(sources))
+			stats.AddBlockedDomain()
+		case !record.Blocked || !sameSources(record.Sources, sources):
+			cache.Remove(domain)
+			cache.Set(domain, r.NewBlockedRecord(sources))
+			if !record.Blocked {
+				stats.AddBlockedDomain()
+			}
+		}
+	}
+
+	logger.Debugf("%d domains loaded from sources", len(blocked))
+}
+
+// removeBlocked drops a domain no source lists anymore from the cache
+func removeBlocked(cache c.Cache, domain string) {
+	if record, err := cache.Get(domain); err == nil && record.Blocked {
+		cache.Remove(domain)
+		stats.RemoveBlockedDomain()
+	}
+}
+
+// parseSources adds the entries of every file in sourceDir to blocked
+func parseSources(sourceDir string, blocked entries) error {
 	logger.Debugf("loading blocked domains from %s ...", sourceDir)
 
-	err := filepath.Walk(sourceDir, func(path string, f os.FileInfo, _ error) error {
-		if !f.IsDir() {
+	// nothing was downloaded yet without sources
+	if _, err := os.Stat(sourceDir); os.IsNotExist(err) {
+		return nil
+	}
+
+	err := filepath.Walk(sourceDir, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !f.IsDir() && !strings.HasSuffix(path, ".part") {
 			fileName := filepath.FromSlash(path)
 
-			if err := parseHostFile(fileName, cache); err != nil {
+			source := strings.TrimSuffix(filepath.Base(fileName), ".list")
+			if err := parseHostFile(fileName, source, blocked); err != nil {
 				return fmt.Errorf("error parsing hostfile %s", err)
 			}
 		}
@@ -109,12 +276,10 @@ func updateBlockCache(cache c.Cache, sourceDir string) error {
 		return fmt.Errorf("error walking location %s", err)
 	}
 
-	logger.Debugf("%d domains loaded from sources", cache.Length())
-
 	return nil
 }
 
-func parseHostFile(fileName string, cache c.Cache) error {
+func parseHostFile(fileName string, source string, blocked entries) error {
 	file, err := os.Open(fileName)
 	if err != nil {
 		return fmt.Errorf("error opening file: %s", err)
@@ -135,10 +300,7 @@ func parseHostFile(fileName string, cache c.Cache) error {
 				line = fields[0]
 			}
 
-			if !cache.Exists(line) && !whitelist[line] {
-				cache.Set(line, r.NewBlockedRecord())
-				stats.AddBlockedDomain()
-			}
+			blocked.add(line, source)
 		}
 	}
 
@@ -149,14 +311,186 @@ func parseHostFile(fileName string, cache c.Cache) error {
 	return nil
 }
 
+// Whitelisted reports whether domain is exempt from blocking
+func Whitelisted(domain string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return whitelist[domain]
+}
+
+// Match reports whether domain is blocked under filter, along with the
+// source listing it. A nil filter applies the global policy.
+func Match(cache c.Cache, domain string, filter *Filter) (string, bool) {
+	return match(cache, strings.ToLower(utils.UnFqdn(domain)), filter, true)
+}
+
+// match applies the allowlist-only policy only to queried names, not to the
+// names met along an answer chain. domain is lower case without the root.
+func match(cache c.Cache, domain string, filter *Filter, queried bool) (string, bool) {
+	if filter != nil {
+		if filter.Whitelist[domain] {
+			return "", false
+		}
+		if filter.Blocklist[domain] {
+			return sourceBlocklist, true
+		}
+	}
+
+	if Whitelisted(domain) {
+		return "", false
+	}
+
+	if queried && filter.DeniedByDefault(domain) {
+		return SourceDefaultDeny, true
+	}
+
+	if schedule, ok := currentScheduler().Blocked(domain, filter.group()); ok {
+		return schedule, true
+	}
+
+	sources, ok := Listed(cache, domain)
+	if !ok {
+		return "", false
+	}
+
+	for _, source := range sources {
+		if filter.Enabled(source) {
+			return source, true
+		}
+	}
+
+	return "", false
+}
+
+// MatchChain looks for CNAME cloaking: it walks the owner names, CNAME and
+// DNAME targets and addresses of an upstream answer and returns the first
+// element found in the blocklist.
+func MatchChain(cache c.Cache, msg *dns.Msg, filter *Filter) (string, string, bool) {
+	qname := msg.Question[0].Name
+
+	for _, rr := range msg.Answer {
+		var elems []string
+
+		if rr.Header().Name != qname {
+			elems = append(elems, rr.Header().Name)
+		}
+
+		switch v := rr.(type) {
+		case *dns.CNAME:
+			elems = append(elems, v.Target)
+		case *dns.DNAME:
+			elems = append(elems, v.Target)
+		case *dns.A:
+			elems = append(elems, v.A.String())
+		case *dns.AAAA:
+			elems = append(elems, v.AAAA.String())
+		}
+
+		for _, elem := range elems {
+			elem = strings.ToLower(utils.UnFqdn(elem))
+			if source, ok := match(cache, elem, filter, false); ok {
+				return elem, source, true
+			}
+		}
+	}
+
+	return "", "", false
+}
+
 // PerformUpdate updates the block cache by building a new one and swapping
 // it for the old cache.
 func PerformUpdate(config *conf.BlockerConfig, cache c.Cache, forceUpdate bool) {
-	if err := update(config, cache, forceUpdate); err != nil {
+	if err := performUpdate(config, cache, forceUpdate); err != nil {
 		logger.Fatal(err)
 	}
+}
 
-	if err := updateBlockCache(cache, config.SourceDir); err != nil {
-		logger.Fatal(err)
+func performUpdate(config *conf.BlockerConfig, cache c.Cache, force bool) error {
+	updateMu.Lock()
+	defer updateMu.Unlock()
+
+	blocked := make(entries)
+
+	if err := update(config, blocked, force); err != nil {
+		return err
+	}
+
+	var (
+		list listing
+		u    *Update
+	)
+
+	if config.IndexFile != "" {
+		prev, changed, err := updateBlockIndex(config, blocked)
+		if err != nil {
+			return err
+		}
+
+		list = blockIndex.Each
+		switch {
+		case changed && prev != nil:
+			u = newUpdate(config, prev.Each, list, blockIndex.Len(), nil)
+		case changed || prev == nil:
+			u = newUpdate(config, nil, list, blockIndex.Len(), nil)
+		default:
+			u = &Update{Time: time.Now(), Domains: blockIndex.Len()}
+		}
+	} else {
+		if err := parseSources(config.SourceDir, blocked); err != nil {
+			return err
+		}
+
+		mu.RLock()
+		old := currentList
+		mu.RUnlock()
+
+		// compare before the cache is changed, old reads it
+		u = newUpdate(config, old, entriesListing(blocked), len(blocked), func(domain string) {
+			removeBlocked(cache, domain)
+		})
+		updateBlockCache(cache, blocked)
+		list = cacheListing(cache, blocked)
+	}
+
+	updateExport(config, list)
+	recordUpdate(config, u)
+
+	return updateIPBlocklist(config, force)
+}
+
+// StartUpdates refreshes the sources every UpdateInterval seconds, the first
+// update must have been performed. The returned func stops the updates, no
+// update runs anymore once it returns.
+func StartUpdates(config *conf.BlockerConfig, cache c.Cache) func() {
+	if config.UpdateInterval == 0 {
+		return func() {}
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(time.Duration(config.UpdateInterval) * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := performUpdate(config, cache, true); err != nil {
+					logger.Errorf("blocklist update failed: %s", err)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(stop) })
+		<-done
 	}
 }
@@ -0,0 +1,77 @@
+package blocker
+
+import (
+	"strings"
+
+	conf "github.com/ray-g/dnsproxy/config"
+)
+
+var (
+	sourceCategories   = make(map[string][]string)
+	disabledCategories = make(map[string]bool)
+)
+
+func loadCategories(config *conf.BlockerConfig) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	sourceCategories = make(map[string][]string)
+	for _, s := range allSources(config) {
+		for _, category := range s.Categories {
+			sourceCategories[s.Name] = append(sourceCategories[s.Name], strings.ToLower(category))
+		}
+	}
+
+	disabledCategories = make(map[string]bool)
+	for _, category := range config.DisabledCategories {
+		disabledCategories[strings.ToLower(category)] = true
+	}
+}
+
+// allSources returns the domain and IP sources of config
+func allSources(config *conf.BlockerConfig) []conf.DNSBlockSource {
+	sources := append([]conf.DNSBlockSource{}, config.SourceURLs...)
+	return append(sources, config.IPSourceURLs...)
+}
+
+// Categories returns the categories of a source
+func Categories(source string) []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return sourceCategories[source]
+}
+
+// categoryEnabled reports whether entries of category are blocked under f
+func (f *Filter) categoryEnabled(category string) bool {
+	if f != nil {
+		if f.DisabledCategories[category] {
+			return false
+		}
+		if f.Categories != nil {
+			return f.Categories[category]
+		}
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return !disabledCategories[category]
+}
+
+// categoriesEnabled reports whether a source is blocked under f by its
+// categories, that is it has none or one of them is enabled
+func (f *Filter) categoriesEnabled(source string) bool {
+	categories := Categories(source)
+	if len(categories) == 0 {
+		return true
+	}
+
+	for _, category := range categories {
+		if f.categoryEnabled(category) {
+			return true
+		}
+	}
+
+	return false
+}
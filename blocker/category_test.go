@@ -0,0 +1,75 @@
+package blocker
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	mem "github.com/ray-g/dnsproxy/cache/memcache"
+	conf "github.com/ray-g/dnsproxy/config"
+)
+
+func TestCategories(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"ads.list":     "0.0.0.0 ads.example\n0.0.0.0 shared.example\n",
+		"malware.list": "0.0.0.0 malware.example\n0.0.0.0 shared.example\n",
+		"plain.list":   "0.0.0.0 plain.example\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := &conf.BlockerConfig{
+		SourceDir: dir,
+		SourceURLs: []conf.DNSBlockSource{
+			{Name: "ads", Categories: []string{"Ads", "tracking"}},
+			{Name: "malware", Categories: []string{"malware"}},
+			{Name: "plain"},
+		},
+		DisabledCategories: []string{"Tracking"},
+	}
+	cache := mem.NewCache()
+	if err := performUpdate(config, cache, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if categories := Categories("ads"); !reflect.DeepEqual(categories, []string{"ads", "tracking"}) {
+		t.Errorf("Categories(ads) = %v", categories)
+	}
+	if categories := Categories("plain"); categories != nil {
+		t.Errorf("Categories(plain) = %v", categories)
+	}
+
+	noMalware := NewFilter(&conf.ClientGroupConfig{Name: "kids", DisabledCategories: []string{"Malware"}})
+	malwareOnly := NewFilter(&conf.ClientGroupConfig{Name: "servers", Categories: []string{"malware"}})
+	noAds := NewFilter(&conf.ClientGroupConfig{Name: "adults", DisabledCategories: []string{"ads", "tracking"}})
+
+	tests := []struct {
+		domain  string
+		filter  *Filter
+		source  string
+		blocked bool
+	}{
+		{"ads.example", nil, "ads", true},
+		{"malware.example", nil, "malware", true},
+		{"plain.example", nil, "plain", true},
+		{"malware.example", noMalware, "", false},
+		{"shared.example", noMalware, "ads", true},
+		{"plain.example", noMalware, "plain", true},
+		{"ads.example", malwareOnly, "", false},
+		{"shared.example", malwareOnly, "malware", true},
+		{"plain.example", malwareOnly, "plain", true},
+		{"ads.example", noAds, "", false},
+		{"shared.example", noAds, "malware", true},
+	}
+
+	for _, test := range tests {
+		source, blocked := Match(cache, test.domain, test.filter)
+		if blocked != test.blocked || source != test.source {
+			t.Errorf("Match(%s, %s) = %q, %v, want %q, %v", test.domain, test.filter.group(), source, blocked, test.source, test.blocked)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package blocker
+
+import (
+	"strings"
+
+	"github.com/ray-g/dnsproxy/utils"
+)
+
+// DomainSet matches domains exactly, or with their subdomains for entries
+// starting with "*."
+type DomainSet struct {
+	exact  map[string]bool
+	suffix map[string]bool
+}
+
+// NewDomainSet returns a DomainSet of entries
+func NewDomainSet(entries []string) *DomainSet {
+	d := &DomainSet{
+		exact:  make(map[string]bool),
+		suffix: make(map[string]bool),
+	}
+
+	for _, entry := range entries {
+		entry = strings.ToLower(utils.UnFqdn(entry))
+		if strings.HasPrefix(entry, "*.") {
+			d.suffix[entry[2:]] = true
+		} else {
+			d.exact[entry] = true
+		}
+	}
+
+	return d
+}
+
+// Contains reports whether domain is in d, walking up its labels
+func (d *DomainSet) Contains(domain string) bool {
+	if d == nil {
+		return false
+	}
+
+	domain = strings.ToLower(domain)
+	if d.exact[domain] {
+		return true
+	}
+
+	for name := domain; name != ""; {
+		if d.suffix[name] {
+			return true
+		}
+
+		i := strings.IndexByte(name, '.')
+		if i < 0 {
+			break
+		}
+		name = name[i+1:]
+	}
+
+	return false
+}
+
+// Len returns the number of entries in d
+func (d *DomainSet) Len() int {
+	if d == nil {
+		return 0
+	}
+	return len(d.exact) + len(d.suffix)
+}
@@ -0,0 +1,39 @@
+package blocker
+
+import "testing"
+
+func TestDomainSet(t *testing.T) {
+	d := NewDomainSet([]string{"Exact.Example.", "*.Allowed.example", "*.co.uk"})
+
+	tests := []struct {
+		domain   string
+		contains bool
+	}{
+		{"exact.example", true},
+		{"EXACT.example", true},
+		{"www.exact.example", false},
+		{"allowed.example", true},
+		{"www.allowed.example", true},
+		{"a.b.ALLOWED.example", true},
+		{"notallowed.example", false},
+		{"shop.co.uk", true},
+		{"uk", false},
+		{"example", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		if contains := d.Contains(test.domain); contains != test.contains {
+			t.Errorf("Contains(%q) = %v, want %v", test.domain, contains, test.contains)
+		}
+	}
+
+	if d.Len() != 3 {
+		t.Errorf("Len() = %d, want 3", d.Len())
+	}
+
+	var none *DomainSet
+	if none.Contains("example") || none.Len() != 0 {
+		t.Error("nil set contains domains")
+	}
+}
@@ -0,0 +1,284 @@
+package blocker
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	c "github.com/ray-g/dnsproxy/cache"
+	conf "github.com/ray-g/dnsproxy/config"
+	"github.com/ray-g/dnsproxy/logger"
+	"github.com/ray-g/dnsproxy/utils"
+)
+
+// listing calls fn for every blocked domain with its sources in sorted order
+type listing func(fn func(domain string, sources []string))
+
+// exportFormat writes the header of an exported list and one line per domain
+type exportFormat struct {
+	header func(w io.Writer, e *Export)
+	line   string
+}
+
+func commentHeader(w io.Writer, e *Export) {
+	fmt.Fprintf(w, "# dnsproxy blocklist, serial %d, %d domains\n", e.Serial, e.Domains)
+}
+
+// zoneHeader is the header of the formats whose entries block whole zones
+func zoneHeader(w io.Writer, e *Export) {
+	commentHeader(w, e)
+	fmt.Fprintf(w, "# entries also block their subdomains, dnsproxy blocks the listed names only\n")
+}
+
+var exportFormats = map[string]exportFormat{
+	"hosts":   {commentHeader, "0.0.0.0 %s\n"},
+	"domains": {commentHeader, "%s\n"},
+	"dnsmasq": {zoneHeader, "address=/%s/#\n"},
+	"unbound": {zoneHeader, "local-zone: \"%s.\" always_null\n"},
+	"rpz":     {rpzHeader, "%s CNAME .\n"},
+}
+
+// RPZOrigin is the zone of the RPZ export, the response-policy zone of the
+// resolver loading it must have this name
+const RPZOrigin = "rpz.dnsproxy."
+
+// rpzHeader starts a zone file with its origin and apex, the entries are
+// relative to the origin
+func rpzHeader(w io.Writer, e *Export) {
+	fmt.Fprintf(w, "; dnsproxy blocklist, %d domains\n", e.Domains)
+	fmt.Fprintf(w, "$ORIGIN %s\n$TTL 300\n", RPZOrigin)
+	fmt.Fprintf(w, "@ IN SOA localhost. root.localhost. %d 3600 600 604800 300\n", e.Serial)
+	fmt.Fprintf(w, "@ IN NS localhost.\n")
+}
+
+// ExportFormats returns the names of the export formats
+func ExportFormats() []string {
+	var formats []string
+	for name := range exportFormats {
+		formats = append(formats, name)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// Export is a snapshot of the effective blocklist, whitelisted entries and
+// sources of globally disabled categories are left out. Serial and ETag only
+// change with the content.
+type Export struct {
+	Serial  uint32
+	ETag    string
+	Domains int
+	list    listing
+}
+
+var (
+	currentList   listing
+	currentExport *Export
+)
+
+// reservedDomains are the loopback and special-use names of hosts files and
+// their subdomains, blocking them breaks the resolver loading the export
+var reservedDomains = []string{"localhost", "localdomain", "local", "broadcasthost", "invalid", "test", "onion", "home.arpa"}
+
+// exportable reports whether domain is a valid name outside the reserved ones
+func exportable(domain string) bool {
+	if !utils.IsDomain(domain) || strings.Contains(domain, "*") {
+		return false
+	}
+
+	for _, reserved := range reservedDomains {
+		if utils.HasDomainSuffix(domain, reserved) {
+			return false
+		}
+	}
+	return true
+}
+
+// effective drops the entries of list not blocked by the global policy and
+// the ones that aren't exportable, schedules are not applied
+func effective(list listing) listing {
+	return func(fn func(domain string, sources []string)) {
+		list(func(domain string, sources []string) {
+			if Whitelisted(domain) || !exportable(domain) {
+				return
+			}
+
+			var enabled []string
+			for _, source := range sources {
+				if (*Filter)(nil).categoriesEnabled(source) {
+					enabled = append(enabled, source)
+				}
+			}
+			if len(enabled) > 0 {
+				fn(domain, enabled)
+			}
+		})
+	}
+}
+
+func sortedDomains(blocked entries) []string {
+	domains := make([]string, 0, len(blocked))
+	for domain := range blocked {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+// entriesListing lists blocked in sorted order
+func entriesListing(blocked entries) listing {
+	domains := sortedDomains(blocked)
+
+	return func(fn func(domain string, sources []string)) {
+		for _, domain := range domains {
+			fn(domain, blocked[domain])
+		}
+	}
+}
+
+// cacheListing lists the entries of blocked loaded into cache, only their
+// names are kept
+func cacheListing(cache c.Cache, blocked entries) listing {
+	domains := sortedDomains(blocked)
+
+	return func(fn func(domain string, sources []string)) {
+		for _, domain := range domains {
+			if sources, ok := Listed(cache, domain); ok {
+				fn(domain, sources)
+			}
+		}
+	}
+}
+
+// newExport hashes list, the serial of prev is kept when the content did not
+// change and increased otherwise
+func newExport(list listing, prev *Export) *Export {
+	list = effective(list)
+
+	h := sha256.New()
+	e := &Export{list: list}
+	list(func(domain string, _ []string) {
+		io.WriteString(h, domain)
+		h.Write([]byte{'\n'})
+		e.Domains++
+	})
+	e.ETag = hex.EncodeToString(h.Sum(nil)[:16])
+
+	switch {
+	case prev != nil && prev.ETag == e.ETag:
+		e.Serial = prev.Serial
+	case prev != nil && uint32(time.Now().Unix()) <= prev.Serial:
+		e.Serial = prev.Serial + 1
+	default:
+		e.Serial = uint32(time.Now().Unix())
+	}
+
+	return e
+}
+
+// readSerial returns the export stored in a serial file, which holds the
+// serial and ETag of the last export
+func readSerial(path string) *Export {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	e := &Export{}
+	if _, err := fmt.Sscanf(string(b), "%d %s", &e.Serial, &e.ETag); err != nil {
+		logger.Warningf("invalid serial file %s: %s", path, err)
+		return nil
+	}
+	return e
+}
+
+func writeSerial(path string, e *Export) {
+	data := fmt.Sprintf("%d %s\n", e.Serial, e.ETag)
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		logger.Warningf("error writing serial file %s: %s", path, err)
+	}
+}
+
+// updateExport snapshots the current blocklist for export
+func updateExport(config *conf.BlockerConfig, list listing) {
+	mu.RLock()
+	prev := currentExport
+	mu.RUnlock()
+
+	if prev == nil && config.SerialFile != "" {
+		prev = readSerial(config.SerialFile)
+	}
+
+	e := newExport(list, prev)
+	if config.SerialFile != "" && (prev == nil || prev.Serial != e.Serial) {
+		writeSerial(config.SerialFile, e)
+	}
+
+	mu.Lock()
+	currentList = list
+	currentExport = e
+	mu.Unlock()
+}
+
+// CurrentExport returns the export of the loaded blocklist, nil before the
+// first update
+func CurrentExport() *Export {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return currentExport
+}
+
+// NewExport fetches and parses the sources of config and returns their export
+func NewExport(config *conf.BlockerConfig, force bool) (*Export, error) {
+	blocked := make(entries)
+
+	if err := update(config, blocked, force); err != nil {
+		return nil, err
+	}
+
+	if err := parseSources(config.SourceDir, blocked); err != nil {
+		return nil, err
+	}
+
+	var prev *Export
+	if config.SerialFile != "" {
+		prev = readSerial(config.SerialFile)
+	}
+
+	e := newExport(entriesListing(blocked), prev)
+	if config.SerialFile != "" && (prev == nil || prev.Serial != e.Serial) {
+		writeSerial(config.SerialFile, e)
+	}
+
+	return e, nil
+}
+
+// Write writes the export to w in format
+func (e *Export) Write(w io.Writer, format string) error {
+	f, ok := exportFormats[strings.ToLower(format)]
+	if !ok {
+		return fmt.Errorf("unknown export format %q", format)
+	}
+
+	bw := bufio.NewWriter(w)
+	f.header(bw, e)
+
+	var err error
+	e.list(func(domain string, _ []string) {
+		if err == nil {
+			_, err = fmt.Fprintf(bw, f.line, domain)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
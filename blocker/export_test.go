@@ -0,0 +1,116 @@
+package blocker
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestExportable(t *testing.T) {
+	tests := []struct {
+		domain     string
+		exportable bool
+	}{
+		{"ads.example.com", true},
+		{"tracker.example.solutions", true},
+		{"ads.example.xn--p1ai", true},
+		{"localhost", false},
+		{"localhost.localdomain", false},
+		{"broadcasthost", false},
+		{"local", false},
+		{"printer.local", false},
+		{"ip6-localhost", false},
+		{"0.0.0.0", false},
+		{"::1", false},
+		{"*.example.com", false},
+		{"ads.test", false},
+		{"hidden.onion", false},
+		{"nas.home.arpa", false},
+		{"example", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		if exportable := exportable(test.domain); exportable != test.exportable {
+			t.Errorf("exportable(%q) = %v, want %v", test.domain, exportable, test.exportable)
+		}
+	}
+}
+
+func TestExportWrite(t *testing.T) {
+	// the entries of a StevenBlack style hosts file
+	blocked := make(entries)
+	for _, domain := range []string{
+		"localhost", "localhost.localdomain", "local", "broadcasthost",
+		"ip6-localhost", "ip6-loopback", "0.0.0.0", "ads.example.com", "tracker.example.net",
+	} {
+		blocked.add(domain, "StevenBlack")
+	}
+
+	e := newExport(entriesListing(blocked), nil)
+	if e.Domains != 2 {
+		t.Errorf("export has %d domains, want 2", e.Domains)
+	}
+
+	tests := []struct {
+		format string
+		lines  []string
+	}{
+		{"hosts", []string{"0.0.0.0 ads.example.com", "0.0.0.0 tracker.example.net"}},
+		{"domains", []string{"ads.example.com", "tracker.example.net"}},
+		{"dnsmasq", []string{"address=/ads.example.com/#", "address=/tracker.example.net/#"}},
+		{"unbound", []string{`local-zone: "ads.example.com." always_null`, `local-zone: "tracker.example.net." always_null`}},
+		{"rpz", []string{"ads.example.com CNAME .", "tracker.example.net CNAME ."}},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := e.Write(&buf, strings.ToUpper(test.format)); err != nil {
+			t.Fatalf("%s: %s", test.format, err)
+		}
+
+		var lines []string
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			if !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, ";") &&
+				!strings.HasPrefix(line, "$") && !strings.HasPrefix(line, "@") && !strings.HasPrefix(line, " ") {
+				lines = append(lines, line)
+			}
+		}
+		if strings.Join(lines, "\n") != strings.Join(test.lines, "\n") {
+			t.Errorf("%s export:\n%s\nwant entries:\n%s", test.format, buf.String(), strings.Join(test.lines, "\n"))
+		}
+
+		subdomains := strings.Contains(buf.String(), "also block their subdomains")
+		if want := test.format == "dnsmasq" || test.format == "unbound"; subdomains != want {
+			t.Errorf("%s export notes subdomains = %v, want %v", test.format, subdomains, want)
+		}
+	}
+
+	// the RPZ export loads as a zone without an origin given
+	var rpz bytes.Buffer
+	if err := e.Write(&rpz, "rpz"); err != nil {
+		t.Fatal(err)
+	}
+	var records []string
+	zp := dns.NewZoneParser(&rpz, "", "")
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		records = append(records, dns.TypeToString[rr.Header().Rrtype]+" "+rr.Header().Name)
+	}
+	if err := zp.Err(); err != nil {
+		t.Fatalf("RPZ export does not load: %s", err)
+	}
+	want := []string{
+		"SOA rpz.dnsproxy.", "NS rpz.dnsproxy.",
+		"CNAME ads.example.com.rpz.dnsproxy.", "CNAME tracker.example.net.rpz.dnsproxy.",
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("RPZ export records %v, want %v", records, want)
+	}
+
+	if err := e.Write(&bytes.Buffer{}, "bind"); err == nil {
+		t.Error("unknown format written")
+	}
+}
@@ -0,0 +1,104 @@
+package blocker
+
+import (
+	"strings"
+
+	conf "github.com/ray-g/dnsproxy/config"
+)
+
+// Filter is the blocking policy of a client group
+type Filter struct {
+	Group string
+
+	// Sources and Categories enabled for the group, nil enables all
+	Sources            map[string]bool
+	Categories         map[string]bool
+	DisabledCategories map[string]bool
+	Whitelist          map[string]bool
+	Blocklist          map[string]bool
+
+	// DefaultDeny overrides the blocker policy when set
+	DefaultDeny *bool
+	Allowlist   *DomainSet
+}
+
+func toSet(list []string, lower bool) map[string]bool {
+	set := make(map[string]bool)
+	for _, entry := range list {
+		if lower {
+			entry = strings.ToLower(entry)
+		}
+		set[entry] = true
+	}
+	return set
+}
+
+// NewFilter returns the Filter of a client group
+func NewFilter(config *conf.ClientGroupConfig) *Filter {
+	f := &Filter{
+		Group:              config.Name,
+		DisabledCategories: toSet(config.DisabledCategories, true),
+		Whitelist:          toSet(config.Whitelist, true),
+		Blocklist:          toSet(config.Blocklist, true),
+		DefaultDeny:        config.DefaultDeny,
+		Allowlist:          NewDomainSet(config.Allowlist),
+	}
+
+	if len(config.Sources) > 0 {
+		f.Sources = toSet(config.Sources, false)
+	}
+
+	if len(config.Categories) > 0 {
+		f.Categories = toSet(config.Categories, true)
+	}
+
+	return f
+}
+
+// Enabled reports whether entries of source are blocked under f
+func (f *Filter) Enabled(source string) bool {
+	if f != nil && f.Sources != nil && !f.Sources[source] {
+		return false
+	}
+
+	if !f.categoriesEnabled(source) {
+		return false
+	}
+
+	return currentScheduler().SourceActive(source, f.group())
+}
+
+// group returns the client group of f, empty for the global policy
+func (f *Filter) group() string {
+	if f == nil {
+		return ""
+	}
+	return f.Group
+}
+
+// Whitelisted reports whether domain is exempt from blocking under f
+func (f *Filter) Whitelisted(domain string) bool {
+	domain = strings.ToLower(domain)
+	if f != nil && f.Whitelist[domain] {
+		return true
+	}
+
+	return Whitelisted(domain)
+}
+
+// DeniedByDefault reports whether domain is denied by an allowlist-only policy
+func (f *Filter) DeniedByDefault(domain string) bool {
+	mu.RLock()
+	deny, list := defaultDeny, allowlist
+	mu.RUnlock()
+
+	if f != nil && f.DefaultDeny != nil {
+		deny = *f.DefaultDeny
+	}
+
+	if !deny || list.Contains(domain) {
+		return false
+	}
+
+	return f == nil || !f.Allowlist.Contains(domain)
+}
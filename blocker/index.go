@@ -0,0 +1,154 @@
+package blocker
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	c "github.com/ray-g/dnsproxy/cache"
+	conf "github.com/ray-g/dnsproxy/config"
+	"github.com/ray-g/dnsproxy/domainindex"
+	"github.com/ray-g/dnsproxy/logger"
+	"github.com/ray-g/dnsproxy/stats"
+)
+
+var blockIndex *domainindex.Index
+
+// fingerprint hashes what an index is built from: the manual entries, the
+// whitelist and the name, size and content of every source file. Downloads
+// that bring the same lists keep the index.
+func fingerprint(config *conf.BlockerConfig) domainindex.Fingerprint {
+	h := sha256.New()
+
+	write := func(values ...string) {
+		values = append([]string{}, values...)
+		sort.Strings(values)
+		for _, v := range values {
+			fmt.Fprintf(h, "%q\n", v)
+		}
+		h.Write([]byte{0})
+	}
+
+	var rules []string
+	for _, rule := range config.Rules {
+		rules = append(rules, rule.Domain)
+	}
+
+	write(config.Whitelist...)
+	write(config.Blocklist...)
+	write(rules...)
+
+	filepath.Walk(config.SourceDir, func(path string, f os.FileInfo, err error) error {
+		if err != nil || f.IsDir() || strings.HasSuffix(path, ".part") {
+			return nil
+		}
+
+		fmt.Fprintf(h, "%q\n", path)
+		binary.Write(h, binary.LittleEndian, f.Size())
+
+		file, err := os.Open(path)
+		if err != nil {
+			logger.Warningf("error hashing source %s: %s", path, err)
+			return nil
+		}
+		defer file.Close()
+
+		content := sha256.New()
+		io.Copy(content, file)
+		h.Write(content.Sum(nil))
+		return nil
+	})
+
+	var fp domainindex.Fingerprint
+	copy(fp[:], h.Sum(nil))
+	return fp
+}
+
+// updateBlockIndex opens the index of config, it is compiled first when it
+// is missing or its sources changed. The index that was replaced is returned
+// on change, the loaded one or else the outdated file.
+func updateBlockIndex(config *conf.BlockerConfig, blocked entries) (*domainindex.Index, bool, error) {
+	fp := fingerprint(config)
+
+	mu.RLock()
+	prev := blockIndex
+	mu.RUnlock()
+
+	idx, err := domainindex.Open(config.IndexFile)
+	changed := err != nil || idx.Fingerprint() != fp
+	if !changed {
+		logger.Debugf("%d domains loaded from index %s", idx.Len(), config.IndexFile)
+	} else {
+		if err != nil && !os.IsNotExist(err) {
+			logger.Warningf("rebuilding index: %s", err)
+		}
+		if prev == nil {
+			prev = idx
+		}
+
+		if err := parseSources(config.SourceDir, blocked); err != nil {
+			return nil, false, err
+		}
+
+		if err := domainindex.Write(config.IndexFile, blocked, fp); err != nil {
+			return nil, false, fmt.Errorf("error writing index %s: %s", config.IndexFile, err)
+		}
+
+		if idx, err = domainindex.Open(config.IndexFile); err != nil {
+			return nil, false, fmt.Errorf("error opening index %s", err)
+		}
+
+		logger.Debugf("%d domains compiled into index %s", idx.Len(), config.IndexFile)
+	}
+
+	// the old index is unmapped by its finalizer once no lookup uses it
+	mu.Lock()
+	blockIndex = idx
+	mu.Unlock()
+
+	stats.SetBlockedDomains(idx.Len())
+
+	return prev, changed, nil
+}
+
+// Compile fetches the sources of config and compiles them into an index at
+// path, it returns the number of domains in the index
+func Compile(config *conf.BlockerConfig, path string, force bool) (int, error) {
+	blocked := make(entries)
+
+	if err := update(config, blocked, force); err != nil {
+		return 0, err
+	}
+
+	if err := parseSources(config.SourceDir, blocked); err != nil {
+		return 0, err
+	}
+
+	if err := domainindex.Write(path, blocked, fingerprint(config)); err != nil {
+		return 0, fmt.Errorf("error writing index %s: %s", path, err)
+	}
+
+	return len(blocked), nil
+}
+
+// Listed returns the sources listing domain in the cache or the index
+func Listed(cache c.Cache, domain string) ([]string, bool) {
+	if record, err := cache.Get(domain); err == nil && record.Blocked {
+		return record.Sources, true
+	}
+
+	mu.RLock()
+	idx := blockIndex
+	mu.RUnlock()
+
+	if idx == nil {
+		return nil, false
+	}
+
+	return idx.Lookup(domain)
+}
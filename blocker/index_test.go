@@ -0,0 +1,55 @@
+package blocker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	conf "github.com/ray-g/dnsproxy/config"
+)
+
+func TestFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	list := filepath.Join(dir, "ads.list")
+	write := func(content string, mtime time.Time) {
+		if err := ioutil.WriteFile(list, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(list, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := &conf.BlockerConfig{SourceDir: dir, Blocklist: []string{"a.example"}}
+	start := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+
+	write("0.0.0.0 ads.example\n", start)
+	fp := fingerprint(config)
+
+	tests := []struct {
+		name    string
+		change  func()
+		changed bool
+	}{
+		{"same content downloaded again", func() { write("0.0.0.0 ads.example\n", start.Add(time.Hour)) }, false},
+		{"changed content of the same size", func() { write("0.0.0.0 adz.example\n", start.Add(time.Hour)) }, true},
+		{"changed content", func() { write("0.0.0.0 ads.example\n0.0.0.0 more.example\n", start) }, true},
+		{"partial download", func() { ioutil.WriteFile(list+".part", []byte("x"), 0644) }, false},
+		{"new source", func() { ioutil.WriteFile(filepath.Join(dir, "more.list"), nil, 0644) }, true},
+		{"manual entry added", func() { config.Blocklist = []string{"b.example", "a.example"} }, true},
+		{"manual entries reordered", func() { config.Blocklist = []string{"a.example", "b.example"} }, false},
+		{"whitelist", func() { config.Whitelist = []string{"ok.example"} }, true},
+		{"rules", func() { config.Rules = []conf.BlockRule{{Domain: "rule.example"}} }, true},
+	}
+
+	for _, test := range tests {
+		test.change()
+		next := fingerprint(config)
+		if changed := next != fp; changed != test.changed {
+			t.Errorf("%s: fingerprint changed = %v, want %v", test.name, changed, test.changed)
+		}
+		fp = next
+	}
+}
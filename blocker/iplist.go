@@ -0,0 +1,160 @@
+package blocker
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	conf "github.com/ray-g/dnsproxy/config"
+	"github.com/ray-g/dnsproxy/iptree"
+	"github.com/ray-g/dnsproxy/logger"
+)
+
+const sourceIPBlocklist = "ipblocklist"
+
+var ipBlocklist = iptree.New()
+
+// updateIPBlocklist builds a new IP blocklist from the manual entries and the
+// files in IPSourceDir and swaps it for the old one
+func updateIPBlocklist(config *conf.BlockerConfig, force bool) error {
+	if err := fetchSources(config.IPSourceURLs, config.IPSourceDir, force); err != nil {
+		return fmt.Errorf("error fetching IP sources: %s", err)
+	}
+
+	tree := iptree.New()
+
+	for _, entry := range config.IPBlocklist {
+		if err := insertIP(tree, entry, sourceIPBlocklist); err != nil {
+			logger.Warningf("invalid IP blocklist entry %s: %s", entry, err)
+		}
+	}
+
+	if _, err := os.Stat(config.IPSourceDir); err == nil {
+		err := filepath.Walk(config.IPSourceDir, func(path string, f os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if !f.IsDir() {
+				fileName := filepath.FromSlash(path)
+
+				source := strings.TrimSuffix(filepath.Base(fileName), ".list")
+				if err := parseIPFile(fileName, source, tree); err != nil {
+					return fmt.Errorf("error parsing IP list %s", err)
+				}
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return fmt.Errorf("error walking location %s", err)
+		}
+	}
+
+	logger.Debugf("%d networks loaded into IP blocklist", tree.Len())
+
+	mu.Lock()
+	ipBlocklist = tree
+	mu.Unlock()
+
+	return nil
+}
+
+// insertIP adds the network of entry listed by source, a network keeps every
+// source listing it
+func insertIP(tree *iptree.Tree, entry string, source string) error {
+	network, err := iptree.ParseCIDR(entry)
+	if err != nil {
+		return err
+	}
+
+	var sources []string
+	if value, ok := tree.Get(network); ok {
+		sources = value.([]string)
+		for _, s := range sources {
+			if s == source {
+				return nil
+			}
+		}
+	}
+
+	tree.Insert(network, append(sources, source))
+	return nil
+}
+
+// parseIPFile reads one IP or CIDR per line, anything after it is ignored
+func parseIPFile(fileName string, source string, tree *iptree.Tree) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return fmt.Errorf("error opening file: %s", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		line = strings.Split(line, "#")[0]
+		line = strings.Split(line, ";")[0]
+		line = strings.TrimSpace(line)
+
+		if len(line) > 0 {
+			entry := strings.Fields(line)[0]
+			if err := insertIP(tree, entry, source); err != nil {
+				logger.Debugf("skip invalid entry %s in %s", entry, fileName)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error scanning IP list: %s", err)
+	}
+
+	return nil
+}
+
+// MatchIP reports whether ip is in the IP blocklist under filter, along with
+// the first enabled source of the most specific network listing it
+func MatchIP(ip net.IP, filter *Filter) (string, bool) {
+	mu.RLock()
+	tree := ipBlocklist
+	mu.RUnlock()
+
+	for _, value := range tree.LookupAll(ip) {
+		for _, source := range value.([]string) {
+			if filter.Enabled(source) {
+				return source, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// MatchAddresses returns the first A/AAAA address of an answer found in the
+// IP blocklist
+func MatchAddresses(msg *dns.Msg, filter *Filter) (net.IP, string, bool) {
+	for _, rr := range msg.Answer {
+		var ip net.IP
+
+		switch v := rr.(type) {
+		case *dns.A:
+			ip = v.A
+		case *dns.AAAA:
+			ip = v.AAAA
+		default:
+			continue
+		}
+
+		if source, ok := MatchIP(ip, filter); ok {
+			return ip, source, true
+		}
+	}
+
+	return nil, "", false
+}
@@ -0,0 +1,77 @@
+package blocker
+
+import (
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+
+	conf "github.com/ray-g/dnsproxy/config"
+)
+
+func TestMatchIP(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"feed-a.list": "203.0.113.0/24\n198.51.100.7 # host\n",
+		"feed-b.list": "203.0.113.0/24\n203.0.113.128/25 ; upper half\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := &conf.BlockerConfig{IPSourceDir: dir, IPBlocklist: []string{"192.0.2.1", "198.51.100.7"}}
+	if err := updateIPBlocklist(config, false); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { updateIPBlocklist(&conf.BlockerConfig{}, false) })
+
+	tests := []struct {
+		ip      string
+		sources []string
+		source  string
+		blocked bool
+	}{
+		{"203.0.113.1", nil, "feed-a", true},
+		{"203.0.113.1", []string{"feed-b"}, "feed-b", true},
+		{"203.0.113.1", []string{"feed-a"}, "feed-a", true},
+		{"203.0.113.1", []string{"other"}, "", false},
+		{"203.0.113.200", nil, "feed-b", true},
+		{"203.0.113.200", []string{"feed-a"}, "feed-a", true},
+		{"198.51.100.7", []string{"feed-a"}, "feed-a", true},
+		{"198.51.100.7", []string{sourceIPBlocklist}, sourceIPBlocklist, true},
+		{"192.0.2.1", nil, sourceIPBlocklist, true},
+		{"192.0.2.2", nil, "", false},
+	}
+
+	for _, test := range tests {
+		var filter *Filter
+		if test.sources != nil {
+			filter = &Filter{Sources: toSet(test.sources, false)}
+		}
+
+		source, blocked := MatchIP(net.ParseIP(test.ip), filter)
+		if blocked != test.blocked || source != test.source {
+			t.Errorf("MatchIP(%s) with sources %v = %q, %v, want %q, %v", test.ip, test.sources, source, blocked, test.source, test.blocked)
+		}
+	}
+}
+
+func TestUpdateIPBlocklistMissingDir(t *testing.T) {
+	config := &conf.BlockerConfig{IPSourceDir: filepath.Join(t.TempDir(), "missing"), IPBlocklist: []string{"192.0.2.1"}}
+	if err := updateIPBlocklist(config, false); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { updateIPBlocklist(&conf.BlockerConfig{}, false) })
+
+	if _, ok := MatchIP(net.ParseIP("192.0.2.1"), nil); !ok {
+		t.Error("manual entry not blocked without IP source directory")
+	}
+}
+
+func TestParseSourcesMissingDir(t *testing.T) {
+	blocked := make(entries)
+	if err := parseSources(filepath.Join(t.TempDir(), "missing"), blocked); err != nil || len(blocked) != 0 {
+		t.Errorf("parseSources of a missing directory = %v, %v", blocked, err)
+	}
+}
@@ -0,0 +1,15 @@
+package blocker
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ray-g/dnsproxy/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.SetOutput(ioutil.Discard)
+	logger.InitLogger("blocker", false)
+	os.Exit(m.Run())
+}
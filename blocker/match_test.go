@@ -0,0 +1,80 @@
+package blocker
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	mem "github.com/ray-g/dnsproxy/cache/memcache"
+	conf "github.com/ray-g/dnsproxy/config"
+)
+
+func TestMatchCase(t *testing.T) {
+	dir := t.TempDir()
+	list := "0.0.0.0 Ads.Example.com\n0.0.0.0 ok.example.com\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "ads.list"), []byte(list), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &conf.BlockerConfig{
+		SourceDir: dir,
+		Whitelist: []string{"OK.example.com"},
+		Blocklist: []string{"Manual.Example"},
+		Rules:     []conf.BlockRule{{Domain: "Rule.Example", Block: conf.BlockResponseConfig{Mode: "refused"}}},
+		Schedules: []conf.ScheduleConfig{{
+			Name:    "homework",
+			Domains: []string{"Social.Example"},
+			Windows: []conf.ScheduleWindow{{Start: "00:00", End: "00:00"}},
+		}},
+	}
+	cache := mem.NewCache()
+	if err := performUpdate(config, cache, false); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetClock(time.Now) })
+
+	deny := true
+	kids := NewFilter(&conf.ClientGroupConfig{
+		Name:      "kids",
+		Whitelist: []string{"Ads.Example.com"},
+		Blocklist: []string{"Games.Example"},
+	})
+	kiosk := NewFilter(&conf.ClientGroupConfig{
+		Name:        "kiosk",
+		DefaultDeny: &deny,
+		Allowlist:   []string{"*.Allowed.Example", "EXACT.example"},
+	})
+
+	tests := []struct {
+		domain  string
+		filter  *Filter
+		source  string
+		blocked bool
+	}{
+		{"ads.example.com", nil, "ads", true},
+		{"ADS.example.COM.", nil, "ads", true},
+		{"aDs.ExAmPlE.cOm", nil, "ads", true},
+		{"Ok.Example.Com", nil, "", false},
+		{"manual.EXAMPLE", nil, sourceBlocklist, true},
+		{"RULE.example.", nil, sourceRules, true},
+		{"SOCIAL.example", nil, "homework", true},
+		{"ADS.example.com", kids, "", false},
+		{"games.EXAMPLE.", kids, sourceBlocklist, true},
+		{"www.ALLOWED.example", kiosk, "", false},
+		{"Exact.Example.", kiosk, "", false},
+		{"Other.Example", kiosk, SourceDefaultDeny, true},
+		{"Ads.Example.com", kiosk, SourceDefaultDeny, true},
+	}
+
+	for _, test := range tests {
+		source, blocked := Match(cache, test.domain, test.filter)
+		if blocked != test.blocked || source != test.source {
+			t.Errorf("Match(%q, %s) = %q, %v, want %q, %v", test.domain, test.filter.group(), source, blocked, test.source, test.blocked)
+		}
+	}
+
+	if resp := ResponseFor("RULE.Example.", sourceRules); resp == nil || resp.Mode != ModeRefused {
+		t.Errorf("ResponseFor(RULE.Example.) = %+v, want the refused rule", resp)
+	}
+}
@@ -0,0 +1,220 @@
+package blocker
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	conf "github.com/ray-g/dnsproxy/config"
+	"github.com/ray-g/dnsproxy/utils"
+)
+
+// Mode tells how a blocked query is answered
+type Mode int
+
+const (
+	ModeInherit Mode = iota
+	ModeNull
+	ModeSinkhole
+	ModeNXDomain
+	ModeNoData
+	ModeRefused
+	ModeDrop
+)
+
+var modeNames = map[string]Mode{
+	"":         ModeInherit,
+	"null":     ModeNull,
+	"sinkhole": ModeSinkhole,
+	"nxdomain": ModeNXDomain,
+	"nodata":   ModeNoData,
+	"refused":  ModeRefused,
+	"drop":     ModeDrop,
+}
+
+var (
+	nullroute   = net.ParseIP("0.0.0.0")
+	nullroutev6 = net.ParseIP("0:0:0:0:0:0:0:0")
+)
+
+// Response type
+type Response struct {
+	Mode Mode
+	IPv4 net.IP
+	IPv6 net.IP
+	TTL  uint32
+}
+
+// defaultResponse is the block response of the resolver, the responses of
+// the sources and rules inherit from it
+var defaultResponse = &Response{Mode: ModeNull}
+
+// SetDefaultResponse sets the block response of the resolver, the responses
+// of the sources and rules are validated against it when they are loaded
+func SetDefaultResponse(resp *Response) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	defaultResponse = resp
+}
+
+// NewResponse parses a block response config
+func NewResponse(config *conf.BlockResponseConfig) (*Response, error) {
+	mode, ok := modeNames[strings.ToLower(config.Mode)]
+	if !ok {
+		return nil, fmt.Errorf("unknown block mode %q", config.Mode)
+	}
+
+	resp := &Response{Mode: mode, TTL: config.TTL}
+
+	if config.IPv4 != "" {
+		if resp.IPv4 = net.ParseIP(config.IPv4).To4(); resp.IPv4 == nil {
+			return nil, fmt.Errorf("invalid sinkhole IPv4 address %q", config.IPv4)
+		}
+	}
+
+	if config.IPv6 != "" {
+		if resp.IPv6 = net.ParseIP(config.IPv6).To16(); resp.IPv6 == nil {
+			return nil, fmt.Errorf("invalid sinkhole IPv6 address %q", config.IPv6)
+		}
+	}
+
+	if resp.Mode == ModeInherit && (resp.IPv4 != nil || resp.IPv6 != nil) {
+		resp.Mode = ModeSinkhole
+	}
+
+	return resp, nil
+}
+
+// Validate rejects a sinkhole without an address to answer with
+func (r *Response) Validate() error {
+	if r.Mode == ModeSinkhole && r.IPv4 == nil && r.IPv6 == nil {
+		return fmt.Errorf("sinkhole block mode without IPv4 or IPv6 address")
+	}
+	return nil
+}
+
+// Inherit returns a copy of r with unset fields taken from parent.
+// A nil Response inherits everything.
+func (r *Response) Inherit(parent *Response) *Response {
+	if r == nil {
+		return parent
+	}
+
+	resp := *r
+	if resp.Mode == ModeInherit {
+		resp.Mode = parent.Mode
+	}
+	if resp.IPv4 == nil {
+		resp.IPv4 = parent.IPv4
+	}
+	if resp.IPv6 == nil {
+		resp.IPv6 = parent.IPv6
+	}
+	if resp.TTL == 0 {
+		resp.TTL = parent.TTL
+	}
+
+	return &resp
+}
+
+// Reply builds the answer to a blocked query of any qtype,
+// nil means the query is dropped
+func (r *Response) Reply(req *dns.Msg) *dns.Msg {
+	if r.Mode == ModeDrop {
+		return nil
+	}
+
+	m := new(dns.Msg)
+	m.SetReply(req)
+
+	switch r.Mode {
+	case ModeNXDomain:
+		m.SetRcode(req, dns.RcodeNameError)
+		m.Ns = append(m.Ns, r.soa(req))
+		return m
+	case ModeNoData:
+		m.Ns = append(m.Ns, r.soa(req))
+		return m
+	case ModeRefused:
+		m.SetRcode(req, dns.RcodeRefused)
+		return m
+	}
+
+	q := req.Question[0]
+
+	var ip net.IP
+	switch q.Qtype {
+	case dns.TypeA:
+		ip = nullroute
+		if r.Mode == ModeSinkhole {
+			ip = r.IPv4
+		}
+		if ip != nil {
+			rrHeader := dns.RR_Header{
+				Name:   q.Name,
+				Rrtype: dns.TypeA,
+				Class:  dns.ClassINET,
+				Ttl:    r.TTL,
+			}
+			m.Answer = append(m.Answer, &dns.A{Hdr: rrHeader, A: ip})
+		}
+	case dns.TypeAAAA:
+		ip = nullroutev6
+		if r.Mode == ModeSinkhole {
+			ip = r.IPv6
+		}
+		if ip != nil {
+			rrHeader := dns.RR_Header{
+				Name:   q.Name,
+				Rrtype: dns.TypeAAAA,
+				Class:  dns.ClassINET,
+				Ttl:    r.TTL,
+			}
+			m.Answer = append(m.Answer, &dns.AAAA{Hdr: rrHeader, AAAA: ip})
+		}
+	}
+
+	// non-address qtypes (HTTPS, SVCB, MX, TXT, ANY...) and a sinkhole without
+	// an address of the queried family answer NODATA
+	if len(m.Answer) == 0 {
+		m.Ns = append(m.Ns, r.soa(req))
+	}
+
+	return m
+}
+
+// soa makes the negative answers cacheable for TTL seconds
+func (r *Response) soa(req *dns.Msg) dns.RR {
+	name := req.Question[0].Name
+	return &dns.SOA{
+		Hdr: dns.RR_Header{
+			Name:   name,
+			Rrtype: dns.TypeSOA,
+			Class:  dns.ClassINET,
+			Ttl:    r.TTL,
+		},
+		Ns:      "fake-for-negative-caching.dnsproxy.",
+		Mbox:    "hostmaster." + name,
+		Serial:  1,
+		Refresh: 1800,
+		Retry:   900,
+		Expire:  604800,
+		Minttl:  r.TTL,
+	}
+}
+
+// ResponseFor returns the block response configured for domain, either by a
+// rule or by the source that listed it. A nil Response means use the default.
+func ResponseFor(domain string, source string) *Response {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if resp, ok := rules[strings.ToLower(utils.UnFqdn(domain))]; ok {
+		return resp
+	}
+
+	return responses[source]
+}
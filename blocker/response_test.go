@@ -0,0 +1,160 @@
+package blocker
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	conf "github.com/ray-g/dnsproxy/config"
+)
+
+func TestResponseReply(t *testing.T) {
+	sinkhole := &Response{Mode: ModeSinkhole, IPv4: net.ParseIP("10.0.0.80").To4(), IPv6: net.ParseIP("fd00::80"), TTL: 42}
+	sinkhole4 := &Response{Mode: ModeSinkhole, IPv4: net.ParseIP("10.0.0.80").To4(), TTL: 42}
+
+	tests := []struct {
+		name   string
+		resp   *Response
+		qtype  uint16
+		rcode  int
+		answer string
+		soa    bool
+	}{
+		{"null A", &Response{Mode: ModeNull, TTL: 42}, dns.TypeA, dns.RcodeSuccess, "0.0.0.0", false},
+		{"null AAAA", &Response{Mode: ModeNull, TTL: 42}, dns.TypeAAAA, dns.RcodeSuccess, "::", false},
+		{"null HTTPS", &Response{Mode: ModeNull, TTL: 42}, dns.TypeHTTPS, dns.RcodeSuccess, "", true},
+		{"null MX", &Response{Mode: ModeNull, TTL: 42}, dns.TypeMX, dns.RcodeSuccess, "", true},
+		{"sinkhole A", sinkhole, dns.TypeA, dns.RcodeSuccess, "10.0.0.80", false},
+		{"sinkhole AAAA", sinkhole, dns.TypeAAAA, dns.RcodeSuccess, "fd00::80", false},
+		{"sinkhole without IPv6", sinkhole4, dns.TypeAAAA, dns.RcodeSuccess, "", true},
+		{"sinkhole TXT", sinkhole, dns.TypeTXT, dns.RcodeSuccess, "", true},
+		{"nxdomain A", &Response{Mode: ModeNXDomain, TTL: 42}, dns.TypeA, dns.RcodeNameError, "", true},
+		{"nxdomain SVCB", &Response{Mode: ModeNXDomain, TTL: 42}, dns.TypeSVCB, dns.RcodeNameError, "", true},
+		{"nodata A", &Response{Mode: ModeNoData, TTL: 42}, dns.TypeA, dns.RcodeSuccess, "", true},
+		{"refused AAAA", &Response{Mode: ModeRefused, TTL: 42}, dns.TypeAAAA, dns.RcodeRefused, "", false},
+	}
+
+	for _, test := range tests {
+		req := new(dns.Msg)
+		req.SetQuestion("ads.example.", test.qtype)
+
+		m := test.resp.Reply(req)
+		if m.Rcode != test.rcode {
+			t.Errorf("%s: rcode %s, want %s", test.name, dns.RcodeToString[m.Rcode], dns.RcodeToString[test.rcode])
+		}
+
+		var answer string
+		for _, rr := range m.Answer {
+			switch v := rr.(type) {
+			case *dns.A:
+				answer = v.A.String()
+			case *dns.AAAA:
+				answer = v.AAAA.String()
+			}
+			if rr.Header().Name != "ads.example." || rr.Header().Ttl != 42 {
+				t.Errorf("%s: answer %s", test.name, rr)
+			}
+		}
+		if answer != test.answer {
+			t.Errorf("%s: answer %q, want %q", test.name, answer, test.answer)
+		}
+
+		soa := len(m.Ns) == 1 && m.Ns[0].Header().Rrtype == dns.TypeSOA && m.Ns[0].(*dns.SOA).Minttl == 42
+		if soa != test.soa {
+			t.Errorf("%s: authority %v", test.name, m.Ns)
+		}
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion("ads.example.", dns.TypeA)
+	if m := (&Response{Mode: ModeDrop}).Reply(req); m != nil {
+		t.Errorf("drop replied %v", m)
+	}
+}
+
+func TestResponseInherit(t *testing.T) {
+	parent := &Response{Mode: ModeSinkhole, IPv4: net.ParseIP("10.0.0.80").To4(), TTL: 60}
+
+	resp, err := NewResponse(&conf.BlockResponseConfig{IPv6: "fd00::80"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Mode != ModeSinkhole {
+		t.Errorf("response with an address has mode %d, want sinkhole", resp.Mode)
+	}
+
+	inherited := resp.Inherit(parent)
+	if !inherited.IPv4.Equal(parent.IPv4) || !inherited.IPv6.Equal(net.ParseIP("fd00::80")) || inherited.TTL != 60 {
+		t.Errorf("inherited response %+v", inherited)
+	}
+
+	var none *Response
+	if none.Inherit(parent) != parent {
+		t.Error("nil response does not inherit everything")
+	}
+
+	for _, config := range []conf.BlockResponseConfig{
+		{Mode: "blackhole"},
+		{Mode: "sinkhole", IPv4: "fd00::80"},
+		{Mode: "sinkhole", IPv6: "not an ip"},
+	} {
+		if _, err := NewResponse(&config); err == nil {
+			t.Errorf("invalid response %+v parsed", config)
+		}
+	}
+}
+
+func TestLoadResponses(t *testing.T) {
+	t.Cleanup(func() { SetDefaultResponse(&Response{Mode: ModeNull}) })
+
+	tests := []struct {
+		name    string
+		parent  *Response
+		config  conf.BlockerConfig
+		invalid string
+	}{
+		{
+			"sinkhole source with its address",
+			&Response{Mode: ModeNull},
+			conf.BlockerConfig{SourceURLs: []conf.DNSBlockSource{{Name: "ads", Block: conf.BlockResponseConfig{Mode: "sinkhole", IPv4: "10.0.0.80"}}}},
+			"",
+		},
+		{
+			"sinkhole source inheriting the address",
+			&Response{Mode: ModeNull, IPv4: net.ParseIP("10.0.0.80").To4()},
+			conf.BlockerConfig{SourceURLs: []conf.DNSBlockSource{{Name: "ads", Block: conf.BlockResponseConfig{Mode: "sinkhole"}}}},
+			"",
+		},
+		{
+			"sinkhole source without address",
+			&Response{Mode: ModeNull},
+			conf.BlockerConfig{SourceURLs: []conf.DNSBlockSource{{Name: "ads", Block: conf.BlockResponseConfig{Mode: "sinkhole"}}}},
+			"source ads",
+		},
+		{
+			"sinkhole rule without address",
+			&Response{Mode: ModeNXDomain},
+			conf.BlockerConfig{Rules: []conf.BlockRule{{Domain: "rule.example", Block: conf.BlockResponseConfig{Mode: "Sinkhole"}}}},
+			"rule rule.example",
+		},
+		{
+			"unknown mode of a rule",
+			&Response{Mode: ModeNull},
+			conf.BlockerConfig{Rules: []conf.BlockRule{{Domain: "rule.example", Block: conf.BlockResponseConfig{Mode: "blackhole"}}}},
+			"rule rule.example",
+		},
+	}
+
+	for _, test := range tests {
+		SetDefaultResponse(test.parent)
+		err := loadResponses(&test.config)
+		switch {
+		case test.invalid == "" && err != nil:
+			t.Errorf("%s: %s", test.name, err)
+		case test.invalid != "" && (err == nil || !strings.Contains(err.Error(), test.invalid)):
+			t.Errorf("%s: error %v, want one naming %s", test.name, err, test.invalid)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package blocker
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	conf "github.com/ray-g/dnsproxy/config"
+	"github.com/ray-g/dnsproxy/utils"
+)
+
+const minutesPerWeek = 7 * 24 * 60
+
+var weekdays = map[string][]time.Weekday{
+	"sun":      {time.Sunday},
+	"mon":      {time.Monday},
+	"tue":      {time.Tuesday},
+	"wed":      {time.Wednesday},
+	"thu":      {time.Thursday},
+	"fri":      {time.Friday},
+	"sat":      {time.Saturday},
+	"weekdays": {time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	"weekend":  {time.Saturday, time.Sunday},
+}
+
+// Schedule blocks a domain set and restricts sources to weekly time windows
+type Schedule struct {
+	Name    string
+	groups  map[string]bool
+	loc     *time.Location
+	minutes [minutesPerWeek/64 + 1]uint64
+}
+
+// NewSchedule parses a schedule config
+func NewSchedule(config *conf.ScheduleConfig) (*Schedule, error) {
+	s := &Schedule{Name: config.Name, loc: time.Local}
+
+	if config.TimeZone != "" {
+		loc, err := time.LoadLocation(config.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone %q: %s", config.TimeZone, err)
+		}
+		s.loc = loc
+	}
+
+	if len(config.Groups) > 0 {
+		s.groups = make(map[string]bool)
+		for _, group := range config.Groups {
+			s.groups[group] = true
+		}
+	}
+
+	for _, window := range config.Windows {
+		if err := s.addWindow(&window); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func parseClock(s string) (int, error) {
+	var hour, minute int
+	if _, err := fmt.Sscanf(s, "%d:%d", &hour, &minute); err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	if hour < 0 || minute < 0 || minute > 59 || hour*60+minute > 24*60 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return hour*60 + minute, nil
+}
+
+// addWindow marks the minutes of window, a window ending before it starts
+// runs past midnight into the next day
+func (s *Schedule) addWindow(window *conf.ScheduleWindow) error {
+	start, err := parseClock(window.Start)
+	if err != nil {
+		return err
+	}
+	end, err := parseClock(window.End)
+	if err != nil {
+		return err
+	}
+	if end <= start {
+		end += 24 * 60
+	}
+
+	days := window.Days
+	if len(days) == 0 {
+		days = []string{"weekdays", "weekend"}
+	}
+
+	for _, day := range days {
+		wds, ok := weekdays[strings.ToLower(day)]
+		if !ok {
+			return fmt.Errorf("invalid day %q", day)
+		}
+
+		for _, wd := range wds {
+			for m := start; m < end; m++ {
+				minute := (int(wd)*24*60 + m) % minutesPerWeek
+				s.minutes[minute/64] |= 1 << uint(minute%64)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Active reports whether t is within one of the windows of s
+func (s *Schedule) Active(t time.Time) bool {
+	t = t.In(s.loc)
+	minute := int(t.Weekday())*24*60 + t.Hour()*60 + t.Minute()
+	return s.minutes[minute/64]&(1<<uint(minute%64)) != 0
+}
+
+// AppliesTo reports whether s applies to the client group
+func (s *Schedule) AppliesTo(group string) bool {
+	return s.groups == nil || s.groups[group]
+}
+
+// Scheduler evaluates the schedules of the blocker, Now can be replaced to
+// control the clock
+type Scheduler struct {
+	Now     func() time.Time
+	domains map[string][]*Schedule
+	sources map[string][]*Schedule
+}
+
+// NewScheduler builds a Scheduler from config, the categories of schedules
+// are resolved to the sources tagged with them
+func NewScheduler(configs []conf.ScheduleConfig, sources []conf.DNSBlockSource) (*Scheduler, error) {
+	s := &Scheduler{
+		Now:     time.Now,
+		domains: make(map[string][]*Schedule),
+		sources: make(map[string][]*Schedule),
+	}
+
+	for _, config := range configs {
+		schedule, err := NewSchedule(&config)
+		if err != nil {
+			return nil, fmt.Errorf("error in schedule %s: %s", config.Name, err)
+		}
+
+		for _, domain := range config.Domains {
+			domain = strings.ToLower(strings.TrimPrefix(utils.UnFqdn(domain), "*."))
+			s.domains[domain] = append(s.domains[domain], schedule)
+		}
+
+		scheduled := append([]string{}, config.Sources...)
+		for _, category := range config.Categories {
+			for _, source := range sources {
+				for _, c := range source.Categories {
+					if strings.EqualFold(c, category) {
+						scheduled = append(scheduled, source.Name)
+						break
+					}
+				}
+			}
+		}
+
+		for _, source := range scheduled {
+			s.sources[source] = append(s.sources[source], schedule)
+		}
+	}
+
+	return s, nil
+}
+
+// Blocked returns the schedule currently blocking domain, or one of its
+// parent domains, for the client group
+func (s *Scheduler) Blocked(domain string, group string) (string, bool) {
+	if len(s.domains) == 0 {
+		return "", false
+	}
+
+	var now time.Time
+	for name := domain; name != ""; {
+		for _, schedule := range s.domains[name] {
+			if !schedule.AppliesTo(group) {
+				continue
+			}
+			if now.IsZero() {
+				now = s.Now()
+			}
+			if schedule.Active(now) {
+				return schedule.Name, true
+			}
+		}
+
+		i := strings.IndexByte(name, '.')
+		if i < 0 {
+			break
+		}
+		name = name[i+1:]
+	}
+
+	return "", false
+}
+
+// SourceActive reports whether the entries of source are enforced now for
+// the client group. Sources restricted by a schedule of the group are only
+// enforced during its windows.
+func (s *Scheduler) SourceActive(source string, group string) bool {
+	scheduled := false
+	for _, schedule := range s.sources[source] {
+		if !schedule.AppliesTo(group) {
+			continue
+		}
+		if schedule.Active(s.Now()) {
+			return true
+		}
+		scheduled = true
+	}
+
+	return !scheduled
+}
@@ -0,0 +1,123 @@
+package blocker
+
+import (
+	"testing"
+	"time"
+
+	conf "github.com/ray-g/dnsproxy/config"
+)
+
+func TestScheduleWindows(t *testing.T) {
+	utc := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	// October 2026: Fri 16, Sat 17, Sun 18, Mon 19, Tue 20
+	tests := []struct {
+		name     string
+		timeZone string
+		window   conf.ScheduleWindow
+		now      time.Time
+		blocked  bool
+	}{
+		{"before midnight window", "UTC", conf.ScheduleWindow{Days: []string{"fri"}, Start: "22:00", End: "02:00"}, utc(10, 16, 21, 59), false},
+		{"midnight window start", "UTC", conf.ScheduleWindow{Days: []string{"fri"}, Start: "22:00", End: "02:00"}, utc(10, 16, 22, 0), true},
+		{"midnight window next day", "UTC", conf.ScheduleWindow{Days: []string{"fri"}, Start: "22:00", End: "02:00"}, utc(10, 17, 1, 59), true},
+		{"midnight window end", "UTC", conf.ScheduleWindow{Days: []string{"fri"}, Start: "22:00", End: "02:00"}, utc(10, 17, 2, 0), false},
+		{"midnight window other day", "UTC", conf.ScheduleWindow{Days: []string{"fri"}, Start: "22:00", End: "02:00"}, utc(10, 16, 1, 0), false},
+		{"midnight window into next week", "UTC", conf.ScheduleWindow{Days: []string{"sun"}, Start: "23:00", End: "01:00"}, utc(10, 19, 0, 30), true},
+		{"midnight window from last week", "UTC", conf.ScheduleWindow{Days: []string{"sun"}, Start: "23:00", End: "01:00"}, utc(10, 18, 0, 30), false},
+
+		{"last minute of weekdays", "UTC", conf.ScheduleWindow{Days: []string{"weekdays"}, Start: "00:00", End: "24:00"}, utc(10, 16, 23, 59), true},
+		{"first minute of weekend", "UTC", conf.ScheduleWindow{Days: []string{"weekdays"}, Start: "00:00", End: "24:00"}, utc(10, 17, 0, 0), false},
+		{"last minute of week", "UTC", conf.ScheduleWindow{Days: []string{"weekdays"}, Start: "00:00", End: "24:00"}, utc(10, 18, 23, 59), false},
+		{"first minute of week", "UTC", conf.ScheduleWindow{Days: []string{"weekdays"}, Start: "00:00", End: "24:00"}, utc(10, 19, 0, 0), true},
+		{"weekend", "UTC", conf.ScheduleWindow{Days: []string{"weekend"}, Start: "10:00", End: "11:00"}, utc(10, 18, 10, 30), true},
+		{"every day", "UTC", conf.ScheduleWindow{Start: "10:00", End: "11:00"}, utc(10, 20, 10, 30), true},
+
+		{"full day window start", "UTC", conf.ScheduleWindow{Days: []string{"mon"}, Start: "08:00", End: "08:00"}, utc(10, 19, 8, 0), true},
+		{"full day window next day", "UTC", conf.ScheduleWindow{Days: []string{"mon"}, Start: "08:00", End: "08:00"}, utc(10, 20, 7, 59), true},
+		{"full day window end", "UTC", conf.ScheduleWindow{Days: []string{"mon"}, Start: "08:00", End: "08:00"}, utc(10, 20, 8, 0), false},
+		{"before full day window", "UTC", conf.ScheduleWindow{Days: []string{"mon"}, Start: "08:00", End: "08:00"}, utc(10, 19, 7, 59), false},
+
+		{"time zone ahead", "Asia/Tokyo", conf.ScheduleWindow{Days: []string{"mon"}, Start: "09:00", End: "10:00"}, utc(10, 19, 0, 30), true},
+		{"time zone ahead day before", "Asia/Tokyo", conf.ScheduleWindow{Days: []string{"mon"}, Start: "09:00", End: "10:00"}, utc(10, 18, 23, 59), false},
+		{"time zone ahead same clock", "Asia/Tokyo", conf.ScheduleWindow{Days: []string{"mon"}, Start: "09:00", End: "10:00"}, utc(10, 19, 9, 30), false},
+		{"daylight saving time", "America/New_York", conf.ScheduleWindow{Start: "09:00", End: "10:00"}, utc(10, 19, 13, 30), true},
+		{"standard time", "America/New_York", conf.ScheduleWindow{Start: "09:00", End: "10:00"}, utc(11, 2, 13, 30), false},
+		{"standard time shifted", "America/New_York", conf.ScheduleWindow{Start: "09:00", End: "10:00"}, utc(11, 2, 14, 30), true},
+	}
+
+	t.Cleanup(func() { SetClock(time.Now) })
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &conf.BlockerConfig{
+				Schedules: []conf.ScheduleConfig{{
+					Name:     "homework",
+					Domains:  []string{"social.example"},
+					TimeZone: test.timeZone,
+					Windows:  []conf.ScheduleWindow{test.window},
+				}},
+			}
+			if err := loadSchedules(config); err != nil {
+				t.Fatal(err)
+			}
+
+			now := test.now
+			SetClock(func() time.Time { return now })
+
+			for _, domain := range []string{"social.example", "www.social.example"} {
+				schedule, blocked := currentScheduler().Blocked(domain, "")
+				if blocked != test.blocked {
+					t.Errorf("%s blocked at %s = %v, want %v", domain, now, blocked, test.blocked)
+				}
+				if blocked && schedule != "homework" {
+					t.Errorf("%s blocked by %q, want homework", domain, schedule)
+				}
+			}
+		})
+	}
+}
+
+func TestScheduleSources(t *testing.T) {
+	config := &conf.BlockerConfig{
+		SourceURLs: []conf.DNSBlockSource{
+			{Name: "games", Categories: []string{"Gambling"}},
+			{Name: "ads", Categories: []string{"ads"}},
+		},
+		Schedules: []conf.ScheduleConfig{{
+			Name:       "evening",
+			Categories: []string{"gambling"},
+			Groups:     []string{"kids"},
+			TimeZone:   "UTC",
+			Windows:    []conf.ScheduleWindow{{Start: "18:00", End: "21:00"}},
+		}},
+	}
+	if err := loadSchedules(config); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetClock(time.Now) })
+
+	tests := []struct {
+		source string
+		group  string
+		hour   int
+		active bool
+	}{
+		{"games", "kids", 19, true},
+		{"games", "kids", 12, false},
+		{"games", "adults", 12, true},
+		{"games", "", 12, true},
+		{"ads", "kids", 12, true},
+	}
+
+	for _, test := range tests {
+		now := time.Date(2026, 10, 19, test.hour, 0, 0, 0, time.UTC)
+		SetClock(func() time.Time { return now })
+
+		if active := currentScheduler().SourceActive(test.source, test.group); active != test.active {
+			t.Errorf("source %s for group %q at %02d:00 active = %v, want %v", test.source, test.group, test.hour, active, test.active)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package blocker
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	conf "github.com/ray-g/dnsproxy/config"
+	"github.com/ray-g/dnsproxy/logger"
+)
+
+// SourceChange lists the domains a source added and removed in an update,
+// the lists are cut at the configured limit but the counts are exact
+type SourceChange struct {
+	Added          int      `json:"added"`
+	Removed        int      `json:"removed"`
+	AddedDomains   []string `json:"added_domains,omitempty"`
+	RemovedDomains []string `json:"removed_domains,omitempty"`
+	Truncated      bool     `json:"truncated,omitempty"`
+}
+
+// Update is the report of a blocklist update, Initial is set when there was
+// no previous blocklist to compare with
+type Update struct {
+	ID      int                      `json:"id"`
+	Time    time.Time                `json:"time"`
+	Initial bool                     `json:"initial,omitempty"`
+	Domains int                      `json:"domains"`
+	Added   int                      `json:"added"`
+	Removed int                      `json:"removed"`
+	Sources map[string]*SourceChange `json:"sources,omitempty"`
+}
+
+var (
+	updatesMu sync.RWMutex
+	updates   []*Update
+	updateID  int
+)
+
+type listed struct {
+	domain  string
+	sources []string
+}
+
+func sameSources(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// diffListings walks two sorted listings and calls fn for every domain whose
+// sources changed, with its sources before and after
+func diffListings(old listing, new listing, fn func(domain string, before []string, after []string)) {
+	ch := make(chan listed, 1024)
+	go func() {
+		old(func(domain string, sources []string) {
+			ch <- listed{domain, sources}
+		})
+		close(ch)
+	}()
+
+	cur, ok := <-ch
+	new(func(domain string, sources []string) {
+		for ok && cur.domain < domain {
+			fn(cur.domain, cur.sources, nil)
+			cur, ok = <-ch
+		}
+
+		if ok && cur.domain == domain {
+			if !sameSources(cur.sources, sources) {
+				fn(domain, cur.sources, sources)
+			}
+			cur, ok = <-ch
+			return
+		}
+
+		fn(domain, nil, sources)
+	})
+
+	for ok {
+		fn(cur.domain, cur.sources, nil)
+		cur, ok = <-ch
+	}
+}
+
+// newUpdate compares the listings before and after an update, removed is
+// called for every domain no source lists anymore
+func newUpdate(config *conf.BlockerConfig, old listing, new listing, domains int, removed func(domain string)) *Update {
+	u := &Update{Time: time.Now(), Domains: domains, Initial: old == nil}
+	if old == nil {
+		return u
+	}
+
+	u.Sources = make(map[string]*SourceChange)
+	change := func(source string) *SourceChange {
+		c, ok := u.Sources[source]
+		if !ok {
+			c = &SourceChange{}
+			u.Sources[source] = c
+		}
+		return c
+	}
+
+	diffListings(old, new, func(domain string, before []string, after []string) {
+		switch {
+		case len(before) == 0:
+			u.Added++
+		case len(after) == 0:
+			u.Removed++
+			if removed != nil {
+				removed(domain)
+			}
+		}
+
+		for _, source := range after {
+			if !contains(before, source) {
+				c := change(source)
+				c.Added++
+				if len(c.AddedDomains) < config.UpdateDiffLimit {
+					c.AddedDomains = append(c.AddedDomains, domain)
+				} else {
+					c.Truncated = true
+				}
+			}
+		}
+
+		for _, source := range before {
+			if !contains(after, source) {
+				c := change(source)
+				c.Removed++
+				if len(c.RemovedDomains) < config.UpdateDiffLimit {
+					c.RemovedDomains = append(c.RemovedDomains, domain)
+				} else {
+					c.Truncated = true
+				}
+			}
+		}
+	})
+
+	return u
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// recordUpdate logs the counts of an update and adds it to the history
+func recordUpdate(config *conf.BlockerConfig, u *Update) {
+	if u.Initial {
+		logger.Infof("blocklist loaded with %d domains", u.Domains)
+	} else {
+		logger.Infof("blocklist updated: %d domains, %d added, %d removed", u.Domains, u.Added, u.Removed)
+
+		var sources []string
+		for source := range u.Sources {
+			sources = append(sources, source)
+		}
+		sort.Strings(sources)
+		for _, source := range sources {
+			c := u.Sources[source]
+			logger.Infof("source %s: %d added, %d removed", source, c.Added, c.Removed)
+		}
+	}
+
+	updatesMu.Lock()
+	defer updatesMu.Unlock()
+
+	updateID++
+	u.ID = updateID
+	updates = append(updates, u)
+	if n := len(updates) - config.UpdateHistory; n > 0 {
+		updates = append([]*Update{}, updates[n:]...)
+	}
+}
+
+// Updates returns the retained update reports, newest first, without their
+// domain lists
+func Updates() []*Update {
+	updatesMu.RLock()
+	defer updatesMu.RUnlock()
+
+	summaries := make([]*Update, 0, len(updates))
+	for i := len(updates) - 1; i >= 0; i-- {
+		u := *updates[i]
+		u.Sources = make(map[string]*SourceChange)
+		for source, c := range updates[i].Sources {
+			u.Sources[source] = &SourceChange{Added: c.Added, Removed: c.Removed, Truncated: c.Truncated}
+		}
+		summaries = append(summaries, &u)
+	}
+
+	return summaries
+}
+
+// GetUpdate returns the update report with id
+func GetUpdate(id int) (*Update, bool) {
+	updatesMu.RLock()
+	defer updatesMu.RUnlock()
+
+	for _, u := range updates {
+		if u.ID == id {
+			return u, true
+		}
+	}
+
+	return nil, false
+}
@@ -0,0 +1,122 @@
+package blocker
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	mem "github.com/ray-g/dnsproxy/cache/memcache"
+	conf "github.com/ray-g/dnsproxy/config"
+)
+
+func TestNewUpdate(t *testing.T) {
+	old := entries{
+		"kept.example":    {"ads"},
+		"moved.example":   {"ads"},
+		"removed.example": {"ads", "tracking"},
+		"shared.example":  {"ads"},
+	}
+	new := entries{
+		"kept.example":   {"ads"},
+		"moved.example":  {"tracking"},
+		"shared.example": {"ads", "tracking"},
+		"a.example":      {"ads"},
+		"z.example":      {"ads"},
+	}
+
+	var removed []string
+	config := &conf.BlockerConfig{UpdateDiffLimit: 2}
+	u := newUpdate(config, entriesListing(old), entriesListing(new), len(new), func(domain string) {
+		removed = append(removed, domain)
+	})
+
+	if u.Initial || u.Domains != 5 || u.Added != 2 || u.Removed != 1 {
+		t.Errorf("update %+v, want 5 domains, 2 added, 1 removed", u)
+	}
+	if !reflect.DeepEqual(removed, []string{"removed.example"}) {
+		t.Errorf("removed %v", removed)
+	}
+
+	want := map[string]*SourceChange{
+		"ads": {
+			Added: 2, Removed: 2,
+			AddedDomains:   []string{"a.example", "z.example"},
+			RemovedDomains: []string{"moved.example", "removed.example"},
+		},
+		"tracking": {
+			Added: 2, Removed: 1,
+			AddedDomains:   []string{"moved.example", "shared.example"},
+			RemovedDomains: []string{"removed.example"},
+		},
+	}
+	for source, c := range u.Sources {
+		sort.Strings(c.AddedDomains)
+		sort.Strings(c.RemovedDomains)
+		if !reflect.DeepEqual(c, want[source]) {
+			t.Errorf("source %s changed %+v, want %+v", source, c, want[source])
+		}
+	}
+	if len(u.Sources) != len(want) {
+		t.Errorf("%d sources changed, want %d", len(u.Sources), len(want))
+	}
+
+	config.UpdateDiffLimit = 1
+	u = newUpdate(config, entriesListing(old), entriesListing(new), len(new), nil)
+	if c := u.Sources["ads"]; c.Added != 2 || len(c.AddedDomains) != 1 || !c.Truncated {
+		t.Errorf("truncated change %+v", c)
+	}
+
+	if u := newUpdate(config, nil, entriesListing(new), len(new), nil); !u.Initial || u.Sources != nil {
+		t.Errorf("initial update %+v", u)
+	}
+}
+
+func TestRecordUpdate(t *testing.T) {
+	config := &conf.BlockerConfig{UpdateHistory: 2}
+	for i := 0; i < 3; i++ {
+		recordUpdate(config, &Update{Domains: i, Sources: map[string]*SourceChange{
+			"ads": {Added: 1, AddedDomains: []string{"a.example"}},
+		}})
+	}
+
+	list := Updates()
+	if len(list) != 2 || list[0].Domains != 2 || list[1].Domains != 1 {
+		t.Fatalf("history %+v, want the last 2 updates newest first", list)
+	}
+	if list[0].Sources["ads"].AddedDomains != nil {
+		t.Error("summary keeps the domain lists")
+	}
+
+	u, ok := GetUpdate(list[0].ID)
+	if !ok || len(u.Sources["ads"].AddedDomains) != 1 {
+		t.Errorf("GetUpdate(%d) = %+v, %v", list[0].ID, u, ok)
+	}
+	if _, ok := GetUpdate(list[1].ID - 1); ok {
+		t.Error("dropped update still found")
+	}
+}
+
+func TestStartUpdates(t *testing.T) {
+	config := &conf.BlockerConfig{SourceDir: t.TempDir(), UpdateInterval: 1, UpdateHistory: 100}
+
+	stop := StartUpdates(config, mem.NewCache())
+	deadline := time.Now().Add(5 * time.Second)
+	for len(Updates()) == 0 || Updates()[0].Time.Before(time.Now().Add(-time.Second)) {
+		if time.Now().After(deadline) {
+			t.Fatal("no update ran")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	stop()
+	stop()
+	last := Updates()[0].ID
+
+	time.Sleep(1500 * time.Millisecond)
+	if id := Updates()[0].ID; id != last {
+		t.Errorf("update %d ran after stop, last was %d", id, last)
+	}
+
+	StartUpdates(&conf.BlockerConfig{}, mem.NewCache())()
+}
@@ -12,12 +12,17 @@ var (
 	ErrorCacheFull       = errors.New("Cache full")
 )
 
+// GlobalPrefix prefixes the keys of the answers to the clients outside of the
+// client groups, apart from the blocklist records cached under the bare names
+const GlobalPrefix = "@"
+
 // Cache interface
 type Cache interface {
 	Get(key string) (record *r.Record, err error)
 	Set(key string, record *r.Record) error
 	Exists(key string) bool
 	Remove(key string)
+	Keys() []string
 	Length() int
 	Dump() string
 }
@@ -73,6 +73,18 @@ func (c *MemoryCache) Remove(key string) {
 	delete(c.Records, key)
 }
 
+// Keys returns the keys of the cached records, in no particular order
+func (c *MemoryCache) Keys() []string {
+	c.RLock()
+	defer c.RUnlock()
+
+	keys := make([]string, 0, len(c.Records))
+	for key := range c.Records {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
 func (c *MemoryCache) Length() int {
 	c.RLock()
 	defer c.RUnlock()
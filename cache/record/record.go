@@ -11,6 +11,8 @@ import (
 type Record struct {
 	Msg      *dns.Msg
 	Blocked  bool      `json:"blocked"`
+	Sources  []string  `json:"sources,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
 	NoExpire bool      `json:"no_expire"`
 	UpdateAt time.Time `json:"update_at"`
 	ExpireAt time.Time `json:"expire_at"`
@@ -47,8 +49,27 @@ func NewCustomRecord(msg *dns.Msg, ttl time.Duration) *Record {
 	return NewRecord(msg, false, false, ttl)
 }
 
-func NewBlockedRecord() *Record {
-	return NewRecord(bMesg, true, true, 0)
+// NewBlockedRecord returns a record blocked by the named sources
+func NewBlockedRecord(sources []string) *Record {
+	record := NewRecord(bMesg, true, true, 0)
+	record.Sources = sources
+	return record
+}
+
+// Reasons of cloaked records
+const (
+	ReasonCNAME   = "cname"
+	ReasonAddress = "address"
+)
+
+// NewCloakedRecord returns a blocked record for a name whose upstream answer
+// matched source through its CNAME chain or addresses, as told by reason. It
+// expires with the answer.
+func NewCloakedRecord(source string, reason string, ttl time.Duration) *Record {
+	record := NewRecord(bMesg, true, false, ttl)
+	record.Sources = []string{source}
+	record.Reason = reason
+	return record
 }
 
 func blockedMesg() *dns.Msg {
@@ -14,8 +14,144 @@ type DNSResolverConfig struct {
 	Timeout         int      `default:"5"`
 	TTL             uint32   `default:"600"`
 	NXDomainOnBlock bool     `default:"false"`
+	BlockCNAME      bool     `default:"true"`
+	Block           BlockResponseConfig
+	Rebinding       RebindingConfig
+	SafeSearch      SafeSearchConfig
+	Rewrites        []RewriteRule
 	DoH             DoHConfig
 	Hosts           HostsFileConfig
+	Zones           []ZoneConfig
+	Records         RecordsConfig
+	Leases          LeasesConfig
+	Unqualified     UnqualifiedConfig
+	SpecialUse      SpecialUseConfig
+	Reverse         ReverseConfig
+	Groups          []ClientGroupConfig
+}
+
+// ZoneConfig is a zone file answered authoritatively, Origin defaults to the
+// owner of its SOA record
+type ZoneConfig struct {
+	Origin string
+	File   string
+}
+
+// ClientGroupConfig is the filtering policy of a group of clients.
+// Clients are IPs, CIDRs or EDNS identifiers ("mac:<address>" from option
+// 65001, "id:<cpe-id>" from option 65074). Empty Sources enables every
+// blocklist source, empty Categories enables every category but the disabled
+// ones, empty Nameservers uses the resolver ones and an unset SafeSearch
+// follows the resolver one. An unset DefaultDeny follows the blocker one, the
+// group Allowlist extends the blocker one.
+type ClientGroupConfig struct {
+	Name               string
+	Clients            []string
+	Sources            []string
+	Categories         []string
+	DisabledCategories []string
+	Whitelist          []string
+	Blocklist          []string
+	Block              BlockResponseConfig
+	Nameservers        []string
+	SafeSearch         *bool
+	DefaultDeny        *bool
+	Allowlist          []string
+}
+
+// BlockResponseConfig describes how a blocked query is answered.
+// Mode is one of null, sinkhole, nxdomain, nodata, refused or drop.
+// Empty fields are inherited from the enclosing scope.
+type BlockResponseConfig struct {
+	Mode string
+	IPv4 string
+	IPv6 string
+	TTL  uint32
+}
+
+// RecordsConfig keeps the custom records managed through the API in
+// StateFile, records without a TTL get TTL
+type RecordsConfig struct {
+	StateFile string `default:"records.json"`
+	TTL       uint32 `default:"300"`
+}
+
+// LeasesConfig resolves the hostnames of the active DHCP leases as
+// <hostname>.<Domain>. Files are dnsmasq, isc (dhcpd.leases) or kea (memfile
+// CSV) lease files, watched like the hosts files.
+type LeasesConfig struct {
+	Enable          bool   `default:"false"`
+	Domain          string `default:"lan"`
+	Files           []LeaseFileConfig
+	Watch           bool   `default:"true"`
+	ReloadDelay     uint32 `default:"500"`
+	RefreshInterval uint32 `default:"60"`
+}
+
+type LeaseFileConfig struct {
+	Format string
+	File   string
+}
+
+// UnqualifiedConfig handles single-label names, top-level domains aside.
+// They are looked up as <name>.<Domain> in the local zones, hosts files and
+// DHCP leases and answered NXDOMAIN otherwise, Forward sends them to the
+// upstream instead.
+type UnqualifiedConfig struct {
+	Domain  string `default:"lan"`
+	Forward bool   `default:"false"`
+}
+
+// SpecialUseConfig answers the special-use domains of RFC 6761 without the
+// upstream: localhost resolves to loopback, invalid and onion are NXDOMAIN,
+// test, local and home.arpa only resolve from the local sources. Rules set the
+// action of a domain and its subdomains, loopback, nxdomain, local or
+// forward.
+type SpecialUseConfig struct {
+	Enable bool `default:"true"`
+	Rules  []SpecialUseRule
+}
+
+type SpecialUseRule struct {
+	Domain string
+	Action string
+}
+
+// ReverseConfig answers PTR queries for the addresses of the hosts files,
+// local zones and DHCP leases, PrivateNXDomain answers the other RFC 1918
+// reverse names with NXDOMAIN instead of forwarding them
+type ReverseConfig struct {
+	Enable          bool `default:"true"`
+	PrivateNXDomain bool `default:"false"`
+}
+
+// RebindingConfig guards against public domains resolving to private,
+// loopback or link-local addresses. Mode is strip or reject.
+type RebindingConfig struct {
+	Enable       bool   `default:"false"`
+	Mode         string `default:"strip"`
+	AllowDomains []string
+}
+
+// SafeSearchConfig rewrites search engine and video site names to their
+// safe-search endpoints, Rules extend or override the built-in table
+type SafeSearchConfig struct {
+	Enable bool `default:"false"`
+	Rules  []SafeSearchRule
+}
+
+type SafeSearchRule struct {
+	Domain string
+	Target string
+}
+
+// RewriteRule answers Domain, or the names below it for "*.domain", with
+// Answer. An address answers the queries of its family, a name is answered as
+// a CNAME to it followed by its local or upstream answer, Answer equal to
+// Domain excludes it from the wildcards.
+type RewriteRule struct {
+	Domain string
+	Answer string
 }
 
 type DoHConfig struct {
@@ -28,9 +164,16 @@ type APIServerConfig struct {
 	BindAddr string `default:"127.0.0.1:8080"`
 }
 
+// HostsFileConfig lists the hosts files and directories, HostsFiles replaces
+// HostsFile when set. Changes are picked up through file notifications once
+// they settled for ReloadDelay milliseconds, without Watch or when watching
+// fails the files are re-read every RefreshInterval seconds.
 type HostsFileConfig struct {
 	Enable          bool   `default:"true"`
 	HostsFile       string `default:"/etc/hosts"`
+	HostsFiles      []string
+	Watch           bool   `default:"true"`
+	ReloadDelay     uint32 `default:"500"`
 	RefreshInterval uint32 `default:"900"`
 }
 
@@ -39,12 +182,71 @@ type BlockerConfig struct {
 	SourceURLs []DNSBlockSource
 	SourceDir  string `default:"sources"`
 	Blocklist  []string
+	Rules      []BlockRule
 	Whitelist  []string `default:"[\"getsentry.com\",\"www.getsentry.com\"]"`
+
+	// IndexFile is the compiled blocklist, rebuilt when the sources change.
+	// Sources are loaded into the cache when empty.
+	IndexFile string `default:""`
+
+	// SerialFile keeps the serial of the exported blocklist across restarts
+	SerialFile string `default:""`
+
+	// UpdateInterval refreshes the sources every so many seconds, 0 disables
+	// it. The last UpdateHistory updates are kept with up to UpdateDiffLimit
+	// added and removed domains per source.
+	UpdateInterval  uint32 `default:"0"`
+	UpdateHistory   int    `default:"10"`
+	UpdateDiffLimit int    `default:"10000"`
+
+	IPSourceURLs []DNSBlockSource
+	IPSourceDir  string `default:"ipsources"`
+	IPBlocklist  []string
+
+	Schedules []ScheduleConfig
+
+	DisabledCategories []string
+
+	// DefaultDeny blocks every name but those of Allowlist, entries starting
+	// with "*." allow the domain and its subdomains
+	DefaultDeny bool `default:"false"`
+	Allowlist   []string
+}
+
+// ScheduleConfig blocks Domains (and their subdomains) and restricts the
+// entries of Sources and Categories to the weekly Windows in TimeZone. Empty
+// Groups applies the schedule to every client.
+type ScheduleConfig struct {
+	Name       string
+	Domains    []string
+	Sources    []string
+	Categories []string
+	Groups     []string
+	TimeZone   string
+	Windows    []ScheduleWindow
+}
+
+// ScheduleWindow is a daily time range, Start and End are "15:04" and a
+// window ending before it starts runs past midnight. Days are mon..sun,
+// weekdays or weekend, empty means every day.
+type ScheduleWindow struct {
+	Days  []string
+	Start string
+	End   string
 }
 
+// DNSBlockSource is a blocklist to download, Categories tag its entries
+// (ads, tracking, malware, phishing, adult, gambling...)
 type DNSBlockSource struct {
-	Name string
-	URL  string
+	Name       string
+	URL        string
+	Categories []string
+	Block      BlockResponseConfig
+}
+
+type BlockRule struct {
+	Domain string
+	Block  BlockResponseConfig
 }
 
 type Config struct {
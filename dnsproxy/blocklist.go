@@ -0,0 +1,123 @@
+package dnsproxy
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ray-g/dnsproxy/blocker"
+	conf "github.com/ray-g/dnsproxy/config"
+	"github.com/ray-g/dnsproxy/logger"
+)
+
+const blocklistUsage = `usage: dnsproxy blocklist <command> [flags] <config>
+
+commands:
+  compile    compile the blocklist sources into the index file
+  export     write the effective blocklist in hosts, domains, dnsmasq,
+             unbound or rpz format
+`
+
+// Blocklist runs the blocklist subcommand with args and returns the exit code
+func Blocklist(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, blocklistUsage)
+		return 2
+	}
+
+	switch args[0] {
+	case "compile":
+		return compileBlocklist(args[1:])
+	case "export":
+		return exportBlocklist(args[1:])
+	default:
+		fmt.Fprint(os.Stderr, blocklistUsage)
+		return 2
+	}
+}
+
+func compileBlocklist(args []string) int {
+	flags := flag.NewFlagSet("compile", flag.ContinueOnError)
+	output := flags.String("o", "", "index file to write, defaults to Blocker.IndexFile")
+	fetch := flags.Bool("fetch", false, "download sources even if they exist")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: dnsproxy blocklist compile [-o index] [-fetch] <config>")
+		return 2
+	}
+
+	config, err := conf.LoadConfig(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	logger.SetOutput(os.Stderr)
+	logger.InitLogger("DNSProxy", config.DebugMode)
+
+	path := *output
+	if path == "" {
+		path = config.Blocker.IndexFile
+	}
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "no index file, set Blocker.IndexFile or use -o")
+		return 2
+	}
+
+	n, err := blocker.Compile(&config.Blocker, path, *fetch)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Printf("%d domains compiled into %s\n", n, path)
+	return 0
+}
+
+func exportBlocklist(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("f", "hosts", "format: "+strings.Join(blocker.ExportFormats(), ", "))
+	output := flags.String("o", "", "file to write, defaults to stdout")
+	fetch := flags.Bool("fetch", false, "download sources even if they exist")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: dnsproxy blocklist export [-f format] [-o file] [-fetch] <config>")
+		return 2
+	}
+
+	config, err := conf.LoadConfig(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	logger.SetOutput(os.Stderr)
+	logger.InitLogger("DNSProxy", config.DebugMode)
+
+	export, err := blocker.NewExport(&config.Blocker, *fetch)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	w := os.Stdout
+	if *output != "" {
+		if w, err = os.Create(*output); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer w.Close()
+	}
+
+	if err := export.Write(w, *format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
@@ -6,6 +6,7 @@ import (
 	mem "github.com/ray-g/dnsproxy/cache/memcache"
 	conf "github.com/ray-g/dnsproxy/config"
 	"github.com/ray-g/dnsproxy/logger"
+	"github.com/ray-g/dnsproxy/records"
 	r "github.com/ray-g/dnsproxy/resolver"
 	"github.com/ray-g/dnsproxy/stats"
 )
@@ -18,12 +19,17 @@ func Serve(filepath string) {
 
 	logger.InitLogger("DNSProxy", config.DebugMode)
 
+	if err := records.Load(&config.Resolver.Records); err != nil {
+		logger.Fatalf("Cannot load the custom records %s", err)
+	}
+
 	cache := mem.NewCache()
 	dnshandler := r.NewHandler(&config.Resolver, cache)
 	dnsserver := r.NewServer(config.DNSServer.BindAddr, dnshandler)
 	dnsserver.Run()
 
 	blocker.PerformUpdate(&config.Blocker, cache, false)
+	blocker.StartUpdates(&config.Blocker, cache)
 
 	if config.APIServer.Enable {
 		err = api.StartAPIServer(config.APIServer.BindAddr, config.DebugMode, cache)
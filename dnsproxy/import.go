@@ -0,0 +1,65 @@
+package dnsproxy
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ray-g/dnsproxy/importer"
+)
+
+// Import runs the import subcommand with args and returns the exit code
+func Import(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	output := flags.String("o", "", "config file to write, defaults to stdout")
+	hostsFile := flags.String("hosts", "", "hosts file for local records, defaults to imported.hosts next to the config")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: dnsproxy import [-o config] [-hosts file] <teleporter archive|pihole dir|gravity.db|pihole.toml|AdGuardHome.yaml>...")
+		return 2
+	}
+
+	im := &importer.Import{}
+	for _, path := range flags.Args() {
+		if err := im.File(path); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	hosts := *hostsFile
+	if hosts == "" {
+		hosts = filepath.Join(filepath.Dir(*output), "imported.hosts")
+	}
+	if hosts, err := filepath.Abs(hosts); err == nil {
+		*hostsFile = hosts
+	}
+
+	w := os.Stdout
+	if *output != "" {
+		var err error
+		if w, err = os.Create(*output); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer w.Close()
+	}
+
+	if err := im.WriteConfig(w, *hostsFile); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if len(im.Records) > 0 {
+		fmt.Fprintf(os.Stderr, "%d local records written to %s\n", len(im.Records), *hostsFile)
+	}
+	if len(im.Unmapped) > 0 {
+		fmt.Fprintf(os.Stderr, "%d settings could not be mapped:\n  %s\n", len(im.Unmapped), strings.Join(im.Unmapped, "\n  "))
+	}
+
+	return 0
+}
@@ -0,0 +1,326 @@
+// Package domainindex implements a compact, read-only index of domains and
+// the sources listing them. Domains are sorted and front-coded in blocks, so
+// an index can be memory-mapped and searched without decoding it.
+package domainindex
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Version is the version of the index format
+const Version = 1
+
+const (
+	magic      = "DPBL"
+	headerSize = 4 + 4 + FingerprintSize + 4*4
+	blockSize  = 16
+
+	// FingerprintSize is the size of the fingerprint stored in an index
+	FingerprintSize = 32
+)
+
+// ErrFormat is returned when opening a file that is not a valid index
+var ErrFormat = errors.New("invalid index format")
+
+// Fingerprint identifies the input an index was built from
+type Fingerprint [FingerprintSize]byte
+
+// Index is a memory-mapped domain index, it is safe for concurrent use
+type Index struct {
+	fingerprint Fingerprint
+	sets        [][]string
+	length      int
+	restarts    []byte
+	data        []byte
+	mapping     []byte
+}
+
+// Write builds an index of entries, mapping domains to their sources, and
+// atomically replaces the file at path with it
+func Write(path string, entries map[string][]string, fingerprint Fingerprint) error {
+	domains := make([]string, 0, len(entries))
+	for domain := range entries {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+
+	var (
+		sets     bytes.Buffer
+		restarts bytes.Buffer
+		data     bytes.Buffer
+		buf      [binary.MaxVarintLen64]byte
+	)
+
+	putUvarint := func(b *bytes.Buffer, v int) {
+		n := binary.PutUvarint(buf[:], uint64(v))
+		b.Write(buf[:n])
+	}
+
+	setIDs := make(map[string]int)
+	for i, domain := range domains {
+		sources := entries[domain]
+		key := strings.Join(sources, "\x00")
+		id, ok := setIDs[key]
+		if !ok {
+			id = len(setIDs)
+			setIDs[key] = id
+
+			putUvarint(&sets, len(sources))
+			for _, source := range sources {
+				putUvarint(&sets, len(source))
+				sets.WriteString(source)
+			}
+		}
+
+		shared := 0
+		if i%blockSize == 0 {
+			binary.LittleEndian.PutUint32(buf[:4], uint32(data.Len()))
+			restarts.Write(buf[:4])
+		} else {
+			prev := domains[i-1]
+			for shared < len(prev) && shared < len(domain) && prev[shared] == domain[shared] {
+				shared++
+			}
+		}
+
+		putUvarint(&data, shared)
+		putUvarint(&data, len(domain)-shared)
+		data.WriteString(domain[shared:])
+		putUvarint(&data, id)
+	}
+
+	header := make([]byte, headerSize)
+	copy(header, magic)
+	binary.LittleEndian.PutUint32(header[4:], Version)
+	copy(header[8:], fingerprint[:])
+	binary.LittleEndian.PutUint32(header[40:], uint32(len(setIDs)))
+	binary.LittleEndian.PutUint32(header[44:], uint32(len(domains)))
+	binary.LittleEndian.PutUint32(header[48:], uint32(sets.Len()))
+	binary.LittleEndian.PutUint32(header[52:], uint32(data.Len()))
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	for _, b := range [][]byte{header, sets.Bytes(), restarts.Bytes(), data.Bytes()} {
+		if _, err := tmp.Write(b); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Open maps the index at path into memory
+func Open(path string) (*Index, error) {
+	mapping, err := mmapFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := parse(mapping)
+	if err != nil {
+		munmap(mapping)
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	runtime.SetFinalizer(idx, (*Index).Close)
+	return idx, nil
+}
+
+func parse(b []byte) (*Index, error) {
+	if len(b) < headerSize || string(b[:4]) != magic {
+		return nil, ErrFormat
+	}
+	if v := binary.LittleEndian.Uint32(b[4:]); v != Version {
+		return nil, fmt.Errorf("unsupported index version %d", v)
+	}
+
+	idx := &Index{mapping: b}
+	copy(idx.fingerprint[:], b[8:])
+
+	nsets := int(binary.LittleEndian.Uint32(b[40:]))
+	idx.length = int(binary.LittleEndian.Uint32(b[44:]))
+	setsLen := int(binary.LittleEndian.Uint32(b[48:]))
+	dataLen := int(binary.LittleEndian.Uint32(b[52:]))
+	restartsLen := (idx.length + blockSize - 1) / blockSize * 4
+
+	if len(b) != headerSize+setsLen+restartsLen+dataLen {
+		return nil, ErrFormat
+	}
+
+	r := reader{b: b[headerSize : headerSize+setsLen]}
+	idx.sets = make([][]string, nsets)
+	for i := range idx.sets {
+		sources := make([]string, r.uvarint())
+		for j := range sources {
+			sources[j] = string(r.bytes(r.uvarint()))
+		}
+		idx.sets[i] = sources
+	}
+	if r.err {
+		return nil, ErrFormat
+	}
+
+	idx.restarts = b[headerSize+setsLen : headerSize+setsLen+restartsLen]
+	idx.data = b[headerSize+setsLen+restartsLen:]
+
+	// blocks start in order inside the data, the first one at its start
+	prev := -1
+	for i := 0; i < len(idx.restarts)/4; i++ {
+		off := idx.restart(i)
+		if off <= prev || off >= dataLen || (i == 0 && off != 0) {
+			return nil, ErrFormat
+		}
+		prev = off
+	}
+
+	return idx, nil
+}
+
+// Close unmaps the index, it must not be used afterwards
+func (idx *Index) Close() error {
+	if idx.mapping == nil {
+		return nil
+	}
+
+	runtime.SetFinalizer(idx, nil)
+	err := munmap(idx.mapping)
+	idx.mapping, idx.restarts, idx.data = nil, nil, nil
+	return err
+}
+
+// Fingerprint returns the fingerprint the index was written with
+func (idx *Index) Fingerprint() Fingerprint {
+	return idx.fingerprint
+}
+
+// Len returns the number of domains in the index
+func (idx *Index) Len() int {
+	return idx.length
+}
+
+// Lookup returns the sources listing domain
+func (idx *Index) Lookup(domain string) ([]string, bool) {
+	defer runtime.KeepAlive(idx)
+
+	blocks := len(idx.restarts) / 4
+
+	// first block whose first domain is greater than domain
+	i := sort.Search(blocks, func(i int) bool {
+		r := reader{b: idx.data[idx.restart(i):]}
+		r.uvarint()
+		return string(r.bytes(r.uvarint())) > domain
+	})
+	if i == 0 {
+		return nil, false
+	}
+
+	var (
+		r    = reader{b: idx.data[idx.restart(i-1):]}
+		buf  [256]byte
+		name = buf[:0]
+	)
+	for n := 0; n < blockSize && len(r.b) > 0; n++ {
+		shared := r.uvarint()
+		if shared > len(name) {
+			return nil, false
+		}
+		name = append(name[:shared], r.bytes(r.uvarint())...)
+		id := r.uvarint()
+		if r.err {
+			return nil, false
+		}
+
+		if string(name) == domain {
+			if id >= len(idx.sets) {
+				return nil, false
+			}
+			return idx.sets[id], true
+		}
+		if string(name) > domain {
+			return nil, false
+		}
+	}
+
+	return nil, false
+}
+
+// Each calls fn for every domain in the index in sorted order
+func (idx *Index) Each(fn func(domain string, sources []string)) {
+	defer runtime.KeepAlive(idx)
+
+	var (
+		r    = reader{b: idx.data}
+		name []byte
+	)
+	for len(r.b) > 0 {
+		shared := r.uvarint()
+		if shared > len(name) {
+			return
+		}
+		name = append(name[:shared], r.bytes(r.uvarint())...)
+		id := r.uvarint()
+		if r.err || id >= len(idx.sets) {
+			return
+		}
+		fn(string(name), idx.sets[id])
+	}
+}
+
+func (idx *Index) restart(i int) int {
+	return int(binary.LittleEndian.Uint32(idx.restarts[i*4:]))
+}
+
+// reader decodes uvarints and byte strings, it records errors instead of
+// panicking on corrupt input
+type reader struct {
+	b   []byte
+	err bool
+}
+
+func (r *reader) uvarint() int {
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		r.err = true
+		r.b = nil
+		return 0
+	}
+	r.b = r.b[n:]
+	return int(v)
+}
+
+func (r *reader) bytes(n int) []byte {
+	if n > len(r.b) {
+		r.err = true
+		r.b = nil
+		return nil
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b
+}
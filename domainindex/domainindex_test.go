@@ -0,0 +1,160 @@
+package domainindex
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func testEntries() map[string][]string {
+	entries := map[string][]string{
+		"ads.example.com":      {"ads"},
+		"ads.example.net":      {"ads", "tracking"},
+		"tracker.example.com":  {"tracking"},
+		"tracker.example.comx": {"ads"},
+		"a":                    {"ads"},
+	}
+	// more than a few blocks sharing long prefixes
+	for i := 0; i < 100; i++ {
+		entries[fmt.Sprintf("host%03d.ads.example.org", i)] = []string{"ads"}
+	}
+	return entries
+}
+
+func writeIndex(t *testing.T, entries map[string][]string) string {
+	path := filepath.Join(t.TempDir(), "index", "blocklist.idx")
+	if err := Write(path, entries, Fingerprint{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestIndex(t *testing.T) {
+	entries := testEntries()
+	idx, err := Open(writeIndex(t, entries))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	if idx.Len() != len(entries) || idx.Fingerprint() != (Fingerprint{1, 2, 3}) {
+		t.Errorf("Len() = %d, Fingerprint() = %x", idx.Len(), idx.Fingerprint())
+	}
+
+	for domain, sources := range entries {
+		if got, ok := idx.Lookup(domain); !ok || !reflect.DeepEqual(got, sources) {
+			t.Errorf("Lookup(%q) = %v, %v, want %v", domain, got, ok, sources)
+		}
+	}
+
+	for _, domain := range []string{"", "0", "aa", "ads.example", "ads.example.co", "host050.ads.example.or", "host100.ads.example.org", "tracker.example.comxx", "zzz"} {
+		if got, ok := idx.Lookup(domain); ok {
+			t.Errorf("Lookup(%q) = %v, want none", domain, got)
+		}
+	}
+
+	var domains []string
+	idx.Each(func(domain string, sources []string) {
+		domains = append(domains, domain)
+		if !reflect.DeepEqual(sources, entries[domain]) {
+			t.Errorf("Each: %s listed by %v, want %v", domain, sources, entries[domain])
+		}
+	})
+	if len(domains) != len(entries) || !sort.StringsAreSorted(domains) {
+		t.Errorf("Each visited %d domains, sorted %v", len(domains), sort.StringsAreSorted(domains))
+	}
+
+	// domains with the same sources share their set
+	if len(idx.sets) != 3 {
+		t.Errorf("%d source sets, want 3", len(idx.sets))
+	}
+}
+
+func TestIndexEmpty(t *testing.T) {
+	idx, err := Open(writeIndex(t, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	if _, ok := idx.Lookup("ads.example.com"); ok || idx.Len() != 0 {
+		t.Errorf("empty index has %d domains", idx.Len())
+	}
+	idx.Each(func(domain string, _ []string) {
+		t.Errorf("Each visited %s in an empty index", domain)
+	})
+}
+
+func TestParseCorrupt(t *testing.T) {
+	data, err := ioutil.ReadFile(writeIndex(t, testEntries()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setsLen := int(binary.LittleEndian.Uint32(data[48:]))
+	restarts := headerSize + setsLen
+
+	corrupt := func(fn func(b []byte) []byte) []byte {
+		return fn(append([]byte{}, data...))
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"short header", data[:headerSize-1]},
+		{"magic", corrupt(func(b []byte) []byte { b[0] = 'X'; return b })},
+		{"version", corrupt(func(b []byte) []byte { b[4] = 9; return b })},
+		{"truncated", data[:len(data)-1]},
+		{"trailing data", append(append([]byte{}, data...), 0)},
+		{"domain count", corrupt(func(b []byte) []byte { b[45]++; return b })},
+		{"source length", corrupt(func(b []byte) []byte { b[headerSize+1] = 0x7f; return b })},
+		{"source varint", corrupt(func(b []byte) []byte { b[headerSize] = 0xff; return b })},
+		{"set count", corrupt(func(b []byte) []byte { b[40] = 0xff; return b })},
+		{"restart offset", corrupt(func(b []byte) []byte { binary.LittleEndian.PutUint32(b[restarts+4:], 0xffffff); return b })},
+		{"restart order", corrupt(func(b []byte) []byte { binary.LittleEndian.PutUint32(b[restarts:], 5); return b })},
+	}
+
+	for _, test := range tests {
+		if _, err := parse(test.data); err == nil {
+			t.Errorf("%s: corrupt index parsed", test.name)
+		}
+	}
+}
+
+func TestLookupCorruptData(t *testing.T) {
+	data, err := ioutil.ReadFile(writeIndex(t, testEntries()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setsLen := int(binary.LittleEndian.Uint32(data[48:]))
+	start := headerSize + setsLen + len(restartsOf(t, data))
+
+	// every byte of the entries corrupted in turn must not panic
+	for i := start; i < len(data); i++ {
+		b := append([]byte{}, data...)
+		b[i] ^= 0xff
+
+		idx, err := parse(b)
+		if err != nil {
+			continue
+		}
+		idx.Lookup("host050.ads.example.org")
+		idx.Lookup("tracker.example.com")
+		idx.Each(func(string, []string) {})
+	}
+}
+
+func restartsOf(t *testing.T, data []byte) []byte {
+	idx, err := parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return idx.restarts
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd
+
+package domainindex
+
+import "io/ioutil"
+
+// mmapFile reads the whole file on platforms without mmap support
+func mmapFile(path string) ([]byte, error) {
+	return ioutil.ReadFile(path)
+}
+
+func munmap(b []byte) error {
+	return nil
+}
@@ -4,11 +4,14 @@ go 1.16
 
 require (
 	github.com/elazarl/go-bindata-assetfs v1.0.1
+	github.com/fsnotify/fsnotify v1.4.7
 	github.com/gin-contrib/cors v1.3.1
 	github.com/gin-contrib/static v0.0.1
 	github.com/gin-gonic/gin v1.7.2
 	github.com/go-srv/configreader v0.0.0-20210611231515-d34937120463
 	github.com/miekg/dns v1.1.42
 	github.com/op/go-logging v0.0.0-20160315200505-970db520ece7
+	github.com/pelletier/go-toml v1.2.0
 	golang.org/x/net v0.0.0-20210226172049-e18ecbb05110
+	gopkg.in/yaml.v2 v2.2.8
 )
@@ -2,124 +2,244 @@ package hosts
 
 import (
 	"bufio"
+	"io/ioutil"
 	"net"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
-	"golang.org/x/net/publicsuffix"
+	"github.com/miekg/dns"
 
 	conf "github.com/ray-g/dnsproxy/config"
 	"github.com/ray-g/dnsproxy/logger"
 	"github.com/ray-g/dnsproxy/utils"
+	"github.com/ray-g/dnsproxy/watcher"
 )
 
 type Hosts struct {
-	fileHosts       *FileHosts
-	refreshInterval time.Duration
+	fileHosts *FileHosts
+	watcher   *watcher.Watcher
+	changed   func(names []string)
 }
 
-func NewHosts(hs *conf.HostsFileConfig) *Hosts {
+// NewHosts loads the hosts files of hs and keeps them up to date until
+// Stop, changed is called with the names whose addresses changed on reload
+func NewHosts(hs *conf.HostsFileConfig, changed func(names []string)) *Hosts {
 	fileHosts := &FileHosts{
-		file:  hs.HostsFile,
-		hosts: make(map[string]string),
+		paths: Paths(hs),
+		hosts: make(map[string][]string),
+		index: &labelIndex{},
 	}
+	fileHosts.Refresh()
 
-	hosts := Hosts{fileHosts, time.Second * time.Duration(hs.RefreshInterval)}
-	hosts.refresh()
-	return &hosts
+	hosts := &Hosts{fileHosts: fileHosts, changed: changed}
+	hosts.watcher = watcher.New(fileHosts.paths, hs.Watch,
+		time.Millisecond*time.Duration(hs.ReloadDelay),
+		time.Second*time.Duration(hs.RefreshInterval), hosts.reload)
+
+	return hosts
 }
 
-func (h *Hosts) Get(domain string, family int) ([]net.IP, bool) {
+// Paths returns the hosts files and directories of hs, HostsFiles takes
+// precedence over HostsFile
+func Paths(hs *conf.HostsFileConfig) []string {
+	paths := hs.HostsFiles
+	if len(paths) == 0 && hs.HostsFile != "" {
+		paths = []string{hs.HostsFile}
+	}
 
-	var sips []string
-	var ip net.IP
-	var ips []net.IP
+	cleaned := make([]string, len(paths))
+	for i, path := range paths {
+		cleaned[i] = filepath.Clean(path)
+	}
+	return cleaned
+}
 
-	sips, _ = h.fileHosts.Get(domain)
+// Stop ends watching the hosts files, the loaded records are kept
+func (h *Hosts) Stop() {
+	h.watcher.Stop()
+}
 
-	if sips == nil {
+// Get returns the addresses of domain in family, ok is set for every name of
+// the hosts files, also when it has no address of that family
+func (h *Hosts) Get(domain string, family int) ([]net.IP, bool) {
+	sips, ok := h.fileHosts.Get(domain)
+	if !ok {
 		return nil, false
 	}
 
+	var ips []net.IP
 	for _, sip := range sips {
+		ip := net.ParseIP(sip)
 		switch family {
 		case utils.IPv4Query:
-			ip = net.ParseIP(sip).To4()
+			ip = ip.To4()
 		case utils.IPv6Query:
-			ip = net.ParseIP(sip).To16()
+			if ip.To4() != nil {
+				ip = nil
+			}
 		default:
-			continue
+			ip = nil
 		}
 		if ip != nil {
 			ips = append(ips, ip)
 		}
 	}
 
-	return ips, (ips != nil)
+	return ips, true
 }
 
-/*
-Update hosts records from /etc/hosts file and redis per minute
-*/
-func (h *Hosts) refresh() {
-	ticker := time.NewTicker(h.refreshInterval)
-	go func() {
-		for {
-			h.fileHosts.Refresh()
-			<-ticker.C
-		}
-	}()
+// Reverse returns the names of the address of the reverse name arpa, as
+// "4.3.2.1.in-addr.arpa."
+func (h *Hosts) Reverse(arpa string) ([]string, bool) {
+	return h.fileHosts.Reverse(arpa)
+}
+
+func (h *Hosts) reload() {
+	names := h.fileHosts.Refresh()
+	if len(names) > 0 && h.changed != nil {
+		h.changed(names)
+	}
 }
 
 type FileHosts struct {
-	file  string
-	hosts map[string]string
-	mu    sync.RWMutex
+	paths   []string
+	hosts   map[string][]string
+	index   *labelIndex
+	reverse map[string][]string
+	mu      sync.RWMutex
 }
 
 func (f *FileHosts) Get(domain string) ([]string, bool) {
 	f.mu.RLock()
 	defer f.mu.RUnlock()
-	domain = strings.ToLower(domain)
-	ip, ok := f.hosts[domain]
-	if ok {
-		return []string{ip}, true
+
+	return f.index.lookup(strings.ToLower(utils.UnFqdn(domain)))
+}
+
+func (f *FileHosts) Reverse(arpa string) ([]string, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	names, ok := f.reverse[strings.ToLower(arpa)]
+	return names, ok
+}
+
+// reverseNames maps the reverse names of the addresses to their names,
+// wildcards have no reverse
+func reverseNames(hosts map[string][]string) map[string][]string {
+	domains := make([]string, 0, len(hosts))
+	for domain := range hosts {
+		if !strings.HasPrefix(domain, "*.") {
+			domains = append(domains, domain)
+		}
 	}
+	sort.Strings(domains)
 
-	sld, err := publicsuffix.EffectiveTLDPlusOne(domain)
-	if err != nil {
-		return nil, false
+	reverse := make(map[string][]string)
+	for _, domain := range domains {
+		for _, ip := range hosts[domain] {
+			if arpa, err := dns.ReverseAddr(ip); err == nil {
+				reverse[arpa] = append(reverse[arpa], domain)
+			}
+		}
 	}
+	return reverse
+}
+
+// Refresh reads the hosts files, the addresses of a name in a later file
+// replace the ones of the earlier files and the files of a directory are read
+// in name order. The names whose addresses changed are returned.
+func (f *FileHosts) Refresh() []string {
+	hosts := make(map[string][]string)
+	read := 0
+
+	for _, path := range f.paths {
+		files := []string{path}
 
-	for host, ip := range f.hosts {
-		if strings.HasPrefix(host, "*.") {
-			old, err := publicsuffix.EffectiveTLDPlusOne(host)
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			entries, err := ioutil.ReadDir(path)
 			if err != nil {
+				logger.Warningf("Update hosts records from directory failed %s", err)
 				continue
 			}
-			if sld == old {
-				return []string{ip}, true
+			read++
+
+			files = files[:0]
+			for _, entry := range entries {
+				if !entry.IsDir() && !watcher.Ignored(entry.Name()) {
+					files = append(files, filepath.Join(path, entry.Name()))
+				}
+			}
+		}
+
+		for _, file := range files {
+			addrs, err := parseFile(file)
+			if err != nil {
+				logger.Warningf("Update hosts records from file failed %s", err)
+				continue
+			}
+			read++
+
+			for domain, ips := range addrs {
+				hosts[domain] = ips
 			}
 		}
 	}
 
-	return nil, false
+	// keep the records while every file is unreadable
+	if read == 0 && len(f.paths) > 0 {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var changed []string
+	for domain, ips := range hosts {
+		if !equal(f.hosts[domain], ips) {
+			changed = append(changed, domain)
+		}
+	}
+	for domain := range f.hosts {
+		if _, ok := hosts[domain]; !ok {
+			changed = append(changed, domain)
+		}
+	}
+
+	f.hosts = hosts
+	f.index = newLabelIndex(hosts)
+	f.reverse = reverseNames(hosts)
+	logger.Debugf("update hosts records from %s, total %d records.", strings.Join(f.paths, ", "), len(f.hosts))
+
+	return changed
+}
+
+func equal(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
 }
 
-func (f *FileHosts) Refresh() {
-	buf, err := os.Open(f.file)
+// parseFile returns the addresses of every name of a hosts file, in the order
+// of their lines
+func parseFile(file string) (map[string][]string, error) {
+	buf, err := os.Open(file)
 	if err != nil {
-		logger.Warn("Update hosts records from file failed %s", err)
-		return
+		return nil, err
 	}
 	defer buf.Close()
 
-	f.mu.Lock()
-	defer f.mu.Unlock()
-
-	f.clear()
+	hosts := make(map[string][]string)
 
 	scanner := bufio.NewScanner(buf)
 	for scanner.Scan() {
@@ -152,12 +272,21 @@ func (f *FileHosts) Refresh() {
 				continue
 			}
 
-			f.hosts[strings.ToLower(domain)] = ip
+			domain = strings.ToLower(utils.UnFqdn(domain))
+			if !contains(hosts[domain], ip) {
+				hosts[domain] = append(hosts[domain], ip)
+			}
 		}
 	}
-	logger.Debug("update hosts records from %s, total %d records.", f.file, len(f.hosts))
+
+	return hosts, scanner.Err()
 }
 
-func (f *FileHosts) clear() {
-	f.hosts = make(map[string]string)
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,150 @@
+package hosts
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	conf "github.com/ray-g/dnsproxy/config"
+	"github.com/ray-g/dnsproxy/logger"
+	"github.com/ray-g/dnsproxy/utils"
+)
+
+func TestMain(m *testing.M) {
+	logger.SetOutput(ioutil.Discard)
+	logger.InitLogger("hosts", false)
+	os.Exit(m.Run())
+}
+
+func writeFile(t *testing.T, file string, content string) {
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPaths(t *testing.T) {
+	tests := []struct {
+		config conf.HostsFileConfig
+		paths  []string
+	}{
+		{conf.HostsFileConfig{HostsFile: "/etc/hosts"}, []string{"/etc/hosts"}},
+		{conf.HostsFileConfig{HostsFile: "/etc/hosts", HostsFiles: []string{"/etc/hosts.d/", "lan//hosts"}}, []string{"/etc/hosts.d", "lan/hosts"}},
+		{conf.HostsFileConfig{}, []string{}},
+	}
+
+	for _, test := range tests {
+		if paths := Paths(&test.config); !reflect.DeepEqual(paths, test.paths) {
+			t.Errorf("Paths(%+v) = %v, want %v", test.config, paths, test.paths)
+		}
+	}
+}
+
+func TestFileHostsPaths(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "hosts.d")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, filepath.Join(root, "hosts"), "192.0.2.1 router.lan nas.lan\n")
+	writeFile(t, filepath.Join(dir, "10-lan"), "192.0.2.2 nas.lan\n192.0.2.3 printer.lan\n")
+	writeFile(t, filepath.Join(dir, "20-lan"), "192.0.2.4 printer.lan\n")
+	writeFile(t, filepath.Join(dir, "30-lan.swp"), "192.0.2.5 router.lan\n")
+	writeFile(t, filepath.Join(dir, ".hidden"), "192.0.2.6 router.lan\n")
+
+	f := &FileHosts{
+		paths: []string{filepath.Join(root, "hosts"), dir, filepath.Join(root, "missing")},
+		hosts: make(map[string][]string),
+		index: &labelIndex{},
+	}
+	f.Refresh()
+
+	tests := []struct {
+		name string
+		ips  []string
+	}{
+		{"router.lan", []string{"192.0.2.1"}},
+		{"nas.lan", []string{"192.0.2.2"}},
+		{"printer.lan", []string{"192.0.2.4"}},
+	}
+
+	for _, test := range tests {
+		if ips, ok := f.Get(test.name); !ok || !reflect.DeepEqual(ips, test.ips) {
+			t.Errorf("Get(%s) = %v, %v, want %v", test.name, ips, ok, test.ips)
+		}
+	}
+
+	// the records are kept while every file is unreadable
+	f.paths = []string{filepath.Join(root, "missing")}
+	if changed := f.Refresh(); changed != nil {
+		t.Errorf("changed = %v without a readable file", changed)
+	}
+	if _, ok := f.Get("router.lan"); !ok {
+		t.Error("records dropped without a readable file")
+	}
+}
+
+func TestHostsReload(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "hosts")
+	writeFile(t, file, "192.0.2.1 router.lan\n")
+
+	changes := make(chan []string, 1)
+	h := NewHosts(&conf.HostsFileConfig{HostsFiles: []string{dir}, Watch: true, ReloadDelay: 50}, func(names []string) {
+		sort.Strings(names)
+		changes <- names
+	})
+	defer h.Stop()
+
+	writeFile(t, filepath.Join(dir, "lan"), "192.0.2.2 nas.lan\n192.0.2.3 router.lan\n")
+
+	select {
+	case names := <-changes:
+		if want := []string{"nas.lan", "router.lan"}; !reflect.DeepEqual(names, want) {
+			t.Errorf("changed = %v, want %v", names, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no reload after adding a file to the directory")
+	}
+
+	if ips, ok := h.fileHosts.Get("router.lan"); !ok || !reflect.DeepEqual(ips, []string{"192.0.2.3"}) {
+		t.Errorf("Get(router.lan) = %v, %v after reload", ips, ok)
+	}
+}
+
+func TestHostsGet(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "hosts")
+	writeFile(t, file, "192.0.2.1 router.lan\n2001:db8::1 router.lan\n192.0.2.2 router.lan\n192.0.2.1 router.lan\n192.0.2.3 v4.lan\n2001:db8::2 v6.lan\n")
+
+	h := NewHosts(&conf.HostsFileConfig{HostsFiles: []string{file}}, nil)
+	defer h.Stop()
+
+	tests := []struct {
+		name   string
+		family int
+		ips    []string
+		ok     bool
+	}{
+		{"router.lan", utils.IPv4Query, []string{"192.0.2.1", "192.0.2.2"}, true},
+		{"router.lan", utils.IPv6Query, []string{"2001:db8::1"}, true},
+		{"v4.lan", utils.IPv6Query, nil, true},
+		{"v6.lan", utils.IPv4Query, nil, true},
+		{"v6.lan", utils.IPv6Query, []string{"2001:db8::2"}, true},
+		{"other.lan", utils.IPv4Query, nil, false},
+	}
+
+	for _, test := range tests {
+		ips, ok := h.Get(test.name, test.family)
+		var got []string
+		for _, ip := range ips {
+			got = append(got, ip.String())
+		}
+		if ok != test.ok || !reflect.DeepEqual(got, test.ips) {
+			t.Errorf("Get(%s, %d) = %v, %v, want %v, %v", test.name, test.family, got, ok, test.ips, test.ok)
+		}
+	}
+}
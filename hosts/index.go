@@ -0,0 +1,79 @@
+package hosts
+
+import "strings"
+
+// labelIndex maps names to their addresses by labels from the root, a lookup
+// visits one node per label of the name. "*.sub.domain" entries match every
+// name below sub.domain but not sub.domain itself, an exact entry takes
+// precedence over the wildcards and the deepest wildcard over the others.
+type labelIndex struct {
+	children map[string]*labelIndex
+	ips      []string
+	wildcard []string
+}
+
+func newLabelIndex(hosts map[string][]string) *labelIndex {
+	index := &labelIndex{}
+	for name, ips := range hosts {
+		index.insert(name, ips)
+	}
+	return index
+}
+
+func (n *labelIndex) insert(name string, ips []string) {
+	wildcard := strings.HasPrefix(name, "*.")
+	if wildcard {
+		name = name[2:]
+	}
+
+	node := n
+	labels := strings.Split(name, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		child, ok := node.children[labels[i]]
+		if !ok {
+			if node.children == nil {
+				node.children = make(map[string]*labelIndex)
+			}
+			child = &labelIndex{}
+			node.children[labels[i]] = child
+		}
+		node = child
+	}
+
+	if wildcard {
+		node.wildcard = ips
+	} else {
+		node.ips = ips
+	}
+}
+
+// lookup returns the addresses of the most specific entry matching name
+func (n *labelIndex) lookup(name string) ([]string, bool) {
+	var match []string
+
+	node := n
+	for end := len(name); ; {
+		start := strings.LastIndexByte(name[:end], '.') + 1
+
+		// the wildcard of a parent covers the remaining labels
+		if node.wildcard != nil {
+			match = node.wildcard
+		}
+
+		child, ok := node.children[name[start:end]]
+		if !ok {
+			return match, match != nil
+		}
+		node = child
+
+		if start == 0 {
+			break
+		}
+		end = start - 1
+	}
+
+	if node.ips != nil {
+		return node.ips, true
+	}
+	return match, match != nil
+}
@@ -0,0 +1,94 @@
+package hosts
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestLabelIndex(t *testing.T) {
+	index := newLabelIndex(map[string][]string{
+		"*.example":         {"192.0.2.1"},
+		"exact.example":     {"192.0.2.2"},
+		"*.sub.example":     {"192.0.2.3"},
+		"*.co.uk":           {"192.0.2.4"},
+		"shop.co.uk":        {"192.0.2.5"},
+		"a.b.deep.example":  {"192.0.2.6"},
+		"*.b.deep.example":  {"192.0.2.7"},
+		"noaddress.example": {},
+	})
+
+	tests := []struct {
+		name string
+		ips  []string
+		ok   bool
+	}{
+		{"www.example", []string{"192.0.2.1"}, true},
+		{"a.b.c.example", []string{"192.0.2.1"}, true},
+		{"example", nil, false},
+		{"exact.example", []string{"192.0.2.2"}, true},
+		{"www.exact.example", []string{"192.0.2.1"}, true},
+		{"sub.example", []string{"192.0.2.1"}, true},
+		{"www.sub.example", []string{"192.0.2.3"}, true},
+		{"a.www.sub.example", []string{"192.0.2.3"}, true},
+		{"a.b.deep.example", []string{"192.0.2.6"}, true},
+		{"c.b.deep.example", []string{"192.0.2.7"}, true},
+		{"b.deep.example", []string{"192.0.2.1"}, true},
+		{"noaddress.example", []string{}, true},
+		{"bbc.co.uk", []string{"192.0.2.4"}, true},
+		{"shop.co.uk", []string{"192.0.2.5"}, true},
+		{"www.shop.co.uk", []string{"192.0.2.4"}, true},
+		{"co.uk", nil, false},
+		{"uk", nil, false},
+		{"example.org", nil, false},
+		{"wwwexample", nil, false},
+		{"", nil, false},
+	}
+
+	for _, test := range tests {
+		ips, ok := index.lookup(test.name)
+		if ok != test.ok || !reflect.DeepEqual(ips, test.ips) {
+			t.Errorf("lookup(%q) = %v, %v, want %v, %v", test.name, ips, ok, test.ips, test.ok)
+		}
+	}
+}
+
+func TestFileHostsRefresh(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "hosts")
+	write := func(content string) {
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("192.0.2.1 Router.LAN. *.Apps.LAN\n192.0.2.2 nas.lan\n")
+	f := &FileHosts{paths: []string{file}, hosts: make(map[string][]string), index: &labelIndex{}}
+	f.Refresh()
+
+	for _, name := range []string{"router.lan", "ROUTER.lan", "router.lan.", "web.apps.lan", "Web.APPS.lan."} {
+		if ips, ok := f.Get(name); !ok || !reflect.DeepEqual(ips, []string{"192.0.2.1"}) {
+			t.Errorf("Get(%q) = %v, %v", name, ips, ok)
+		}
+	}
+	if _, ok := f.Get("apps.lan"); ok {
+		t.Error("wildcard matched its apex apps.lan")
+	}
+
+	write("192.0.2.3 nas.lan\n")
+	changed := f.Refresh()
+	sort.Strings(changed)
+	if want := []string{"*.apps.lan", "nas.lan", "router.lan"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed = %v, want %v", changed, want)
+	}
+
+	for _, name := range []string{"router.lan", "web.apps.lan"} {
+		if ips, ok := f.Get(name); ok {
+			t.Errorf("removed %s still resolves to %v", name, ips)
+		}
+	}
+	if ips, ok := f.Get("nas.lan"); !ok || !reflect.DeepEqual(ips, []string{"192.0.2.3"}) {
+		t.Errorf("Get(nas.lan) = %v, %v after reload", ips, ok)
+	}
+}
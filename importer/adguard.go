@@ -0,0 +1,339 @@
+package importer
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// adGuardFiltering holds the filtering settings, found in the dns section of
+// older AdGuard Home configs and in the filtering section of newer ones
+type adGuardFiltering struct {
+	ProtectionEnabled   *bool            `yaml:"protection_enabled"`
+	FilteringEnabled    *bool            `yaml:"filtering_enabled"`
+	BlockingMode        string           `yaml:"blocking_mode"`
+	BlockingIPv4        string           `yaml:"blocking_ipv4"`
+	BlockingIPv6        string           `yaml:"blocking_ipv6"`
+	BlockedResponseTTL  uint32           `yaml:"blocked_response_ttl"`
+	SafeSearchEnabled   *bool            `yaml:"safesearch_enabled"`
+	SafeSearch          *adGuardSwitch   `yaml:"safe_search"`
+	ParentalEnabled     bool             `yaml:"parental_enabled"`
+	SafeBrowsingEnabled bool             `yaml:"safebrowsing_enabled"`
+	BlockedServices     interface{}      `yaml:"blocked_services"`
+	Rewrites            []adGuardRewrite `yaml:"rewrites"`
+}
+
+type adGuardSwitch struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+type adGuardRewrite struct {
+	Domain string `yaml:"domain"`
+	Answer string `yaml:"answer"`
+}
+
+type adGuardFilter struct {
+	Enabled bool   `yaml:"enabled"`
+	URL     string `yaml:"url"`
+	Name    string `yaml:"name"`
+	ID      int64  `yaml:"id"`
+}
+
+type adGuardClient struct {
+	Name              string         `yaml:"name"`
+	IDs               []string       `yaml:"ids"`
+	UseGlobalSettings bool           `yaml:"use_global_settings"`
+	FilteringEnabled  bool           `yaml:"filtering_enabled"`
+	SafeSearchEnabled *bool          `yaml:"safesearch_enabled"`
+	SafeSearch        *adGuardSwitch `yaml:"safe_search"`
+	Upstreams         []string       `yaml:"upstreams"`
+	UseGlobalServices *bool          `yaml:"use_global_blocked_services"`
+	BlockedServices   interface{}    `yaml:"blocked_services"`
+}
+
+type adGuardConfig struct {
+	DNS struct {
+		BindHosts       []string `yaml:"bind_hosts"`
+		BindHost        string   `yaml:"bind_host"`
+		Port            int      `yaml:"port"`
+		UpstreamDNS     []string `yaml:"upstream_dns"`
+		UpstreamDNSFile string   `yaml:"upstream_dns_file"`
+
+		adGuardFiltering `yaml:",inline"`
+	} `yaml:"dns"`
+	Filtering        *adGuardFiltering `yaml:"filtering"`
+	Filters          []adGuardFilter   `yaml:"filters"`
+	WhitelistFilters []adGuardFilter   `yaml:"whitelist_filters"`
+	UserRules        []string          `yaml:"user_rules"`
+	Clients          struct {
+		Persistent []adGuardClient `yaml:"persistent"`
+	} `yaml:"clients"`
+	DHCP struct {
+		Enabled bool `yaml:"enabled"`
+	} `yaml:"dhcp"`
+}
+
+// safeSearch returns the safe-search setting of the old or new layout
+func safeSearch(enabled *bool, s *adGuardSwitch) *bool {
+	if s != nil {
+		return &s.Enabled
+	}
+	return enabled
+}
+
+// blockedServices returns the ids of a blocked_services setting, a list in
+// older configs and a map with ids in newer ones
+func blockedServices(v interface{}) []string {
+	var ids []interface{}
+	switch b := v.(type) {
+	case []interface{}:
+		ids = b
+	case map[interface{}]interface{}:
+		ids, _ = b["ids"].([]interface{})
+	}
+
+	var services []string
+	for _, id := range ids {
+		services = append(services, fmt.Sprint(id))
+	}
+	return services
+}
+
+// adGuard imports an AdGuard Home YAML config
+func (im *Import) adGuard(data []byte) error {
+	var sections map[string]interface{}
+	if err := yaml.Unmarshal(data, &sections); err != nil {
+		return err
+	}
+	if _, ok := sections["dns"]; !ok {
+		return fmt.Errorf("no AdGuard Home configuration found")
+	}
+
+	var config adGuardConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return err
+	}
+
+	filtering := config.DNS.adGuardFiltering
+	if config.Filtering != nil {
+		filtering = *config.Filtering
+	}
+
+	host := config.DNS.BindHost
+	if len(config.DNS.BindHosts) > 0 {
+		host = config.DNS.BindHosts[0]
+		if len(config.DNS.BindHosts) > 1 {
+			im.unmapped("AdGuard bind hosts %s, dnsproxy binds one address", strings.Join(config.DNS.BindHosts[1:], ", "))
+		}
+	}
+	if host != "" || config.DNS.Port != 0 {
+		if host == "" {
+			host = "0.0.0.0"
+		}
+		port := config.DNS.Port
+		if port == 0 {
+			port = 53
+		}
+		im.Config.DNSServer = &DNSServer{BindAddr: net.JoinHostPort(host, fmt.Sprint(port))}
+	}
+
+	for _, upstream := range config.DNS.UpstreamDNS {
+		im.adGuardUpstream(upstream, &im.Config.Resolver.Nameservers)
+	}
+	if config.DNS.UpstreamDNSFile != "" {
+		im.unmapped("AdGuard upstream file %s, list its upstreams in Resolver.Nameservers", config.DNS.UpstreamDNSFile)
+	}
+
+	if (filtering.ProtectionEnabled != nil && !*filtering.ProtectionEnabled) ||
+		(filtering.FilteringEnabled != nil && !*filtering.FilteringEnabled) {
+		im.unmapped("AdGuard protection is disabled, dnsproxy always blocks; pause it with PUT /application/blocking")
+	}
+
+	im.adGuardBlocking(&filtering)
+
+	if enabled := safeSearch(filtering.SafeSearchEnabled, filtering.SafeSearch); enabled != nil && *enabled {
+		im.Config.Resolver.SafeSearch = &SafeSearch{Enable: true}
+	}
+	if filtering.ParentalEnabled {
+		im.unmapped("AdGuard parental control, use a blocklist source with adult content instead")
+	}
+	if filtering.SafeBrowsingEnabled {
+		im.unmapped("AdGuard safe browsing, use a blocklist source with malware and phishing domains instead")
+	}
+	if services := blockedServices(filtering.BlockedServices); len(services) > 0 {
+		im.unmapped("AdGuard blocked services %s, blocked services are not supported", strings.Join(services, ", "))
+	}
+
+	// an answer of A or AAAA keeps the upstream answers of that type
+	for _, rewrite := range filtering.Rewrites {
+		switch {
+		case rewrite.Answer == "A" || rewrite.Answer == "AAAA":
+			im.unmapped("AdGuard rewrite %s to %s, keeping the upstream answers of a type is not supported", rewrite.Domain, rewrite.Answer)
+		case !im.addRewrite(rewrite.Domain, rewrite.Answer):
+			im.unmapped("AdGuard rewrite %s to %s, the answer is invalid or conflicts with another rewrite", rewrite.Domain, rewrite.Answer)
+		}
+	}
+
+	adblock := false
+	for _, filter := range config.Filters {
+		if !filter.Enabled {
+			im.unmapped("AdGuard filter %s is disabled, not imported", filter.URL)
+			continue
+		}
+		im.addSource(sourceName(filter.Name, fmt.Sprintf("filter-%d", filter.ID)), filter.URL)
+		adblock = true
+	}
+	if adblock {
+		im.unmapped("AdGuard filters in adblock syntax (||domain^) are not understood by the blocker, use their hosts or domain list variants")
+	}
+
+	for _, filter := range config.WhitelistFilters {
+		im.unmapped("AdGuard allowlist %s, allowlist sources are not supported", filter.URL)
+	}
+
+	subdomains := 0
+	for _, rule := range config.UserRules {
+		subdomains += im.adGuardRule(rule)
+	}
+	if subdomains > 0 {
+		im.unmapped("%d AdGuard rules matching subdomains (||domain^) were imported as exact domains", subdomains)
+	}
+
+	for _, client := range config.Clients.Persistent {
+		im.adGuardClient(&client)
+	}
+
+	if config.DHCP.Enabled {
+		im.unmapped("AdGuard DHCP server, DHCP is not supported")
+	}
+
+	return nil
+}
+
+func (im *Import) adGuardBlocking(filtering *adGuardFiltering) {
+	var block *Block
+
+	switch filtering.BlockingMode {
+	case "", "default":
+	case "null_ip":
+		block = &Block{Mode: "null"}
+	case "nxdomain":
+		block = &Block{Mode: "nxdomain"}
+	case "refused":
+		block = &Block{Mode: "refused"}
+	case "custom_ip":
+		block = &Block{Mode: "sinkhole", IPv4: filtering.BlockingIPv4, IPv6: filtering.BlockingIPv6}
+	default:
+		im.unmapped("AdGuard blocking mode %s is not supported", filtering.BlockingMode)
+	}
+
+	if filtering.BlockedResponseTTL != 0 {
+		if block == nil {
+			block = &Block{}
+		}
+		block.TTL = filtering.BlockedResponseTTL
+	}
+
+	if block != nil {
+		im.Config.Resolver.Block = block
+	}
+}
+
+// adGuardUpstream maps plain DNS upstreams to nameservers and the first DoH
+// one to the DoH endpoint
+func (im *Import) adGuardUpstream(upstream string, nameservers *[]string) {
+	upstream = strings.TrimSpace(upstream)
+
+	switch {
+	case upstream == "" || strings.HasPrefix(upstream, "#"):
+	case strings.HasPrefix(upstream, "[/"):
+		im.unmapped("AdGuard upstream %s for specific domains, domain-specific upstreams are not supported", upstream)
+	case strings.HasPrefix(upstream, "https://"):
+		if im.Config.Resolver.DoH == nil && nameservers == &im.Config.Resolver.Nameservers {
+			im.Config.Resolver.DoH = &DoH{Enable: true, Endpoint: upstream}
+		} else {
+			im.unmapped("AdGuard DoH upstream %s, dnsproxy uses a single DoH endpoint", upstream)
+		}
+	default:
+		addr := strings.TrimPrefix(strings.TrimPrefix(upstream, "udp://"), "tcp://")
+		if ns, ok := nameserver(addr); ok {
+			*nameservers = appendUnique(*nameservers, ns)
+		} else {
+			im.unmapped("AdGuard upstream %s, only plain DNS and DoH upstreams are supported", upstream)
+		}
+	}
+}
+
+// adGuardRule imports a user rule, it returns 1 when a rule that also
+// matches subdomains was imported as an exact domain
+func (im *Import) adGuardRule(rule string) int {
+	rule = strings.TrimSpace(rule)
+	if rule == "" || strings.HasPrefix(rule, "!") || strings.HasPrefix(rule, "#") {
+		return 0
+	}
+
+	allow := strings.HasPrefix(rule, "@@")
+	pattern := strings.TrimPrefix(rule, "@@")
+
+	subdomains := 0
+	if strings.HasPrefix(pattern, "||") && strings.HasSuffix(pattern, "^") {
+		pattern = pattern[2 : len(pattern)-1]
+		subdomains = 1
+	} else if fields := strings.Fields(pattern); len(fields) == 2 && net.ParseIP(fields[0]) != nil && !allow {
+		pattern = fields[1]
+	}
+
+	if strings.ContainsAny(pattern, "|^$*/ ") || !strings.Contains(pattern, ".") {
+		im.unmapped("AdGuard rule %s, only domain rules are supported", rule)
+		return 0
+	}
+
+	if allow {
+		im.Config.Blocker.Whitelist = appendUnique(im.Config.Blocker.Whitelist, pattern)
+	} else {
+		im.Config.Blocker.Blocklist = appendUnique(im.Config.Blocker.Blocklist, pattern)
+	}
+	return subdomains
+}
+
+func (im *Import) adGuardClient(client *adGuardClient) {
+	g := Group{Name: sourceName(client.Name, "client")}
+
+	for _, id := range client.IDs {
+		if c, ok := clientID(id); ok {
+			g.Clients = append(g.Clients, c)
+		} else {
+			im.unmapped("AdGuard client %s identifier %s is not an IP, CIDR or MAC address", client.Name, id)
+		}
+	}
+	if len(g.Clients) == 0 {
+		im.unmapped("AdGuard client %s has no usable identifier, not imported", client.Name)
+		return
+	}
+
+	for _, upstream := range client.Upstreams {
+		im.adGuardUpstream(upstream, &g.Nameservers)
+	}
+
+	if !client.UseGlobalSettings {
+		enabled := safeSearch(client.SafeSearchEnabled, client.SafeSearch)
+		if enabled == nil {
+			enabled = new(bool)
+		}
+		g.SafeSearch = enabled
+
+		if !client.FilteringEnabled {
+			im.unmapped("AdGuard client %s has filtering disabled, dnsproxy groups always filter", client.Name)
+		}
+	}
+
+	if client.UseGlobalServices != nil && !*client.UseGlobalServices {
+		if services := blockedServices(client.BlockedServices); len(services) > 0 {
+			im.unmapped("AdGuard client %s blocked services %s, blocked services are not supported", client.Name, strings.Join(services, ", "))
+		}
+	}
+
+	im.Config.Resolver.Groups = append(im.Config.Resolver.Groups, g)
+}
@@ -0,0 +1,411 @@
+// Package importer translates Pi-hole and AdGuard Home configurations into a
+// dnsproxy config, reporting the settings it could not map.
+package importer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the part of a dnsproxy config an import produces, it marshals to
+// the layout of dnsproxy.yaml
+type Config struct {
+	DNSServer *DNSServer `yaml:"DNSServer,omitempty"`
+	Resolver  Resolver   `yaml:"Resolver"`
+	Blocker   Blocker    `yaml:"Blocker"`
+}
+
+type DNSServer struct {
+	BindAddr string `yaml:"BindAddr"`
+}
+
+type Resolver struct {
+	Nameservers []string    `yaml:"Nameservers,omitempty"`
+	Block       *Block      `yaml:"Block,omitempty"`
+	SafeSearch  *SafeSearch `yaml:"SafeSearch,omitempty"`
+	DoH         *DoH        `yaml:"DoH,omitempty"`
+	Hosts       *Hosts      `yaml:"Hosts,omitempty"`
+	Rewrites    []Rewrite   `yaml:"Rewrites,omitempty"`
+	Groups      []Group     `yaml:"Groups,omitempty"`
+}
+
+type Block struct {
+	Mode string `yaml:"Mode,omitempty"`
+	IPv4 string `yaml:"IPv4,omitempty"`
+	IPv6 string `yaml:"IPv6,omitempty"`
+	TTL  uint32 `yaml:"TTL,omitempty"`
+}
+
+type SafeSearch struct {
+	Enable bool `yaml:"Enable"`
+}
+
+type DoH struct {
+	Enable   bool   `yaml:"Enable"`
+	Endpoint string `yaml:"Endpoint"`
+}
+
+type Hosts struct {
+	Enable    bool   `yaml:"Enable"`
+	HostsFile string `yaml:"HostsFile"`
+}
+
+// Rewrite answers Domain, or the names below it for "*.domain", with the
+// address or name Answer
+type Rewrite struct {
+	Domain string `yaml:"Domain"`
+	Answer string `yaml:"Answer"`
+}
+
+type Group struct {
+	Name        string   `yaml:"Name"`
+	Clients     []string `yaml:"Clients,omitempty"`
+	Sources     []string `yaml:"Sources,omitempty"`
+	Whitelist   []string `yaml:"Whitelist,omitempty"`
+	Blocklist   []string `yaml:"Blocklist,omitempty"`
+	Nameservers []string `yaml:"Nameservers,omitempty"`
+	SafeSearch  *bool    `yaml:"SafeSearch,omitempty"`
+}
+
+type Blocker struct {
+	SourceURLs []Source `yaml:"SourceURLs,omitempty"`
+	Blocklist  []string `yaml:"Blocklist,omitempty"`
+	Whitelist  []string `yaml:"Whitelist,omitempty"`
+}
+
+type Source struct {
+	Name string `yaml:"Name"`
+	URL  string `yaml:"URL"`
+}
+
+// Record is a local address record
+type Record struct {
+	IP   string
+	Name string
+}
+
+// Import collects the settings of one or more imported configurations
+type Import struct {
+	Config  Config
+	Records []Record
+
+	// Unmapped describes every setting that could not be translated
+	Unmapped []string
+}
+
+func (im *Import) unmapped(format string, args ...interface{}) {
+	im.Unmapped = append(im.Unmapped, fmt.Sprintf(format, args...))
+}
+
+// File imports a Pi-hole teleporter archive (tar.gz or zip), a Pi-hole
+// directory, gravity database or pihole.toml, or an AdGuard Home YAML
+func (im *Import) File(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		files, err := readDir(path)
+		if err != nil {
+			return err
+		}
+		return im.pihole(files)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		files, err := readTarGz(data)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		return im.pihole(files)
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		files, err := readZip(data)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		return im.pihole(files)
+	case bytes.HasPrefix(data, []byte("SQLite format 3\x00")):
+		return im.pihole(map[string][]byte{"gravity.db": data})
+	case strings.HasSuffix(path, ".toml"):
+		return im.pihole(map[string][]byte{"pihole.toml": data})
+	case strings.HasSuffix(path, ".yaml"), strings.HasSuffix(path, ".yml"):
+		if err := im.adGuard(data); err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("%s: unknown configuration format", path)
+}
+
+// readDir returns the files of a directory and its dnsmasq.d by base name
+func readDir(dir string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+
+	for _, pattern := range []string{"*", "dnsmasq.d/*"} {
+		paths, _ := filepath.Glob(filepath.Join(dir, pattern))
+		for _, path := range paths {
+			if info, err := os.Stat(path); err != nil || info.IsDir() {
+				continue
+			}
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			files[filepath.Base(path)] = data
+		}
+	}
+
+	return files, nil
+}
+
+func readTarGz(data []byte) (map[string][]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[filepath.Base(hdr.Name)] = b
+	}
+}
+
+func readZip(data []byte) (map[string][]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]byte)
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		files[filepath.Base(f.Name)] = b
+	}
+
+	return files, nil
+}
+
+// WriteConfig writes the config as YAML, with the local records in
+// hostsFile when there are any
+func (im *Import) WriteConfig(w io.Writer, hostsFile string) error {
+	config := im.Config
+
+	if len(im.Records) > 0 {
+		if err := im.writeHosts(hostsFile); err != nil {
+			return err
+		}
+		config.Resolver.Hosts = &Hosts{Enable: true, HostsFile: hostsFile}
+	}
+
+	b, err := yaml.Marshal(&config)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, "---\n"); err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func (im *Import) writeHosts(path string) error {
+	var buf bytes.Buffer
+	buf.WriteString("# local records imported into dnsproxy\n")
+	for _, r := range im.Records {
+		fmt.Fprintf(&buf, "%s %s\n", r.IP, r.Name)
+	}
+
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
+func (im *Import) addNameserver(addr string) {
+	for _, ns := range im.Config.Resolver.Nameservers {
+		if ns == addr {
+			return
+		}
+	}
+	im.Config.Resolver.Nameservers = append(im.Config.Resolver.Nameservers, addr)
+}
+
+func (im *Import) addSource(name string, url string) string {
+	names := make(map[string]bool)
+	for _, s := range im.Config.Blocker.SourceURLs {
+		if s.URL == url {
+			return s.Name
+		}
+		names[s.Name] = true
+	}
+
+	unique := name
+	for i := 2; names[unique]; i++ {
+		unique = fmt.Sprintf("%s-%d", name, i)
+	}
+
+	im.Config.Blocker.SourceURLs = append(im.Config.Blocker.SourceURLs, Source{unique, url})
+	return unique
+}
+
+func (im *Import) addRecord(ip string, name string) {
+	im.Records = append(im.Records, Record{ip, strings.ToLower(name)})
+}
+
+// addRewrite rewrites domain to answer, false when the rewrite can't be
+// expressed: an invalid domain or answer, or a domain answered with a name
+// and something else
+func (im *Import) addRewrite(domain string, answer string) bool {
+	domain = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+	answer = strings.TrimSpace(answer)
+
+	address := net.ParseIP(answer) != nil
+	if !address {
+		answer = strings.ToLower(strings.TrimSuffix(answer, "."))
+	}
+	if !validName(strings.TrimPrefix(domain, "*.")) || (!address && !validName(answer)) {
+		return false
+	}
+
+	for _, rw := range im.Config.Resolver.Rewrites {
+		if rw.Domain != domain {
+			continue
+		}
+		if rw.Answer == answer {
+			return true
+		}
+		if !address || net.ParseIP(rw.Answer) == nil {
+			return false
+		}
+	}
+
+	im.Config.Resolver.Rewrites = append(im.Config.Resolver.Rewrites, Rewrite{domain, answer})
+	return true
+}
+
+// validName reports whether name is a domain name without wildcards
+func validName(name string) bool {
+	_, ok := dns.IsDomainName(name)
+	return ok && name != "" && !strings.Contains(name, "*")
+}
+
+var nonName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// sourceName turns a list name into a source name, which is also its file name
+func sourceName(name string, fallback string) string {
+	name = strings.Trim(nonName.ReplaceAllString(name, "-"), "-.")
+	if name == "" {
+		return fallback
+	}
+	return name
+}
+
+// nameserver turns a resolver address with an optional port, written as
+// ip#port or ip:port, into a nameserver address
+func nameserver(addr string) (string, bool) {
+	addr = strings.TrimSpace(addr)
+	host, port := addr, "53"
+
+	if i := strings.LastIndex(addr, "#"); i >= 0 {
+		host, port = addr[:i], addr[i+1:]
+	} else if h, p, err := net.SplitHostPort(addr); err == nil {
+		host, port = h, p
+	}
+
+	host = strings.Trim(host, "[]")
+	if net.ParseIP(host) == nil {
+		return "", false
+	}
+	if _, err := strconv.Atoi(port); err != nil {
+		return "", false
+	}
+
+	return net.JoinHostPort(host, port), true
+}
+
+// clientID turns a client identifier into a client group entry
+func clientID(id string) (string, bool) {
+	id = strings.TrimSpace(id)
+	if net.ParseIP(id) != nil {
+		return id, true
+	}
+	if _, _, err := net.ParseCIDR(id); err == nil {
+		return id, true
+	}
+	if mac, err := net.ParseMAC(id); err == nil && len(mac) == 6 {
+		return "mac:" + strings.ToLower(mac.String()), true
+	}
+	return "", false
+}
+
+func appendUnique(list []string, values ...string) []string {
+	seen := make(map[string]bool)
+	for _, v := range list {
+		seen[v] = true
+	}
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func sortedKeys(m map[string]bool) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
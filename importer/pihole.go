@@ -0,0 +1,547 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Pi-hole domainlist types
+const (
+	exactWhitelist = 0
+	exactBlacklist = 1
+	regexWhitelist = 2
+	regexBlacklist = 3
+)
+
+// defaultGroup is the Pi-hole group of every client
+const defaultGroup = 0
+
+// row is a row of a gravity table, read from the database or from the JSON
+// files of a teleporter export
+type row map[string]interface{}
+
+func (r row) int(key string) int64 {
+	switch v := r[key].(type) {
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	case bool:
+		if v {
+			return 1
+		}
+	case string:
+		i, _ := strconv.ParseInt(v, 10, 64)
+		return i
+	}
+	return 0
+}
+
+func (r row) str(key string) string {
+	switch v := r[key].(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return ""
+}
+
+func (r row) enabled() bool {
+	_, ok := r["enabled"]
+	return !ok || r.int("enabled") != 0
+}
+
+// piholeJSON maps the files of a teleporter export to gravity tables, the
+// domain list files also set the type of their entries
+var piholeJSON = map[string]struct {
+	table string
+	kind  int64
+}{
+	"adlist.json":              {"adlist", -1},
+	"group.json":               {"group", -1},
+	"client.json":              {"client", -1},
+	"adlist_by_group.json":     {"adlist_by_group", -1},
+	"client_by_group.json":     {"client_by_group", -1},
+	"domainlist_by_group.json": {"domainlist_by_group", -1},
+	"domainlist.json":          {"domainlist", -1},
+	"whitelist.exact.json":     {"domainlist", exactWhitelist},
+	"blacklist.exact.json":     {"domainlist", exactBlacklist},
+	"whitelist.regex.json":     {"domainlist", regexWhitelist},
+	"blacklist.regex.json":     {"domainlist", regexBlacklist},
+}
+
+var piholeTableNames = []string{"adlist", "group", "client", "adlist_by_group", "client_by_group", "domainlist_by_group", "domainlist"}
+
+func piholeTables(files map[string][]byte) (map[string][]row, error) {
+	tables := make(map[string][]row)
+
+	if data, ok := files["gravity.db"]; ok {
+		db, err := openSQLite(data)
+		if err != nil {
+			return nil, fmt.Errorf("gravity.db: %s", err)
+		}
+
+		for _, name := range piholeTableNames {
+			rows, ok, err := db.rows(name)
+			if err != nil {
+				return nil, fmt.Errorf("gravity.db: table %s: %s", name, err)
+			}
+			if ok {
+				tables[name] = []row{}
+			}
+			for _, r := range rows {
+				tables[name] = append(tables[name], row(r))
+			}
+		}
+
+		return tables, nil
+	}
+
+	for file, t := range piholeJSON {
+		data, ok := files[file]
+		if !ok {
+			continue
+		}
+
+		var rows []row
+		if err := json.Unmarshal(data, &rows); err != nil {
+			return nil, fmt.Errorf("%s: %s", file, err)
+		}
+
+		if _, ok := tables[t.table]; !ok {
+			tables[t.table] = []row{}
+		}
+		for _, r := range rows {
+			if t.kind >= 0 {
+				r["type"] = t.kind
+			}
+			tables[t.table] = append(tables[t.table], r)
+		}
+	}
+
+	return tables, nil
+}
+
+// pihole imports the files of a Pi-hole installation or teleporter export
+func (im *Import) pihole(files map[string][]byte) error {
+	tables, err := piholeTables(files)
+	if err != nil {
+		return err
+	}
+
+	found := len(tables) > 0
+	im.piholeLists(tables)
+
+	vars := make(map[string]string)
+	if data, ok := files["setupVars.conf"]; ok {
+		found = true
+		vars = parseVars(data)
+		im.piholeSetupVars(vars)
+	}
+
+	if data, ok := files["pihole-FTL.conf"]; ok {
+		found = true
+		ftl := parseVars(data)
+		im.piholeBlocking(ftl["BLOCKINGMODE"], ftl["REPLY_ADDR4"], ftl["REPLY_ADDR6"], vars)
+	}
+
+	if data, ok := files["custom.list"]; ok {
+		found = true
+		im.hostsLines(string(data))
+	}
+
+	if data, ok := files["05-pihole-custom-cname.conf"]; ok {
+		found = true
+		im.piholeCNAMEs(data)
+	}
+
+	if data, ok := files["pihole.toml"]; ok {
+		found = true
+		if err := im.piholeTOML(data); err != nil {
+			return fmt.Errorf("pihole.toml: %s", err)
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("no Pi-hole configuration found")
+	}
+
+	return nil
+}
+
+// piholeLists imports adlists, domain lists and client groups
+func (im *Import) piholeLists(tables map[string][]row) {
+	groups := make(map[int64]row)
+	for _, g := range tables["group"] {
+		groups[g.int("id")] = g
+	}
+
+	memberships := func(table string, key string) map[int64][]int64 {
+		m := make(map[int64][]int64)
+		for _, r := range tables[table] {
+			m[r.int(key)] = append(m[r.int(key)], r.int("group_id"))
+		}
+		return m
+	}
+	adlistGroups := memberships("adlist_by_group", "adlist_id")
+	clientGroups := memberships("client_by_group", "client_id")
+	domainGroups := memberships("domainlist_by_group", "domainlist_id")
+	_, assigned := tables["domainlist_by_group"]
+
+	// imported client groups by Pi-hole group id
+	imported := make(map[int64]*Group)
+	var order []int64
+	for _, g := range tables["group"] {
+		id := g.int("id")
+		if id == defaultGroup {
+			continue
+		}
+		if !g.enabled() {
+			im.unmapped("Pi-hole group %s is disabled, not imported", g.str("name"))
+			continue
+		}
+		imported[id] = &Group{Name: sourceName(g.str("name"), fmt.Sprintf("group-%d", id))}
+		order = append(order, id)
+	}
+
+	for _, c := range tables["client"] {
+		ip := c.str("ip")
+		ids := clientGroups[c.int("id")]
+
+		var targets []int64
+		for _, id := range ids {
+			if imported[id] != nil {
+				targets = append(targets, id)
+			}
+		}
+		if len(targets) == 0 {
+			continue
+		}
+
+		client, ok := clientID(ip)
+		if !ok {
+			im.unmapped("Pi-hole client %s is not an IP, CIDR or MAC address", ip)
+			continue
+		}
+		if len(targets) > 1 {
+			im.unmapped("Pi-hole client %s is in several groups, dnsproxy only applies %s", ip, imported[targets[0]].Name)
+		}
+		imported[targets[0]].Clients = append(imported[targets[0]].Clients, client)
+	}
+
+	for _, a := range tables["adlist"] {
+		url := a.str("address")
+		if !a.enabled() {
+			im.unmapped("Pi-hole adlist %s is disabled, not imported", url)
+			continue
+		}
+
+		name := im.addSource(fmt.Sprintf("adlist-%d", a.int("id")), url)
+
+		ids, ok := adlistGroups[a.int("id")]
+		inDefault := !ok
+		for _, id := range ids {
+			if id == defaultGroup {
+				inDefault = true
+			} else if g := imported[id]; g != nil {
+				g.Sources = appendUnique(g.Sources, name)
+			}
+		}
+		if !inDefault {
+			im.unmapped("Pi-hole adlist %s is not in the Default group, dnsproxy also applies it to clients without a group", url)
+		}
+	}
+
+	for _, d := range tables["domainlist"] {
+		domain, kind := d.str("domain"), d.int("type")
+
+		switch {
+		case !d.enabled():
+			im.unmapped("Pi-hole domain %s is disabled, not imported", domain)
+			continue
+		case kind == regexWhitelist || kind == regexBlacklist:
+			im.unmapped("Pi-hole regex filter %s, regex filters are not supported", domain)
+			continue
+		case kind != exactWhitelist && kind != exactBlacklist:
+			im.unmapped("Pi-hole domain %s has unknown type %d", domain, kind)
+			continue
+		}
+
+		global := !assigned
+		var targets []*Group
+		for _, id := range domainGroups[d.int("id")] {
+			if id == defaultGroup {
+				global = true
+			} else if g := imported[id]; g != nil {
+				targets = append(targets, g)
+			}
+		}
+
+		if !global && len(targets) == 0 {
+			im.unmapped("Pi-hole domain %s is in no imported group, not imported", domain)
+			continue
+		}
+
+		if kind == exactWhitelist {
+			if global {
+				im.Config.Blocker.Whitelist = appendUnique(im.Config.Blocker.Whitelist, domain)
+			}
+			for _, g := range targets {
+				g.Whitelist = appendUnique(g.Whitelist, domain)
+			}
+		} else {
+			if global {
+				im.Config.Blocker.Blocklist = appendUnique(im.Config.Blocker.Blocklist, domain)
+			}
+			for _, g := range targets {
+				g.Blocklist = appendUnique(g.Blocklist, domain)
+			}
+		}
+	}
+
+	for _, id := range order {
+		g := imported[id]
+		if len(g.Clients) == 0 {
+			im.unmapped("Pi-hole group %s has no clients, not imported", g.Name)
+			continue
+		}
+		if len(g.Sources) == 0 {
+			im.unmapped("Pi-hole group %s has no adlists, dnsproxy enables every source for it", g.Name)
+		}
+		im.Config.Resolver.Groups = append(im.Config.Resolver.Groups, *g)
+	}
+}
+
+// parseVars reads KEY=value lines
+func parseVars(data []byte) map[string]string {
+	vars := make(map[string]string)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.IndexByte(line, '='); i > 0 {
+			vars[strings.TrimSpace(line[:i])] = strings.Trim(strings.TrimSpace(line[i+1:]), "\"'")
+		}
+	}
+
+	return vars
+}
+
+func (im *Import) piholeSetupVars(vars map[string]string) {
+	var keys []string
+	for key := range vars {
+		if strings.HasPrefix(key, "PIHOLE_DNS_") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, _ := strconv.Atoi(strings.TrimPrefix(keys[i], "PIHOLE_DNS_"))
+		b, _ := strconv.Atoi(strings.TrimPrefix(keys[j], "PIHOLE_DNS_"))
+		return a < b
+	})
+	for _, key := range keys {
+		im.upstream(vars[key])
+	}
+
+	if vars["BLOCKING_ENABLED"] == "false" {
+		im.unmapped("Pi-hole blocking is disabled, dnsproxy always blocks; pause it with PUT /application/blocking")
+	}
+
+	if vars["DHCP_ACTIVE"] == "true" {
+		im.unmapped("Pi-hole DHCP server, DHCP is not supported")
+	}
+	if vars["REV_SERVER"] == "true" || vars["CONDITIONAL_FORWARDING"] == "true" {
+		im.unmapped("Pi-hole conditional forwarding, conditional forwarding is not supported")
+	}
+	if vars["DNSSEC"] == "true" {
+		im.unmapped("Pi-hole DNSSEC validation, DNSSEC is not supported")
+	}
+}
+
+// piholeBlocking maps a Pi-hole blocking mode, IP modes answer with the given
+// addresses or those of the Pi-hole
+func (im *Import) piholeBlocking(mode string, ipv4 string, ipv6 string, vars map[string]string) {
+	if ipv4 == "" {
+		ipv4 = strings.Split(vars["IPV4_ADDRESS"], "/")[0]
+	}
+	if ipv6 == "" {
+		ipv6 = strings.Split(vars["IPV6_ADDRESS"], "/")[0]
+	}
+
+	switch strings.ToUpper(mode) {
+	case "":
+	case "NULL":
+		im.Config.Resolver.Block = &Block{Mode: "null"}
+	case "NXDOMAIN":
+		im.Config.Resolver.Block = &Block{Mode: "nxdomain"}
+	case "NODATA":
+		im.Config.Resolver.Block = &Block{Mode: "nodata"}
+	case "IP", "IP-NODATA-AAAA":
+		if ipv4 == "" {
+			im.unmapped("Pi-hole blocking mode %s without a known address, set Resolver.Block.IPv4", mode)
+			return
+		}
+		block := &Block{Mode: "sinkhole", IPv4: ipv4}
+		if strings.ToUpper(mode) == "IP" {
+			block.IPv6 = ipv6
+		}
+		im.Config.Resolver.Block = block
+	default:
+		im.unmapped("Pi-hole blocking mode %s is not supported", mode)
+	}
+}
+
+// hostsLines imports "ip name..." lines as local records
+func (im *Import) hostsLines(data string) {
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(strings.Split(line, "#")[0])
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		if net.ParseIP(fields[0]) == nil {
+			im.unmapped("local record %q has no valid address", line)
+			continue
+		}
+		for _, name := range fields[1:] {
+			im.addRecord(fields[0], name)
+		}
+	}
+}
+
+// piholeCNAMEs imports the local CNAME records of Pi-hole v5
+func (im *Import) piholeCNAMEs(data []byte) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "cname=") {
+			im.piholeCNAME(strings.TrimPrefix(line, "cname="))
+		}
+	}
+}
+
+// piholeCNAME imports a "<cname>[,<cname>...],<target>[,<ttl>]" record as
+// rewrites of its names to the target
+func (im *Import) piholeCNAME(record string) {
+	fields := strings.Split(record, ",")
+	if _, err := strconv.ParseUint(strings.TrimSpace(fields[len(fields)-1]), 10, 32); err == nil && len(fields) > 2 {
+		im.unmapped("CNAME record %s, the TTL of rewrites is the resolver TTL", record)
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) < 2 {
+		im.unmapped("CNAME record %s has no target", record)
+		return
+	}
+
+	target := fields[len(fields)-1]
+	for _, name := range fields[:len(fields)-1] {
+		if !im.addRewrite(name, target) {
+			im.unmapped("CNAME record %s, %s can't be rewritten to %s", record, strings.TrimSpace(name), strings.TrimSpace(target))
+		}
+	}
+}
+
+// piholeConfig is the part of the Pi-hole v6 pihole.toml that is imported
+type piholeConfig struct {
+	DNS struct {
+		Upstreams    []string `toml:"upstreams"`
+		Hosts        []string `toml:"hosts"`
+		CNAMERecords []string `toml:"cnameRecords"`
+		RevServers   []string `toml:"revServers"`
+		DNSSEC       bool     `toml:"dnssec"`
+		Port         int64    `toml:"port"`
+		Blocking     struct {
+			Active bool   `toml:"active"`
+			Mode   string `toml:"mode"`
+		} `toml:"blocking"`
+		Reply struct {
+			Blocking struct {
+				Force4 bool   `toml:"force4"`
+				IPv4   string `toml:"IPv4"`
+				Force6 bool   `toml:"force6"`
+				IPv6   string `toml:"IPv6"`
+			} `toml:"blocking"`
+		} `toml:"reply"`
+	} `toml:"dns"`
+	DHCP struct {
+		Active bool `toml:"active"`
+	} `toml:"dhcp"`
+}
+
+func (im *Import) piholeTOML(data []byte) error {
+	tree, err := toml.LoadBytes(data)
+	if err != nil {
+		return err
+	}
+
+	var config piholeConfig
+	if err := tree.Unmarshal(&config); err != nil {
+		return err
+	}
+	if !tree.Has("dns.blocking.active") {
+		config.DNS.Blocking.Active = true
+	}
+
+	for _, upstream := range config.DNS.Upstreams {
+		im.upstream(upstream)
+	}
+
+	im.hostsLines(strings.Join(config.DNS.Hosts, "\n"))
+
+	for _, cname := range config.DNS.CNAMERecords {
+		im.piholeCNAME(cname)
+	}
+	for _, rev := range config.DNS.RevServers {
+		im.unmapped("Pi-hole conditional forwarding %s, conditional forwarding is not supported", rev)
+	}
+	if config.DNS.DNSSEC {
+		im.unmapped("Pi-hole DNSSEC validation, DNSSEC is not supported")
+	}
+	if config.DHCP.Active {
+		im.unmapped("Pi-hole DHCP server, DHCP is not supported")
+	}
+
+	if config.DNS.Port != 0 && config.DNS.Port != 53 {
+		im.Config.DNSServer = &DNSServer{BindAddr: fmt.Sprintf("0.0.0.0:%d", config.DNS.Port)}
+	}
+
+	if !config.DNS.Blocking.Active {
+		im.unmapped("Pi-hole blocking is disabled, dnsproxy always blocks; pause it with PUT /application/blocking")
+	}
+
+	reply := config.DNS.Reply.Blocking
+	var ipv4, ipv6 string
+	if reply.Force4 {
+		ipv4 = reply.IPv4
+	}
+	if reply.Force6 {
+		ipv6 = reply.IPv6
+	}
+	im.piholeBlocking(config.DNS.Blocking.Mode, ipv4, ipv6, nil)
+
+	return nil
+}
+
+// upstream imports a Pi-hole upstream, ip#port
+func (im *Import) upstream(addr string) {
+	if addr == "" {
+		return
+	}
+	if ns, ok := nameserver(addr); ok {
+		im.addNameserver(ns)
+	} else {
+		im.unmapped("upstream %s is not an IP address", addr)
+	}
+}
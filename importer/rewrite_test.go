@@ -0,0 +1,100 @@
+package importer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// unmappedWith returns the unmapped settings mentioning s
+func unmappedWith(im *Import, s string) []string {
+	var list []string
+	for _, u := range im.Unmapped {
+		if strings.Contains(u, s) {
+			list = append(list, u)
+		}
+	}
+	return list
+}
+
+func TestPiholeCNAMEs(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string][]byte
+		rewrites []Rewrite
+		unmapped int
+	}{
+		{
+			"v5 custom cname",
+			map[string][]byte{"05-pihole-custom-cname.conf": []byte(
+				"cname=nas.lan,Files.LAN,nas-1.lan\n" +
+					"cname=tv.lan,media.lan.,300\n" +
+					"cname=broken.lan\n" +
+					"cname=bad..lan,nas-1.lan\n")},
+			[]Rewrite{{"nas.lan", "nas-1.lan"}, {"files.lan", "nas-1.lan"}, {"tv.lan", "media.lan"}},
+			3,
+		},
+		{
+			"v6 pihole.toml",
+			map[string][]byte{"pihole.toml": []byte("[dns]\ncnameRecords = [\"www.lan,web.lan\", \"www.lan,other.lan\"]\n")},
+			[]Rewrite{{"www.lan", "web.lan"}},
+			1,
+		},
+	}
+
+	for _, test := range tests {
+		im := &Import{}
+		if err := im.pihole(test.files); err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(im.Config.Resolver.Rewrites, test.rewrites) {
+			t.Errorf("%s: rewrites %v, want %v", test.name, im.Config.Resolver.Rewrites, test.rewrites)
+		}
+		if unmapped := unmappedWith(im, "CNAME record"); len(unmapped) != test.unmapped {
+			t.Errorf("%s: unmapped %q, want %d", test.name, unmapped, test.unmapped)
+		}
+	}
+}
+
+func TestAdGuardRewrites(t *testing.T) {
+	im := &Import{}
+	err := im.adGuard([]byte(`dns:
+  bind_host: 0.0.0.0
+filtering:
+  rewrites:
+    - domain: nas.lan
+      answer: 192.168.1.2
+    - domain: nas.lan
+      answer: fd00::2
+    - domain: "*.apps.lan"
+      answer: nas.lan
+    - domain: keep.apps.lan
+      answer: keep.apps.lan
+    - domain: www.lan
+      answer: A
+    - domain: "*.apps.lan"
+      answer: 192.168.1.3
+    - domain: bad..lan
+      answer: 192.168.1.4
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Rewrite{
+		{"nas.lan", "192.168.1.2"},
+		{"nas.lan", "fd00::2"},
+		{"*.apps.lan", "nas.lan"},
+		{"keep.apps.lan", "keep.apps.lan"},
+	}
+	if !reflect.DeepEqual(im.Config.Resolver.Rewrites, want) {
+		t.Errorf("rewrites %v, want %v", im.Config.Resolver.Rewrites, want)
+	}
+	if len(im.Records) != 0 {
+		t.Errorf("rewrites imported as records %v", im.Records)
+	}
+	if unmapped := unmappedWith(im, "AdGuard rewrite"); len(unmapped) != 3 {
+		t.Errorf("unmapped %q, want the rewrites of www.lan, *.apps.lan and bad..lan", unmapped)
+	}
+}
@@ -0,0 +1,360 @@
+package importer
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// sqliteDB is a read-only reader of the rowid tables of a SQLite 3 database,
+// enough to read a Pi-hole gravity database without a SQLite driver. Indexes,
+// WITHOUT ROWID tables and uncommitted WAL pages are not supported.
+type sqliteDB struct {
+	data     []byte
+	pageSize int
+	usable   int
+	tables   map[string]sqliteTable
+}
+
+type sqliteTable struct {
+	root    int
+	columns []string
+	// rowid is the INTEGER PRIMARY KEY column, -1 if there is none
+	rowid int
+}
+
+var errSQLiteFormat = errors.New("invalid SQLite database")
+
+func openSQLite(data []byte) (*sqliteDB, error) {
+	if len(data) < 100 || string(data[:16]) != "SQLite format 3\x00" {
+		return nil, errSQLiteFormat
+	}
+
+	db := &sqliteDB{data: data, tables: make(map[string]sqliteTable)}
+
+	db.pageSize = int(binary.BigEndian.Uint16(data[16:]))
+	if db.pageSize == 1 {
+		db.pageSize = 65536
+	}
+	db.usable = db.pageSize - int(data[20])
+	if db.pageSize < 512 || len(data)%db.pageSize != 0 {
+		return nil, errSQLiteFormat
+	}
+	// the page count of the header is valid when its version matches the
+	// change counter, a shorter file is truncated
+	pages := uint64(binary.BigEndian.Uint32(data[28:]))
+	if binary.BigEndian.Uint32(data[92:]) == binary.BigEndian.Uint32(data[24:]) && pages*uint64(db.pageSize) > uint64(len(data)) {
+		return nil, errSQLiteFormat
+	}
+	if enc := binary.BigEndian.Uint32(data[56:]); enc > 1 {
+		return nil, fmt.Errorf("unsupported SQLite text encoding %d", enc)
+	}
+
+	// sqlite_schema: type, name, tbl_name, rootpage, sql
+	err := db.scan(1, func(_ int64, values []interface{}) error {
+		if len(values) < 5 || values[0] != "table" {
+			return nil
+		}
+		name, _ := values[1].(string)
+		root, _ := values[3].(int64)
+		sql, _ := values[4].(string)
+		columns, rowid := sqliteColumns(sql)
+		db.tables[strings.ToLower(name)] = sqliteTable{int(root), columns, rowid}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// sqliteColumns returns the column names of a CREATE TABLE statement and the
+// index of its INTEGER PRIMARY KEY column
+func sqliteColumns(sql string) ([]string, int) {
+	start, end := strings.Index(sql, "("), strings.LastIndex(sql, ")")
+	if start < 0 || end < start {
+		return nil, -1
+	}
+
+	var (
+		defs   []string
+		depth  int
+		quoted bool
+		last   = start + 1
+	)
+	for i := start + 1; i < end; i++ {
+		switch c := sql[i]; {
+		case c == '\'':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			defs = append(defs, sql[last:i])
+			last = i + 1
+		}
+	}
+	defs = append(defs, sql[last:end])
+
+	var columns []string
+	rowid := -1
+	for _, def := range defs {
+		fields := strings.Fields(def)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "PRIMARY", "UNIQUE", "CHECK", "FOREIGN", "CONSTRAINT":
+			continue
+		}
+
+		if len(fields) >= 4 && strings.EqualFold(fields[1], "INTEGER") &&
+			strings.EqualFold(fields[2], "PRIMARY") && strings.EqualFold(fields[3], "KEY") {
+			rowid = len(columns)
+		}
+		columns = append(columns, strings.Trim(fields[0], "\"`[]'"))
+	}
+
+	return columns, rowid
+}
+
+// rows returns the rows of table keyed by column name, an INTEGER PRIMARY
+// KEY column holds the rowid
+func (db *sqliteDB) rows(table string) ([]map[string]interface{}, bool, error) {
+	t, ok := db.tables[strings.ToLower(table)]
+	if !ok {
+		return nil, false, nil
+	}
+
+	var rows []map[string]interface{}
+	err := db.scan(t.root, func(rowid int64, values []interface{}) error {
+		row := make(map[string]interface{})
+		for i, column := range t.columns {
+			if i < len(values) {
+				row[column] = values[i]
+			}
+			if i == t.rowid {
+				row[column] = rowid
+			}
+		}
+		rows = append(rows, row)
+		return nil
+	})
+
+	return rows, true, err
+}
+
+func (db *sqliteDB) page(n int) ([]byte, error) {
+	if n < 1 || n*db.pageSize > len(db.data) {
+		return nil, errSQLiteFormat
+	}
+	return db.data[(n-1)*db.pageSize : n*db.pageSize], nil
+}
+
+// scan walks the table b-tree rooted at page root in rowid order
+func (db *sqliteDB) scan(root int, fn func(rowid int64, values []interface{}) error) error {
+	return db.scanPage(root, 0, make(map[int]bool), fn)
+}
+
+// scanPage walks the b-tree page n, every page is visited once so that
+// corrupt pointers can't loop
+func (db *sqliteDB) scanPage(n int, depth int, seen map[int]bool, fn func(int64, []interface{}) error) error {
+	if depth > 32 || seen[n] {
+		return errSQLiteFormat
+	}
+	seen[n] = true
+
+	page, err := db.page(n)
+	if err != nil {
+		return err
+	}
+
+	hdr := 0
+	if n == 1 {
+		hdr = 100
+	}
+	if len(page) < hdr+12 {
+		return errSQLiteFormat
+	}
+
+	kind := page[hdr]
+	cells := int(binary.BigEndian.Uint16(page[hdr+3:]))
+	ptrs := hdr + 8
+	if kind == 0x05 {
+		ptrs = hdr + 12
+	}
+	if ptrs+cells*2 > len(page) {
+		return errSQLiteFormat
+	}
+
+	for i := 0; i < cells; i++ {
+		off := int(binary.BigEndian.Uint16(page[ptrs+i*2:]))
+		if off+4 > len(page) {
+			return errSQLiteFormat
+		}
+
+		switch kind {
+		case 0x05:
+			child := int(binary.BigEndian.Uint32(page[off:]))
+			if err := db.scanPage(child, depth+1, seen, fn); err != nil {
+				return err
+			}
+		case 0x0d:
+			size, n1 := sqliteVarint(page[off:])
+			rowid, n2 := sqliteVarint(page[off+n1:])
+			if size > uint64(len(db.data)) {
+				return errSQLiteFormat
+			}
+			payload, err := db.payload(page, off+n1+n2, int(size))
+			if err != nil {
+				return err
+			}
+			values, err := sqliteRecord(payload)
+			if err != nil {
+				return err
+			}
+			if err := fn(int64(rowid), values); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported SQLite page type %#x", kind)
+		}
+	}
+
+	if kind == 0x05 {
+		right := int(binary.BigEndian.Uint32(page[hdr+8:]))
+		return db.scanPage(right, depth+1, seen, fn)
+	}
+
+	return nil
+}
+
+// payload reads a cell payload of size bytes starting at off, following
+// overflow pages
+func (db *sqliteDB) payload(page []byte, off int, size int) ([]byte, error) {
+	u := db.usable
+	maxLocal := u - 35
+	local := size
+	if size > maxLocal {
+		minLocal := (u-12)*32/255 - 23
+		local = minLocal + (size-minLocal)%(u-4)
+		if local > maxLocal {
+			local = minLocal
+		}
+	}
+
+	if local < 0 || off+local > len(page) {
+		return nil, errSQLiteFormat
+	}
+	payload := append([]byte{}, page[off:off+local]...)
+	if local == size {
+		return payload, nil
+	}
+
+	if off+local+4 > len(page) {
+		return nil, errSQLiteFormat
+	}
+	next := int(binary.BigEndian.Uint32(page[off+local:]))
+	for len(payload) < size {
+		overflow, err := db.page(next)
+		if err != nil {
+			return nil, err
+		}
+		next = int(binary.BigEndian.Uint32(overflow))
+
+		chunk := overflow[4:u]
+		if rest := size - len(payload); rest < len(chunk) {
+			chunk = chunk[:rest]
+		}
+		payload = append(payload, chunk...)
+	}
+
+	return payload, nil
+}
+
+// sqliteVarint decodes a big-endian SQLite varint
+func sqliteVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 9 && i < len(b); i++ {
+		if i == 8 {
+			return v<<8 | uint64(b[i]), 9
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+	return v, len(b)
+}
+
+// sqliteRecord decodes the values of a record
+func sqliteRecord(b []byte) ([]interface{}, error) {
+	hdrSize, n := sqliteVarint(b)
+	if hdrSize < uint64(n) || hdrSize > uint64(len(b)) {
+		return nil, errSQLiteFormat
+	}
+
+	var (
+		values []interface{}
+		body   = b[hdrSize:]
+	)
+	for hdr := b[n:hdrSize]; len(hdr) > 0; {
+		t, n := sqliteVarint(hdr)
+		hdr = hdr[n:]
+
+		var size int
+		switch {
+		case t >= 12:
+			if (t-12)/2 > uint64(len(body)) {
+				return nil, errSQLiteFormat
+			}
+			size = int(t-12) / 2
+		case t >= 1 && t <= 4:
+			size = int(t)
+		case t == 5:
+			size = 6
+		case t == 6 || t == 7:
+			size = 8
+		}
+		if size > len(body) {
+			return nil, errSQLiteFormat
+		}
+		v := body[:size]
+		body = body[size:]
+
+		switch {
+		case t == 0:
+			values = append(values, nil)
+		case t >= 1 && t <= 6:
+			var i int64
+			for j, c := range v {
+				if j == 0 {
+					i = int64(int8(c))
+				} else {
+					i = i<<8 | int64(c)
+				}
+			}
+			values = append(values, i)
+		case t == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(v)))
+		case t == 8:
+			values = append(values, int64(0))
+		case t == 9:
+			values = append(values, int64(1))
+		case t >= 12 && t%2 == 0:
+			values = append(values, append([]byte{}, v...))
+		case t >= 13:
+			values = append(values, string(v))
+		default:
+			return nil, errSQLiteFormat
+		}
+	}
+
+	return values, nil
+}
@@ -0,0 +1,180 @@
+package importer
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testdata/gravity.db is a Pi-hole gravity database with 512 byte pages,
+// its domainlist spans interior pages and row 30 overflows into overflow
+// pages. Rows of domainlist have type id%4, enabled id%5 != 0, date_modified
+// 1792394594+id*100000 and a comment for every third id.
+func readGravity(t *testing.T) []byte {
+	data, err := ioutil.ReadFile("testdata/gravity.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestSQLiteGravity(t *testing.T) {
+	db, err := openSQLite(readGravity(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		table  string
+		rows   int
+		index  int
+		column string
+		want   interface{}
+	}{
+		{"domainlist", 60, 0, "id", int64(1)},
+		{"domainlist", 60, 0, "type", int64(1)},
+		{"domainlist", 60, 0, "domain", "d01.example"},
+		{"domainlist", 60, 0, "enabled", int64(1)},
+		{"domainlist", 60, 0, "comment", nil},
+		{"domainlist", 60, 2, "comment", "comment 3"},
+		{"domainlist", 60, 4, "enabled", int64(0)},
+		{"domainlist", 60, 29, "comment", strings.Repeat("x", 2000)},
+		{"domainlist", 60, 59, "domain", "d60.example"},
+		{"domainlist", 60, 59, "date_modified", int64(1792394594 + 60*100000)},
+		{"group", 2, 0, "id", int64(0)},
+		{"group", 2, 0, "name", "Default"},
+		{"group", 2, 1, "enabled", int64(0)},
+		{"group", 2, 1, "description", nil},
+		{"adlist", 2, 1, "address", "https://example.com/off.txt"},
+		{"client", 1, 0, "ip", "192.168.1.50"},
+	}
+
+	for _, test := range tests {
+		rows, ok, err := db.rows(test.table)
+		if err != nil || !ok {
+			t.Fatalf("rows(%s) = %v, %v", test.table, ok, err)
+		}
+		if len(rows) != test.rows {
+			t.Fatalf("%s has %d rows, want %d", test.table, len(rows), test.rows)
+		}
+		if got := rows[test.index][test.column]; !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s row %d %s = %#v, want %#v", test.table, test.index, test.column, got, test.want)
+		}
+	}
+
+	if _, ok, err := db.rows("missing"); ok || err != nil {
+		t.Errorf("rows(missing) = %v, %v", ok, err)
+	}
+}
+
+// readAll decodes every table of data, it must fail or succeed but not panic
+func readAll(data []byte) error {
+	db, err := openSQLite(data)
+	if err != nil {
+		return err
+	}
+	for table := range db.tables {
+		if _, _, err := db.rows(table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestSQLiteTruncated(t *testing.T) {
+	data := readGravity(t)
+
+	for _, size := range []int{0, 15, 99, 100, 511, 512, 1024, len(data) / 2, len(data) - 512, len(data) - 1} {
+		if err := readAll(data[:size]); err == nil {
+			t.Errorf("database truncated to %d bytes read", size)
+		}
+	}
+}
+
+func TestSQLiteCorrupt(t *testing.T) {
+	data := readGravity(t)
+
+	tests := []struct {
+		name   string
+		offset int
+		value  []byte
+	}{
+		{"magic", 0, []byte("MySQL")},
+		{"page size", 16, []byte{0x00, 0x10}},
+		{"page size not dividing", 16, []byte{0x03, 0x00}},
+		{"text encoding", 56, []byte{0x00, 0x00, 0x00, 0x03}},
+		{"schema page type", 100, []byte{0x02}},
+		{"schema cell count", 103, []byte{0xff, 0xff}},
+	}
+
+	for _, test := range tests {
+		corrupt := append([]byte{}, data...)
+		copy(corrupt[test.offset:], test.value)
+		if err := readAll(corrupt); err == nil {
+			t.Errorf("database with corrupt %s read", test.name)
+		}
+	}
+
+	// every byte set to the values that break lengths and pointers
+	for offset := range data {
+		for _, value := range []byte{0x00, 0xff} {
+			corrupt := append([]byte{}, data...)
+			corrupt[offset] = value
+			readAll(corrupt)
+		}
+	}
+}
+
+func TestSQLiteRecord(t *testing.T) {
+	tests := []struct {
+		name   string
+		record []byte
+		values []interface{}
+		err    bool
+	}{
+		{"values", []byte{0x05, 0x00, 0x01, 0x08, 0x0f, 0x2a, 'a'}, []interface{}{nil, int64(42), int64(0), "a"}, false},
+		{"negative integer", []byte{0x02, 0x02, 0xff, 0xfe}, []interface{}{int64(-2)}, false},
+		{"blob", []byte{0x02, 0x10, 0x01, 0x02}, []interface{}{[]byte{0x01, 0x02}}, false},
+		{"empty", nil, nil, false},
+		{"header shorter than its size", []byte{0x00}, nil, true},
+		{"header longer than record", []byte{0x05, 0x01}, nil, true},
+		{"huge serial type", []byte{0x0a, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, nil, true},
+		{"text past body", []byte{0x02, 0x1b, 'a'}, nil, true},
+		{"integer past body", []byte{0x02, 0x06, 0x01}, nil, true},
+		{"reserved serial type", []byte{0x02, 0x0a}, nil, true},
+	}
+
+	for _, test := range tests {
+		values, err := sqliteRecord(test.record)
+		if (err != nil) != test.err {
+			t.Errorf("%s: error %v", test.name, err)
+			continue
+		}
+		if !test.err && !reflect.DeepEqual(values, test.values) {
+			t.Errorf("%s: values %#v, want %#v", test.name, values, test.values)
+		}
+	}
+}
+
+func TestSQLitePayload(t *testing.T) {
+	db := &sqliteDB{data: make([]byte, 1024), pageSize: 512, usable: 512}
+	page := db.data[:512]
+
+	tests := []struct {
+		name string
+		off  int
+		size int
+	}{
+		{"negative size", 10, -1},
+		{"past page", 500, 100},
+		{"offset past page", 600, 0},
+		{"overflow page 0", 10, 4000},
+	}
+
+	for _, test := range tests {
+		if _, err := db.payload(page, test.off, test.size); err == nil {
+			t.Errorf("%s: payload read", test.name)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package iptree
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+type node struct {
+	children [2]*node
+	value    interface{}
+	set      bool
+}
+
+// Tree is a binary radix tree of IPv4 and IPv6 networks supporting
+// longest prefix match lookups. It is not safe for concurrent writes.
+type Tree struct {
+	root4  *node
+	root6  *node
+	length int
+}
+
+// New returns an empty Tree
+func New() *Tree {
+	return &Tree{
+		root4: &node{},
+		root6: &node{},
+	}
+}
+
+// ParseCIDR parses a network in CIDR notation, a bare IP is a host network
+func ParseCIDR(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %q", s)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+
+	_, ipnet, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, err
+	}
+	return ipnet, nil
+}
+
+func (t *Tree) root(ip net.IP) (*node, net.IP) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return t.root4, ip4
+	}
+	return t.root6, ip.To16()
+}
+
+func bit(ip net.IP, i int) int {
+	return int(ip[i/8]>>(7-uint(i%8))) & 1
+}
+
+// find returns the node of network, creating the missing nodes with create
+func (t *Tree) find(network *net.IPNet, create bool) *node {
+	n, ip := t.root(network.IP)
+	if ip == nil {
+		return nil
+	}
+
+	ones, _ := network.Mask.Size()
+	for i := 0; i < ones && n != nil; i++ {
+		b := bit(ip, i)
+		if n.children[b] == nil && create {
+			n.children[b] = &node{}
+		}
+		n = n.children[b]
+	}
+	return n
+}
+
+// Insert adds network with value, replacing the value of an existing network
+func (t *Tree) Insert(network *net.IPNet, value interface{}) {
+	n := t.find(network, true)
+	if n == nil {
+		return
+	}
+
+	if !n.set {
+		t.length++
+	}
+	n.value = value
+	n.set = true
+}
+
+// InsertString parses s with ParseCIDR and adds it with value
+func (t *Tree) InsertString(s string, value interface{}) error {
+	network, err := ParseCIDR(s)
+	if err != nil {
+		return err
+	}
+
+	t.Insert(network, value)
+	return nil
+}
+
+// Get returns the value of exactly network
+func (t *Tree) Get(network *net.IPNet) (interface{}, bool) {
+	n := t.find(network, false)
+	if n == nil || !n.set {
+		return nil, false
+	}
+	return n.value, true
+}
+
+// Lookup returns the value of the most specific network containing ip
+func (t *Tree) Lookup(ip net.IP) (interface{}, bool) {
+	values := t.LookupAll(ip)
+	if len(values) == 0 {
+		return nil, false
+	}
+	return values[0], true
+}
+
+// LookupAll returns the values of every network containing ip, the most
+// specific first
+func (t *Tree) LookupAll(ip net.IP) []interface{} {
+	n, ip := t.root(ip)
+	if ip == nil {
+		return nil
+	}
+
+	var values []interface{}
+	for i := 0; n != nil; i++ {
+		if n.set {
+			values = append([]interface{}{n.value}, values...)
+		}
+		if i == len(ip)*8 {
+			break
+		}
+		n = n.children[bit(ip, i)]
+	}
+
+	return values
+}
+
+// Contains reports whether ip is in any network of the tree
+func (t *Tree) Contains(ip net.IP) bool {
+	_, ok := t.Lookup(ip)
+	return ok
+}
+
+// Len returns the number of networks in the tree
+func (t *Tree) Len() int {
+	return t.length
+}
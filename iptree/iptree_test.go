@@ -0,0 +1,76 @@
+package iptree
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestTree(t *testing.T) {
+	tree := New()
+	for _, entry := range []struct {
+		network string
+		value   string
+	}{
+		{"10.0.0.0/8", "ten"},
+		{"10.1.0.0/16", "ten-one"},
+		{"10.1.2.3", "host"},
+		{"2001:db8::/32", "doc6"},
+		{"2001:db8:1::/48", "doc6-one"},
+		{"0.0.0.0/0", "any4"},
+	} {
+		if err := tree.InsertString(entry.network, entry.value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tree.InsertString("10.0.0.0/33", "bad"); err == nil {
+		t.Error("invalid network inserted")
+	}
+	if err := tree.InsertString("not an ip", "bad"); err == nil {
+		t.Error("invalid address inserted")
+	}
+
+	tests := []struct {
+		ip     string
+		values []interface{}
+	}{
+		{"10.1.2.3", []interface{}{"host", "ten-one", "ten", "any4"}},
+		{"10.1.2.4", []interface{}{"ten-one", "ten", "any4"}},
+		{"10.2.0.1", []interface{}{"ten", "any4"}},
+		{"192.0.2.1", []interface{}{"any4"}},
+		{"::ffff:10.1.2.3", []interface{}{"host", "ten-one", "ten", "any4"}},
+		{"2001:db8:1::1", []interface{}{"doc6-one", "doc6"}},
+		{"2001:db8:2::1", []interface{}{"doc6"}},
+		{"2001:db9::1", nil},
+	}
+
+	for _, test := range tests {
+		ip := net.ParseIP(test.ip)
+		if values := tree.LookupAll(ip); !reflect.DeepEqual(values, test.values) {
+			t.Errorf("LookupAll(%s) = %v, want %v", test.ip, values, test.values)
+		}
+
+		value, ok := tree.Lookup(ip)
+		if ok != (test.values != nil) || (ok && value != test.values[0]) {
+			t.Errorf("Lookup(%s) = %v, %v", test.ip, value, ok)
+		}
+	}
+
+	if tree.Len() != 6 {
+		t.Errorf("Len() = %d, want 6", tree.Len())
+	}
+	tree.InsertString("10.1.0.0/16", "replaced")
+	if value, _ := tree.Lookup(net.ParseIP("10.1.9.9")); value != "replaced" || tree.Len() != 6 {
+		t.Errorf("reinserted network has %v and %d networks", value, tree.Len())
+	}
+
+	network, _ := ParseCIDR("10.1.0.0/16")
+	if value, ok := tree.Get(network); !ok || value != "replaced" {
+		t.Errorf("Get(10.1.0.0/16) = %v, %v", value, ok)
+	}
+	network, _ = ParseCIDR("10.1.0.0/17")
+	if value, ok := tree.Get(network); ok {
+		t.Errorf("Get(10.1.0.0/17) = %v, %v", value, ok)
+	}
+}
@@ -0,0 +1,194 @@
+package leases
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+
+	conf "github.com/ray-g/dnsproxy/config"
+	"github.com/ray-g/dnsproxy/logger"
+	"github.com/ray-g/dnsproxy/utils"
+	"github.com/ray-g/dnsproxy/watcher"
+)
+
+// Leases resolves the hostnames of the active leases of the lease files,
+// a lease stops resolving when it expires
+type Leases struct {
+	config  *conf.LeasesConfig
+	domain  string
+	watcher *watcher.Watcher
+
+	mu      sync.RWMutex
+	names   map[string][]*Lease
+	reverse map[string][]*Lease
+}
+
+// New loads the lease files of config and watches them until Stop
+func New(config *conf.LeasesConfig) (*Leases, error) {
+	var paths []string
+	for _, file := range config.Files {
+		if _, ok := parsers[file.Format]; !ok {
+			return nil, fmt.Errorf("unknown lease file format %q of %s", file.Format, file.File)
+		}
+		paths = append(paths, file.File)
+	}
+
+	l := &Leases{
+		config: config,
+		domain: strings.ToLower(strings.Trim(config.Domain, ".")),
+	}
+	l.load()
+
+	l.watcher = watcher.New(paths, config.Watch,
+		time.Millisecond*time.Duration(config.ReloadDelay),
+		time.Second*time.Duration(config.RefreshInterval), l.load)
+
+	return l, nil
+}
+
+// Stop ends watching the lease files
+func (l *Leases) Stop() {
+	l.watcher.Stop()
+}
+
+// label returns hostname as a DNS label, the first label of qualified names
+func label(hostname string) (string, bool) {
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	if i := strings.IndexByte(hostname, '.'); i >= 0 {
+		hostname = hostname[:i]
+	}
+
+	if hostname == "" || len(hostname) > 63 || hostname[0] == '-' || hostname[len(hostname)-1] == '-' {
+		return "", false
+	}
+	for _, c := range hostname {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+			return "", false
+		}
+	}
+
+	return hostname, true
+}
+
+func (l *Leases) load() {
+	current := make(map[string]*Lease)
+
+	for _, file := range l.config.Files {
+		f, err := os.Open(file.File)
+		if err != nil {
+			logger.Warningf("reading lease file failed %s", err)
+			continue
+		}
+
+		leases, err := parsers[file.Format](f)
+		f.Close()
+		if err != nil {
+			logger.Warningf("reading lease file %s failed: %s", file.File, err)
+			continue
+		}
+
+		// the last lease of an address is its current state
+		for i := range leases {
+			if leases[i].IP != nil {
+				current[leases[i].IP.String()] = &leases[i]
+			}
+		}
+	}
+
+	names := make(map[string][]*Lease)
+	reverse := make(map[string][]*Lease)
+	now := time.Now()
+
+	for ip, parsed := range current {
+		hostname, ok := label(parsed.Hostname)
+		if !ok || parsed.Expired(now) {
+			continue
+		}
+
+		if l.domain != "" {
+			hostname += "." + l.domain
+		}
+		lease := *parsed
+		lease.Hostname = hostname
+		names[hostname] = append(names[hostname], &lease)
+
+		if arpa, err := dns.ReverseAddr(ip); err == nil {
+			reverse[arpa] = append(reverse[arpa], &lease)
+		}
+	}
+
+	l.mu.Lock()
+	l.names = names
+	l.reverse = reverse
+	l.mu.Unlock()
+
+	logger.Debugf("%d active leases loaded", len(reverse))
+}
+
+// Get returns the addresses of the active leases of name in family and the
+// seconds until the first of them expires, ok is set for every name with an
+// active lease, also without an address of that family
+func (l *Leases) Get(name string, family int) ([]net.IP, uint32, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var (
+		ips   []net.IP
+		ttl   uint32 = math.MaxUint32
+		found bool
+	)
+
+	now := time.Now()
+	for _, lease := range l.names[strings.ToLower(name)] {
+		if lease.Expired(now) {
+			continue
+		}
+		found = true
+
+		ip := lease.IP
+		switch family {
+		case utils.IPv4Query:
+			ip = ip.To4()
+		case utils.IPv6Query:
+			if ip.To4() != nil {
+				ip = nil
+			}
+		default:
+			ip = nil
+		}
+		if ip == nil {
+			continue
+		}
+		ips = append(ips, ip)
+
+		if !lease.Expires.IsZero() {
+			if left := uint32(lease.Expires.Sub(now) / time.Second); left < ttl {
+				ttl = left
+			}
+		}
+	}
+
+	return ips, ttl, found
+}
+
+// Reverse returns the names of the active leases of the address of the
+// reverse name arpa
+func (l *Leases) Reverse(arpa string) ([]string, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var names []string
+	now := time.Now()
+	for _, lease := range l.reverse[strings.ToLower(arpa)] {
+		if !lease.Expired(now) {
+			names = append(names, lease.Hostname)
+		}
+	}
+	return names, len(names) > 0
+}
@@ -0,0 +1,94 @@
+package leases
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	conf "github.com/ray-g/dnsproxy/config"
+	"github.com/ray-g/dnsproxy/logger"
+	"github.com/ray-g/dnsproxy/utils"
+)
+
+func TestMain(m *testing.M) {
+	logger.SetOutput(ioutil.Discard)
+	logger.InitLogger("leases", false)
+	os.Exit(m.Run())
+}
+
+func TestLeases(t *testing.T) {
+	dir := t.TempDir()
+	later := time.Now().Add(time.Hour).Unix()
+	earlier := time.Now().Add(-time.Hour).Unix()
+
+	dnsmasq := filepath.Join(dir, "dnsmasq.leases")
+	content := fmt.Sprintf("%d aa:bb:cc:dd:ee:01 192.168.1.10 Laptop *\n", later) +
+		fmt.Sprintf("%d 1234 fd00::10 laptop *\n", later) +
+		fmt.Sprintf("%d aa:bb:cc:dd:ee:02 192.168.1.11 gone *\n", earlier) +
+		"0 aa:bb:cc:dd:ee:03 192.168.1.12 bad_name *\n" +
+		"0 aa:bb:cc:dd:ee:04 192.168.1.13 printer.home *\n"
+	if err := ioutil.WriteFile(dnsmasq, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	isc := filepath.Join(dir, "dhcpd.leases")
+	content = "lease 192.168.1.11 {\n  ends never;\n  binding state active;\n  client-hostname \"back\";\n}\n"
+	if err := ioutil.WriteFile(isc, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	l := &Leases{
+		config: &conf.LeasesConfig{Files: []conf.LeaseFileConfig{{File: dnsmasq}, {Format: "isc", File: isc}}},
+		domain: "lan",
+	}
+	l.load()
+
+	tests := []struct {
+		name   string
+		family int
+		ips    []string
+		ok     bool
+	}{
+		{"laptop.lan", utils.IPv4Query, []string{"192.168.1.10"}, true},
+		{"LAPTOP.lan", utils.IPv6Query, []string{"fd00::10"}, true},
+		{"printer.lan", utils.IPv6Query, nil, true},
+		{"printer.lan", utils.IPv4Query, []string{"192.168.1.13"}, true},
+		{"back.lan", utils.IPv4Query, []string{"192.168.1.11"}, true},
+		{"gone.lan", utils.IPv4Query, nil, false},
+		{"bad_name.lan", utils.IPv4Query, nil, false},
+		{"laptop", utils.IPv4Query, nil, false},
+	}
+
+	for _, test := range tests {
+		ips, _, ok := l.Get(test.name, test.family)
+		var got []string
+		for _, ip := range ips {
+			got = append(got, ip.String())
+		}
+		if ok != test.ok || !reflect.DeepEqual(got, test.ips) {
+			t.Errorf("Get(%s, %d) = %v, %v, want %v, %v", test.name, test.family, got, ok, test.ips, test.ok)
+		}
+	}
+
+	if _, ttl, _ := l.Get("laptop.lan", utils.IPv4Query); ttl == 0 || ttl > 3600 {
+		t.Errorf("ttl of laptop.lan = %d", ttl)
+	}
+
+	for ip, want := range map[string][]string{
+		"192.168.1.10": {"laptop.lan"},
+		"fd00::10":     {"laptop.lan"},
+		"192.168.1.11": {"back.lan"},
+		"192.168.1.12": nil,
+	} {
+		arpa, _ := dns.ReverseAddr(ip)
+		if names, ok := l.Reverse(arpa); ok != (want != nil) || !reflect.DeepEqual(names, want) {
+			t.Errorf("Reverse(%s) = %v, %v, want %v", ip, names, ok, want)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package leases
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Lease is a DHCP lease, a zero Expires never expires
+type Lease struct {
+	Hostname string
+	IP       net.IP
+	Expires  time.Time
+	Active   bool
+}
+
+// Expired reports whether the lease ended by now
+func (l *Lease) Expired(now time.Time) bool {
+	return !l.Active || (!l.Expires.IsZero() && !now.Before(l.Expires))
+}
+
+type parser func(r io.Reader) ([]Lease, error)
+
+var parsers = map[string]parser{
+	"":        parseDnsmasq,
+	"dnsmasq": parseDnsmasq,
+	"isc":     parseISC,
+	"kea":     parseKea,
+}
+
+// parseDnsmasq reads a dnsmasq.leases file, "<expiry> <mac|iaid> <ip>
+// <hostname> <client-id>" lines with an expiry of 0 for infinite leases
+func parseDnsmasq(r io.Reader) ([]Lease, error) {
+	var leases []Lease
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[0] == "duid" {
+			continue
+		}
+
+		expiry, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		lease := Lease{Hostname: fields[3], IP: net.ParseIP(fields[2]), Active: true}
+		if expiry > 0 {
+			lease.Expires = time.Unix(expiry, 0)
+		}
+		if lease.Hostname == "*" {
+			lease.Hostname = ""
+		}
+
+		leases = append(leases, lease)
+	}
+
+	return leases, scanner.Err()
+}
+
+// stripComment removes a "#" comment outside of quotes from line
+func stripComment(line string) string {
+	quoted := false
+	for i, c := range line {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == '#' && !quoted:
+			return strings.TrimSpace(line[:i])
+		}
+	}
+	return line
+}
+
+// parseISC reads the lease blocks of an ISC dhcpd.leases file, later blocks
+// of an address supersede the earlier ones. A lease with an invalid end is
+// skipped.
+func parseISC(r io.Reader) ([]Lease, error) {
+	var (
+		leases  []Lease
+		lease   *Lease
+		depth   int
+		invalid bool
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := stripComment(strings.TrimSpace(scanner.Text()))
+		if line == "" {
+			continue
+		}
+
+		if lease == nil {
+			fields := strings.Fields(line)
+			if len(fields) == 3 && fields[0] == "lease" && fields[2] == "{" {
+				lease = &Lease{IP: net.ParseIP(fields[1]), Active: true}
+				depth = 1
+				invalid = false
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasSuffix(line, "{"):
+			depth++
+			continue
+		case line == "}":
+			depth--
+			if depth == 0 {
+				if !invalid {
+					leases = append(leases, *lease)
+				}
+				lease = nil
+			}
+			continue
+		case depth > 1:
+			continue
+		}
+
+		statement := strings.TrimSuffix(line, ";")
+		switch {
+		case strings.HasPrefix(statement, "binding state "):
+			lease.Active = strings.TrimPrefix(statement, "binding state ") == "active"
+		case strings.HasPrefix(statement, "client-hostname "):
+			lease.Hostname = strings.Trim(strings.TrimPrefix(statement, "client-hostname "), "\"")
+		case strings.HasPrefix(statement, "ends "):
+			expires, err := parseISCTime(strings.TrimPrefix(statement, "ends "))
+			invalid = invalid || err != nil
+			lease.Expires = expires
+		}
+	}
+
+	return leases, scanner.Err()
+}
+
+// parseISCTime parses "never", "epoch <seconds>" and "<weekday> yyyy/mm/dd
+// hh:mm:ss" UTC times
+func parseISCTime(s string) (time.Time, error) {
+	fields := strings.Fields(s)
+	switch {
+	case len(fields) == 1 && fields[0] == "never":
+		return time.Time{}, nil
+	case len(fields) == 2 && fields[0] == "epoch":
+		seconds, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(seconds, 0), nil
+	case len(fields) == 3:
+		return time.Parse("2006/01/02 15:04:05", fields[1]+" "+fields[2])
+	}
+
+	return time.Time{}, fmt.Errorf("unknown time %q", s)
+}
+
+// parseKea reads a Kea memfile lease CSV, v4 or v6, by the columns of its
+// header. Rows are appended as leases change, the last one of an address
+// is the current one.
+func parseKea(r io.Reader) ([]Lease, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range []string{"address", "expire", "hostname"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("column %s is missing", name)
+		}
+	}
+
+	field := func(row []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+
+	var leases []Lease
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if row[0] == "address" {
+			continue
+		}
+
+		expire, err := strconv.ParseInt(field(row, "expire"), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		// state 0 is the default state, declined and expired leases are not
+		state := field(row, "state")
+		leases = append(leases, Lease{
+			Hostname: strings.Replace(field(row, "hostname"), "&#x2c", ",", -1),
+			IP:       net.ParseIP(field(row, "address")),
+			Expires:  time.Unix(expire, 0),
+			Active:   state == "" || state == "0",
+		})
+	}
+
+	return leases, nil
+}
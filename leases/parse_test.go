@@ -0,0 +1,146 @@
+package leases
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type lease struct {
+	hostname string
+	ip       string
+	expires  int64
+	active   bool
+}
+
+func leasesOf(leases []Lease) []lease {
+	var out []lease
+	for _, l := range leases {
+		var expires int64
+		if !l.Expires.IsZero() {
+			expires = l.Expires.Unix()
+		}
+		out = append(out, lease{l.Hostname, l.IP.String(), expires, l.Active})
+	}
+	return out
+}
+
+func TestParsers(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		content string
+		leases  []lease
+	}{
+		{
+			"dnsmasq",
+			"dnsmasq",
+			"1792400400 aa:bb:cc:dd:ee:01 192.168.1.10 laptop 01:aa:bb:cc:dd:ee:01\n" +
+				"0 aa:bb:cc:dd:ee:02 192.168.1.11 * *\n" +
+				"duid 00:01:00:01:2a:3b:4c:5d:aa:bb:cc:dd:ee:ff\n" +
+				"1792400400 1234 fd00::12 phone 00:01:00:01\n" +
+				"soon aa:bb:cc:dd:ee:03 192.168.1.12 broken *\n",
+			[]lease{
+				{"laptop", "192.168.1.10", 1792400400, true},
+				{"", "192.168.1.11", 0, true},
+				{"phone", "fd00::12", 1792400400, true},
+			},
+		},
+		{
+			"isc",
+			"isc",
+			"# The format of this file is documented in dhcpd.leases(5)\n" +
+				"lease 192.168.1.20 {\n" +
+				"  starts 4 2026/10/15 07:00:00;\n" +
+				"  ends 4 2026/10/19 07:00:00; # renewed\n" +
+				"  binding state active;\n" +
+				"  client-hostname \"desk#1\";\n" +
+				"  option agent.circuit-id {\n" +
+				"    ends never;\n" +
+				"  }\n" +
+				"}\n" +
+				"lease 192.168.1.21 {\n" +
+				"  ends epoch 1792400400; # Mon Oct 19 07:00:00 2026\n" +
+				"  binding state free;\n" +
+				"  client-hostname \"tv\";\n" +
+				"}\n" +
+				"lease 192.168.1.22 {\n" +
+				"  ends someday;\n" +
+				"  binding state active;\n" +
+				"  client-hostname \"broken\";\n" +
+				"}\n" +
+				"lease 192.168.1.23 {\n" +
+				"  ends never;\n" +
+				"  client-hostname \"printer\";\n" +
+				"}\n",
+			[]lease{
+				{"desk#1", "192.168.1.20", time.Date(2026, 10, 19, 7, 0, 0, 0, time.UTC).Unix(), true},
+				{"tv", "192.168.1.21", 1792400400, false},
+				{"printer", "192.168.1.23", 0, true},
+			},
+		},
+		{
+			"kea v4",
+			"kea",
+			"address,hwaddr,client_id,valid_lifetime,expire,subnet_id,fqdn_fwd,fqdn_rev,hostname,state,user_context\n" +
+				"192.168.1.30,aa:bb:cc:dd:ee:30,,3600,1792400400,1,0,0,nas,0,\n" +
+				"192.168.1.31,aa:bb:cc:dd:ee:31,,3600,1792400400,1,0,0,old,1,\n" +
+				"address,hwaddr,client_id,valid_lifetime,expire,subnet_id,fqdn_fwd,fqdn_rev,hostname,state,user_context\n" +
+				"192.168.1.32,aa:bb:cc:dd:ee:32,,3600,never,1,0,0,broken,0,\n" +
+				"192.168.1.33,aa:bb:cc:dd:ee:33,,3600,1792400400,1,0,0,a&#x2cb,0,\n",
+			[]lease{
+				{"nas", "192.168.1.30", 1792400400, true},
+				{"old", "192.168.1.31", 1792400400, false},
+				{"a,b", "192.168.1.33", 1792400400, true},
+			},
+		},
+		{
+			"kea v6",
+			"kea",
+			"address,duid,valid_lifetime,expire,subnet_id,pref_lifetime,lease_type,iaid,prefix_len,fqdn_fwd,fqdn_rev,hostname,hwaddr\n" +
+				"fd00::40,00:01:00:01,3600,1792400400,1,1800,0,1,128,0,0,tablet,\n",
+			[]lease{
+				{"tablet", "fd00::40", 1792400400, true},
+			},
+		},
+		{"kea empty", "kea", "", nil},
+	}
+
+	for _, test := range tests {
+		leases, err := parsers[test.format](strings.NewReader(test.content))
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if got := leasesOf(leases); !reflect.DeepEqual(got, test.leases) {
+			t.Errorf("%s: leases %v, want %v", test.name, got, test.leases)
+		}
+	}
+
+	if _, err := parseKea(strings.NewReader("address,expire\n192.168.1.30,1792400400\n")); err == nil {
+		t.Error("kea file without a hostname column parsed")
+	}
+}
+
+func TestParseISCTime(t *testing.T) {
+	tests := []struct {
+		s       string
+		expires time.Time
+		valid   bool
+	}{
+		{"never", time.Time{}, true},
+		{"epoch 1792400400", time.Unix(1792400400, 0), true},
+		{"4 2026/10/19 07:00:00", time.Date(2026, 10, 19, 7, 0, 0, 0, time.UTC), true},
+		{"4 2026/13/19 07:00:00", time.Time{}, false},
+		{"epoch soon", time.Time{}, false},
+		{"tomorrow", time.Time{}, false},
+	}
+
+	for _, test := range tests {
+		expires, err := parseISCTime(test.s)
+		if (err == nil) != test.valid || !expires.Equal(test.expires) {
+			t.Errorf("parseISCTime(%q) = %v, %v", test.s, expires, err)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"io"
 	"os"
 
 	"github.com/op/go-logging"
@@ -9,8 +10,14 @@ import (
 var (
 	logger    *logging.Logger
 	debugMode bool
+	output    io.Writer = os.Stdout
 )
 
+// SetOutput sets where InitLogger writes the log, stdout by default
+func SetOutput(w io.Writer) {
+	output = w
+}
+
 // InitLogger initialize logging instance
 // It MUST be called and can only be called 1 time
 func InitLogger(name string, debug bool) {
@@ -22,7 +29,7 @@ func InitLogger(name string, debug bool) {
 	}
 
 	logging.SetFormatter(logging.MustStringFormatter(format))
-	logging.SetBackend(logging.NewLogBackend(os.Stdout, "", 0))
+	logging.SetBackend(logging.NewLogBackend(output, "", 0))
 
 	if debug {
 		logging.SetLevel(logging.DEBUG, name)
@@ -8,6 +8,15 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "blocklist":
+			os.Exit(dnsproxy.Blocklist(os.Args[2:]))
+		case "import":
+			os.Exit(dnsproxy.Import(os.Args[2:]))
+		}
+	}
+
 	dnsproxy.Serve(os.Args[1])
 	utils.WaitSysSignal()
 }
@@ -0,0 +1,357 @@
+package records
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+
+	conf "github.com/ray-g/dnsproxy/config"
+	"github.com/ray-g/dnsproxy/logger"
+	"github.com/ray-g/dnsproxy/stats"
+)
+
+var (
+	// ErrInvalid is returned for records that can't be served
+	ErrInvalid = errors.New("invalid record")
+	// ErrNotFound is returned for unknown record ids
+	ErrNotFound = errors.New("record not found")
+)
+
+// Types are the supported record types
+var Types = []string{"A", "AAAA", "CNAME", "TXT", "MX", "SRV"}
+
+// Record is a custom record, Value is the RDATA in zone file format, as
+// "10 mail.example.com" for MX
+type Record struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	TTL   uint32 `json:"ttl"`
+
+	rr dns.RR
+}
+
+// store holds the records served under the config they were loaded with
+type store struct {
+	config  conf.RecordsConfig
+	records []*Record
+	names   map[string][]*Record
+	reverse map[string][]string
+	lastID  int
+}
+
+var (
+	mu      sync.RWMutex
+	current = &store{
+		names:   make(map[string][]*Record),
+		reverse: make(map[string][]string),
+	}
+)
+
+// Load reads the records of the state file of c, a missing file has none
+func Load(c *conf.RecordsConfig) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var loaded []*Record
+	if c.StateFile != "" {
+		data, err := ioutil.ReadFile(c.StateFile)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return err
+		default:
+			if err := json.Unmarshal(data, &loaded); err != nil {
+				return fmt.Errorf("error reading %s: %s", c.StateFile, err)
+			}
+		}
+	}
+
+	for _, r := range loaded {
+		if err := r.parse(c.TTL); err != nil {
+			return fmt.Errorf("error reading %s: %s", c.StateFile, err)
+		}
+	}
+
+	current.config = *c
+	current.apply(loaded)
+	logger.Debugf("%d custom records loaded", len(current.records))
+
+	return nil
+}
+
+// parse validates r and builds its resource record, a record without a TTL
+// gets ttl
+func (r *Record) parse(ttl uint32) error {
+	r.Name = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(r.Name), "."))
+	r.Type = strings.ToUpper(strings.TrimSpace(r.Type))
+	r.Value = strings.TrimSpace(r.Value)
+
+	if _, ok := dns.IsDomainName(r.Name); !ok || r.Name == "" {
+		return fmt.Errorf("%w: illegal name %q", ErrInvalid, r.Name)
+	}
+
+	known := false
+	for _, t := range Types {
+		known = known || t == r.Type
+	}
+	if !known {
+		return fmt.Errorf("%w: unsupported type %q", ErrInvalid, r.Type)
+	}
+
+	if r.TTL == 0 {
+		r.TTL = ttl
+	}
+
+	value := r.Value
+	switch r.Type {
+	case "A":
+		if ip := net.ParseIP(value); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("%w: illegal IPv4 address %q", ErrInvalid, value)
+		}
+	case "AAAA":
+		if ip := net.ParseIP(value); ip == nil || ip.To4() != nil {
+			return fmt.Errorf("%w: illegal IPv6 address %q", ErrInvalid, value)
+		}
+	case "TXT":
+		if !strings.HasPrefix(value, "\"") {
+			value = "\"" + strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(value) + "\""
+		}
+	}
+
+	rr, err := dns.NewRR(fmt.Sprintf("%s. %d IN %s %s", r.Name, r.TTL, r.Type, value))
+	if err != nil || rr == nil {
+		return fmt.Errorf("%w: illegal %s value %q", ErrInvalid, r.Type, r.Value)
+	}
+	r.rr = rr
+
+	return nil
+}
+
+// check rejects r when it conflicts with the other records of its name
+func check(list []*Record, r *Record) error {
+	for _, other := range list {
+		if other.ID == r.ID || other.Name != r.Name {
+			continue
+		}
+		if other.Type == "CNAME" || r.Type == "CNAME" {
+			return fmt.Errorf("%w: %s has other records than its CNAME", ErrInvalid, r.Name)
+		}
+		if dns.IsDuplicate(other.rr, r.rr) {
+			return fmt.Errorf("%w: %s %s %s exists as record %d", ErrInvalid, r.Name, r.Type, r.Value, other.ID)
+		}
+	}
+	return nil
+}
+
+// apply replaces the records and counts the names gained and lost, ids
+// of saved records are not handed out again
+func (s *store) apply(list []*Record) {
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	updated := make(map[string][]*Record)
+	updatedReverse := make(map[string][]string)
+	for _, r := range list {
+		updated[r.Name] = append(updated[r.Name], r)
+		if r.ID > s.lastID {
+			s.lastID = r.ID
+		}
+
+		var ip net.IP
+		switch v := r.rr.(type) {
+		case *dns.A:
+			ip = v.A
+		case *dns.AAAA:
+			ip = v.AAAA
+		}
+		if arpa, err := dns.ReverseAddr(ip.String()); ip != nil && err == nil {
+			updatedReverse[arpa] = append(updatedReverse[arpa], r.Name)
+		}
+	}
+
+	for name := range updated {
+		if _, ok := s.names[name]; !ok {
+			stats.AddCustomDomain()
+		}
+	}
+	for name := range s.names {
+		if _, ok := updated[name]; !ok {
+			stats.RemoveCustomDomain()
+		}
+	}
+
+	s.records = list
+	s.names = updated
+	s.reverse = updatedReverse
+}
+
+// save writes list to the state file
+func (s *store) save(list []*Record) error {
+	if s.config.StateFile == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.config.StateFile), ".records")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.config.StateFile)
+}
+
+// change applies fn to a copy of the records, the result is saved before it
+// is served
+func change(fn func(s *store, list []*Record) ([]*Record, error)) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	list, err := fn(current, append([]*Record{}, current.records...))
+	if err != nil {
+		return err
+	}
+
+	if err := current.save(list); err != nil {
+		return fmt.Errorf("error saving records: %s", err)
+	}
+
+	current.apply(list)
+	return nil
+}
+
+// List returns the records ordered by id
+func List() []Record {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	list := make([]Record, len(current.records))
+	for i, r := range current.records {
+		list[i] = *r
+	}
+	return list
+}
+
+// Get returns the record with id
+func Get(id int) (Record, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for _, r := range current.records {
+		if r.ID == id {
+			return *r, nil
+		}
+	}
+	return Record{}, ErrNotFound
+}
+
+// Add creates r with a new id
+func Add(r Record) (Record, error) {
+	err := change(func(s *store, list []*Record) ([]*Record, error) {
+		if err := r.parse(s.config.TTL); err != nil {
+			return nil, err
+		}
+		r.ID = s.lastID + 1
+		if err := check(list, &r); err != nil {
+			return nil, err
+		}
+
+		return append(list, &r), nil
+	})
+
+	return r, err
+}
+
+// Update replaces the record with id by r
+func Update(id int, r Record) (Record, error) {
+	err := change(func(s *store, list []*Record) ([]*Record, error) {
+		for i, old := range list {
+			if old.ID != id {
+				continue
+			}
+
+			r.ID = id
+			if err := r.parse(s.config.TTL); err != nil {
+				return nil, err
+			}
+			if err := check(list, &r); err != nil {
+				return nil, err
+			}
+
+			list[i] = &r
+			return list, nil
+		}
+		return nil, ErrNotFound
+	})
+
+	return r, err
+}
+
+// Delete removes the record with id
+func Delete(id int) error {
+	return change(func(_ *store, list []*Record) ([]*Record, error) {
+		for i, r := range list {
+			if r.ID == id {
+				return append(list[:i], list[i+1:]...), nil
+			}
+		}
+		return nil, ErrNotFound
+	})
+}
+
+// Lookup returns the records of name with qtype, or its CNAME. ok is set for
+// every name with custom records.
+func Lookup(name string, qtype uint16) ([]dns.RR, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	list, ok := current.names[strings.ToLower(strings.TrimSuffix(name, "."))]
+	if !ok {
+		return nil, false
+	}
+
+	var answer []dns.RR
+	for _, r := range list {
+		rrtype := r.rr.Header().Rrtype
+		if rrtype == qtype || qtype == dns.TypeANY || rrtype == dns.TypeCNAME {
+			rr := dns.Copy(r.rr)
+			rr.Header().Name = dns.Fqdn(name)
+			answer = append(answer, rr)
+		}
+	}
+	return answer, true
+}
+
+// Reverse returns the names of the address of the reverse name arpa
+func Reverse(arpa string) ([]string, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	list, ok := current.reverse[strings.ToLower(arpa)]
+	return list, ok
+}
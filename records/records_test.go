@@ -0,0 +1,134 @@
+package records
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	conf "github.com/ray-g/dnsproxy/config"
+	"github.com/ray-g/dnsproxy/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.SetOutput(ioutil.Discard)
+	logger.InitLogger("records", false)
+	os.Exit(m.Run())
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		record Record
+		rr     string
+		valid  bool
+	}{
+		{Record{Name: "NAS.lan.", Type: "a", Value: "192.168.1.2"}, "nas.lan.\t300\tIN\tA\t192.168.1.2", true},
+		{Record{Name: "nas.lan", Type: "AAAA", Value: "fd00::2", TTL: 60}, "nas.lan.\t60\tIN\tAAAA\tfd00::2", true},
+		{Record{Name: "www.lan", Type: "CNAME", Value: "nas.lan"}, "www.lan.\t300\tIN\tCNAME\tnas.lan.", true},
+		{Record{Name: "lan", Type: "TXT", Value: `say "hi"`}, "lan.\t300\tIN\tTXT\t\"say \\\"hi\\\"\"", true},
+		{Record{Name: "lan", Type: "MX", Value: "10 mail.lan."}, "lan.\t300\tIN\tMX\t10 mail.lan.", true},
+		{Record{Name: "_sip._tcp.lan", Type: "SRV", Value: "10 5 5060 pbx.lan."}, "_sip._tcp.lan.\t300\tIN\tSRV\t10 5 5060 pbx.lan.", true},
+		{Record{Name: "nas.lan", Type: "A", Value: "fd00::2"}, "", false},
+		{Record{Name: "nas.lan", Type: "AAAA", Value: "192.168.1.2"}, "", false},
+		{Record{Name: "nas.lan", Type: "PTR", Value: "nas.lan."}, "", false},
+		{Record{Name: "lan", Type: "MX", Value: "mail.lan."}, "", false},
+		{Record{Name: "", Type: "A", Value: "192.168.1.2"}, "", false},
+	}
+
+	for _, test := range tests {
+		r := test.record
+		err := r.parse(300)
+		switch {
+		case test.valid && err != nil:
+			t.Errorf("parse(%+v): %s", test.record, err)
+		case !test.valid && !errors.Is(err, ErrInvalid):
+			t.Errorf("parse(%+v) = %v, want ErrInvalid", test.record, err)
+		case test.valid && r.rr.String() != test.rr:
+			t.Errorf("parse(%+v) = %q, want %q", test.record, r.rr.String(), test.rr)
+		}
+	}
+}
+
+func TestRecords(t *testing.T) {
+	state := filepath.Join(t.TempDir(), "records.json")
+	if err := Load(&conf.RecordsConfig{StateFile: state, TTL: 120}); err != nil {
+		t.Fatal(err)
+	}
+
+	nas, err := Add(Record{Name: "nas.lan", Type: "A", Value: "192.168.1.2"})
+	if err != nil || nas.ID != 1 || nas.TTL != 120 {
+		t.Fatalf("Add = %+v, %v", nas, err)
+	}
+	if _, err := Add(Record{Name: "www.lan", Type: "CNAME", Value: "nas.lan"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range []Record{
+		{Name: "NAS.lan", Type: "A", Value: "192.168.1.2"},
+		{Name: "nas.lan", Type: "CNAME", Value: "other.lan"},
+		{Name: "www.lan", Type: "A", Value: "192.168.1.3"},
+	} {
+		if _, err := Add(r); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Add(%+v) = %v, want ErrInvalid", r, err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		qtype  uint16
+		answer int
+		ok     bool
+	}{
+		{"NAS.lan.", dns.TypeA, 1, true},
+		{"nas.lan.", dns.TypeAAAA, 0, true},
+		{"www.lan.", dns.TypeA, 1, true},
+		{"www.lan.", dns.TypeTXT, 1, true},
+		{"other.lan.", dns.TypeA, 0, false},
+	}
+	for _, test := range tests {
+		answer, ok := Lookup(test.name, test.qtype)
+		if ok != test.ok || len(answer) != test.answer {
+			t.Errorf("Lookup(%s, %s) = %v, %v", test.name, dns.TypeToString[test.qtype], answer, ok)
+		}
+		for _, rr := range answer {
+			if rr.Header().Name != test.name {
+				t.Errorf("Lookup(%s) answered for %s", test.name, rr.Header().Name)
+			}
+		}
+	}
+
+	if names, ok := Reverse("2.1.168.192.in-addr.arpa."); !ok || len(names) != 1 || names[0] != "nas.lan" {
+		t.Errorf("Reverse = %v, %v", names, ok)
+	}
+
+	if _, err := Update(1, Record{Name: "nas.lan", Type: "A", Value: "192.168.1.4"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Reverse("2.1.168.192.in-addr.arpa."); ok {
+		t.Error("updated address still reverses")
+	}
+	if _, err := Update(9, Record{Name: "nas.lan", Type: "A", Value: "192.168.1.4"}); err != ErrNotFound {
+		t.Errorf("Update of an unknown id = %v", err)
+	}
+
+	if err := Delete(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := Delete(2); err != ErrNotFound {
+		t.Errorf("second Delete = %v", err)
+	}
+
+	// the state file survives a reload, ids are not reused
+	if err := Load(&conf.RecordsConfig{StateFile: state, TTL: 120}); err != nil {
+		t.Fatal(err)
+	}
+	if list := List(); len(list) != 1 || list[0].Value != "192.168.1.4" {
+		t.Errorf("reloaded records %+v", list)
+	}
+	if r, err := Add(Record{Name: "tv.lan", Type: "A", Value: "192.168.1.5"}); err != nil || r.ID != 3 {
+		t.Errorf("Add after reload = %+v, %v", r, err)
+	}
+}
@@ -0,0 +1,127 @@
+package resolver
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"github.com/ray-g/dnsproxy/blocker"
+	conf "github.com/ray-g/dnsproxy/config"
+	"github.com/ray-g/dnsproxy/iptree"
+)
+
+// EDNS0 local options used by dnsmasq to identify clients
+const (
+	ednsMAC   = 65001
+	ednsCPEID = 65074
+)
+
+// ClientGroup is a group of clients sharing a filtering policy
+type ClientGroup struct {
+	Name        string
+	filter      *blocker.Filter
+	block       *blocker.Response
+	nameservers []string
+	safeSearch  *bool
+}
+
+// Filter returns the blocking policy of g, nil for the global one
+func (g *ClientGroup) Filter() *blocker.Filter {
+	if g == nil {
+		return nil
+	}
+	return g.filter
+}
+
+// ClientGroups matches clients to their group
+type ClientGroups struct {
+	networks *iptree.Tree
+	ids      map[string]*ClientGroup
+}
+
+// NewClientGroups builds the client groups from config, their block
+// responses inherit from parent
+func NewClientGroups(configs []conf.ClientGroupConfig, parent *blocker.Response) (*ClientGroups, error) {
+	groups := &ClientGroups{
+		networks: iptree.New(),
+		ids:      make(map[string]*ClientGroup),
+	}
+
+	for _, config := range configs {
+		block, err := blocker.NewResponse(&config.Block)
+		if err == nil {
+			err = block.Inherit(parent).Validate()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error in block response of group %s: %s", config.Name, err)
+		}
+
+		group := &ClientGroup{
+			Name:        config.Name,
+			filter:      blocker.NewFilter(&config),
+			block:       block,
+			nameservers: config.Nameservers,
+			safeSearch:  config.SafeSearch,
+		}
+
+		for _, client := range config.Clients {
+			if strings.HasPrefix(client, "mac:") || strings.HasPrefix(client, "id:") {
+				groups.ids[strings.ToLower(client)] = group
+				continue
+			}
+
+			if err := groups.networks.InsertString(client, group); err != nil {
+				return nil, fmt.Errorf("invalid client %s of group %s: %s", client, config.Name, err)
+			}
+		}
+	}
+
+	return groups, nil
+}
+
+// Lookup returns the group of the client sending req, nil when it has none.
+// EDNS identifiers take precedence over the client address.
+func (g *ClientGroups) Lookup(w dns.ResponseWriter, req *dns.Msg) *ClientGroup {
+	if opt := req.IsEdns0(); opt != nil && len(g.ids) > 0 {
+		for _, o := range opt.Option {
+			local, ok := o.(*dns.EDNS0_LOCAL)
+			if !ok {
+				continue
+			}
+
+			var id string
+			switch local.Code {
+			case ednsMAC:
+				id = "mac:" + net.HardwareAddr(local.Data).String()
+			case ednsCPEID:
+				id = "id:" + strings.ToLower(string(local.Data))
+			default:
+				continue
+			}
+
+			if group, ok := g.ids[id]; ok {
+				return group
+			}
+		}
+	}
+
+	if ip := clientIP(w.RemoteAddr()); ip != nil {
+		if group, ok := g.networks.Lookup(ip); ok {
+			return group.(*ClientGroup)
+		}
+	}
+
+	return nil
+}
+
+func clientIP(addr net.Addr) net.IP {
+	switch v := addr.(type) {
+	case *net.UDPAddr:
+		return v.IP
+	case *net.TCPAddr:
+		return v.IP
+	}
+	return nil
+}
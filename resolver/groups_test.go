@@ -0,0 +1,107 @@
+package resolver
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"github.com/ray-g/dnsproxy/blocker"
+	conf "github.com/ray-g/dnsproxy/config"
+)
+
+func TestClientGroupsLookup(t *testing.T) {
+	groups, err := NewClientGroups([]conf.ClientGroupConfig{
+		{Name: "lan", Clients: []string{"192.168.0.0/16", "fd00::/8"}},
+		{Name: "kids", Clients: []string{"192.168.2.0/24", "mac:AA:BB:CC:DD:EE:FF"}},
+		{Name: "tablet", Clients: []string{"192.168.2.50", "id:Tablet-1"}},
+	}, &blocker.Response{Mode: blocker.ModeNull})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mac, _ := net.ParseMAC("aa:bb:cc:dd:ee:ff")
+	tests := []struct {
+		client string
+		opts   []dns.EDNS0
+		group  string
+	}{
+		{"192.168.1.10", nil, "lan"},
+		{"192.168.2.10", nil, "kids"},
+		{"192.168.2.50", nil, "tablet"},
+		{"fd00::10", nil, "lan"},
+		{"10.0.0.10", nil, ""},
+		{"10.0.0.10", []dns.EDNS0{&dns.EDNS0_LOCAL{Code: ednsMAC, Data: mac}}, "kids"},
+		{"192.168.2.50", []dns.EDNS0{&dns.EDNS0_LOCAL{Code: ednsMAC, Data: mac}}, "kids"},
+		{"10.0.0.10", []dns.EDNS0{&dns.EDNS0_LOCAL{Code: ednsCPEID, Data: []byte("TABLET-1")}}, "tablet"},
+		{"192.168.1.10", []dns.EDNS0{&dns.EDNS0_LOCAL{Code: ednsCPEID, Data: []byte("other")}}, "lan"},
+		{"10.0.0.10", []dns.EDNS0{&dns.EDNS0_LOCAL{Code: 65002, Data: mac}}, ""},
+	}
+
+	for _, test := range tests {
+		req := new(dns.Msg)
+		req.SetQuestion("www.example.", dns.TypeA)
+		if test.opts != nil {
+			req.SetEdns0(4096, false)
+			req.IsEdns0().Option = test.opts
+		}
+
+		w := &fakeWriter{remote: &net.UDPAddr{IP: net.ParseIP(test.client), Port: 5353}}
+		var name string
+		if group := groups.Lookup(w, req); group != nil {
+			name = group.Name
+		}
+		if name != test.group {
+			t.Errorf("group of %s with %v = %q, want %q", test.client, test.opts, name, test.group)
+		}
+	}
+
+	if _, err := NewClientGroups([]conf.ClientGroupConfig{{Name: "bad", Clients: []string{"not-an-ip"}}}, &blocker.Response{Mode: blocker.ModeNull}); err == nil {
+		t.Error("invalid client accepted")
+	}
+}
+
+func TestClientGroupAnswers(t *testing.T) {
+	global := startUpstream(t, "www.example. 60 IN A 192.0.2.1")
+	local := startUpstream(t, "www.example. 60 IN A 10.0.0.1")
+
+	config := testConfig(t, global)
+	config.Blocker.Blocklist = []string{"ads.example"}
+	config.Resolver.Groups = []conf.ClientGroupConfig{
+		{Name: "office", Clients: []string{"10.0.0.0/8"}, Nameservers: []string{local.addr}, Whitelist: []string{"ads.example"}},
+		{Name: "kids", Clients: []string{"192.168.2.0/24"}, Blocklist: []string{"games.example"}},
+	}
+	h := newTestHandler(t, config)
+
+	tests := []struct {
+		client  string
+		name    string
+		answers []string
+	}{
+		{"192.168.1.10", "www.example", []string{"192.0.2.1"}},
+		{"10.0.0.10", "www.example", []string{"10.0.0.1"}},
+		{"192.168.1.10", "www.example", []string{"192.0.2.1"}},
+		{"10.0.0.10", "www.example", []string{"10.0.0.1"}},
+		{"192.168.1.10", "ads.example", []string{"0.0.0.0"}},
+		{"192.168.2.10", "games.example", []string{"0.0.0.0"}},
+		{"192.168.1.10", "games.example", nil},
+	}
+
+	for _, test := range tests {
+		m := exchange(t, h, test.client, test.name, dns.TypeA)
+		if got := answers(m); !reflect.DeepEqual(got, test.answers) {
+			t.Errorf("%s from %s = %v, want %v", test.name, test.client, got, test.answers)
+		}
+	}
+
+	// the group answers are cached apart
+	for key, exists := range map[string]bool{"@www.example": true, "office@www.example": true, "kids@www.example": false} {
+		if h.cache.Exists(key) != exists {
+			t.Errorf("cache key %s exists = %v, want %v", key, !exists, exists)
+		}
+	}
+	if m := exchange(t, h, "10.0.0.10", "ads.example", dns.TypeA); m.Rcode != dns.RcodeNameError {
+		t.Errorf("whitelisted ads.example from office = %s %v, want the upstream NXDOMAIN", dns.RcodeToString[m.Rcode], answers(m))
+	}
+}
@@ -1,23 +1,23 @@
 package resolver
 
 import (
+	"errors"
 	"net"
+	"strings"
 	"time"
 
 	"github.com/miekg/dns"
 
+	"github.com/ray-g/dnsproxy/blocker"
 	c "github.com/ray-g/dnsproxy/cache"
 	r "github.com/ray-g/dnsproxy/cache/record"
 	conf "github.com/ray-g/dnsproxy/config"
 	h "github.com/ray-g/dnsproxy/hosts"
+	"github.com/ray-g/dnsproxy/leases"
 	"github.com/ray-g/dnsproxy/logger"
 	"github.com/ray-g/dnsproxy/stats"
 	"github.com/ray-g/dnsproxy/utils"
-)
-
-var (
-	nullroute   = net.ParseIP("0.0.0.0")
-	nullroutev6 = net.ParseIP("0:0:0:0:0:0:0:0")
+	"github.com/ray-g/dnsproxy/zones"
 )
 
 // Question type
@@ -34,10 +34,17 @@ func (q *Question) String() string {
 
 // DNSHandler type
 type DNSHandler struct {
-	config   *conf.DNSResolverConfig
-	resolver *Resolver
-	cache    c.Cache
-	hosts    *h.Hosts
+	config     *conf.DNSResolverConfig
+	resolver   *Resolver
+	cache      c.Cache
+	hosts      *h.Hosts
+	block      *blocker.Response
+	groups     *ClientGroups
+	safeSearch *SafeSearch
+	rewrites   *Rewrites
+	specialUse *SpecialUse
+	zones      *zones.Zones
+	leases     *leases.Leases
 }
 
 // DNSOperationData type
@@ -63,129 +70,244 @@ func NewHandler(config *conf.DNSResolverConfig, cache c.Cache) *DNSHandler {
 	}
 
 	if config.Hosts.Enable {
-		handler.hosts = h.NewHosts(&config.Hosts)
+		handler.hosts = h.NewHosts(&config.Hosts, handler.forget)
+	}
+
+	block, err := NewBlockResponse(config)
+	if err != nil {
+		logger.Fatalf("invalid block response config: %s", err)
+	}
+	handler.block = block
+	blocker.SetDefaultResponse(block)
+
+	groups, err := NewClientGroups(config.Groups, block)
+	if err != nil {
+		logger.Fatalf("invalid client groups config: %s", err)
+	}
+	handler.groups = groups
+	handler.safeSearch = NewSafeSearch(&config.SafeSearch)
+
+	rewrites, err := NewRewrites(config.Rewrites)
+	if err != nil {
+		logger.Fatalf("invalid rewrites config: %s", err)
+	}
+	handler.rewrites = rewrites
+
+	specialUse, err := NewSpecialUse(&config.SpecialUse)
+	if err != nil {
+		logger.Fatalf("invalid special-use domains config: %s", err)
+	}
+	handler.specialUse = specialUse
+
+	localZones, err := zones.New(config.Zones)
+	if err != nil {
+		logger.Fatalf("invalid zones config: %s", err)
+	}
+	handler.zones = localZones
+
+	if config.Leases.Enable {
+		if handler.leases, err = leases.New(&config.Leases); err != nil {
+			logger.Fatalf("invalid leases config: %s", err)
+		}
+	}
+
+	if config.Rebinding.Enable {
+		switch strings.ToLower(config.Rebinding.Mode) {
+		case "strip", "reject":
+		default:
+			logger.Fatalf("invalid rebinding protection mode %q", config.Rebinding.Mode)
+		}
 	}
 
 	return handler
 }
 
+// Close stops watching the hosts and lease files
+func (h *DNSHandler) Close() {
+	if h.hosts != nil {
+		h.hosts.Stop()
+	}
+	if h.leases != nil {
+		h.leases.Stop()
+	}
+}
+
+// forget drops the cached answers to names, of the resolver and the client
+// groups, so that changed hosts records apply at once. A "*.domain" name
+// drops the answers to every name below domain.
+func (h *DNSHandler) forget(names []string) {
+	prefixes := []string{c.GlobalPrefix}
+	for _, group := range h.config.Groups {
+		prefixes = append(prefixes, group.Name+"@")
+	}
+
+	var wildcards []string
+	for _, name := range names {
+		if strings.HasPrefix(name, "*.") {
+			wildcards = append(wildcards, name[1:])
+			continue
+		}
+		for _, prefix := range prefixes {
+			for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+				h.forgetKey(cacheKey(prefix, name, qtype))
+			}
+		}
+	}
+
+	if len(wildcards) > 0 {
+		for _, key := range h.cache.Keys() {
+			// the group prefix ends at the "@" that names do not contain
+			name := strings.TrimSuffix(key[strings.LastIndexByte(key, '@')+1:], ":AAAA")
+			for _, suffix := range wildcards {
+				if strings.HasSuffix(strings.ToLower(name), suffix) {
+					h.forgetKey(key)
+					break
+				}
+			}
+		}
+	}
+
+	logger.Debugf("%d changed hosts records dropped from cache", len(names))
+}
+
+// forgetKey removes the cached answer of key, blocked verdicts are kept
+func (h *DNSHandler) forgetKey(key string) {
+	if record, err := h.cache.Get(key); err == nil && !record.Blocked {
+		h.cache.Remove(key)
+	}
+}
+
 func (h *DNSHandler) do(Net string, w dns.ResponseWriter, req *dns.Msg) {
 	stats.AddQuery()
 
 	q := req.Question[0]
 	Q := Question{utils.UnFqdn(q.Name), dns.TypeToString[q.Qtype], dns.ClassToString[q.Qclass]}
-	key := Q.Qname
 
 	IPQuery := utils.IsIPQuery(q)
 
-	// Only query cache when qtype == 'A'|'AAAA' , qclass == 'IN'
-	if stats.Active() {
-		if IPQuery > 0 {
-			record, err := h.cache.Get(key)
-			if err != nil {
-				logger.Debugf("%s didn't hit cache", Q.String())
-			} else {
-				blocked := record.Blocked
-				if !blocked {
-					logger.Debugf("%s hit cache", Q.String())
-
-					// we need this copy against concurrent modification of Id
-					msg := *record.Msg
-					msg.Id = req.Id
-					h.WriteReplyMsg(w, &msg)
-					return
-				} else {
-					logger.Debugf("%s hit cache and was blocked: forwarding request", Q.String())
-
-					m := new(dns.Msg)
-					m.SetReply(req)
-
-					if h.config.NXDomainOnBlock {
-						m.SetRcode(req, dns.RcodeNameError)
-					} else {
-						switch IPQuery {
-						case utils.IPv4Query:
-							rrHeader := dns.RR_Header{
-								Name:   q.Name,
-								Rrtype: dns.TypeA,
-								Class:  dns.ClassINET,
-								Ttl:    h.config.TTL,
-							}
-							a := &dns.A{Hdr: rrHeader, A: nullroute}
-							m.Answer = append(m.Answer, a)
-						case utils.IPv6Query:
-							rrHeader := dns.RR_Header{
-								Name:   q.Name,
-								Rrtype: dns.TypeAAAA,
-								Class:  dns.ClassINET,
-								Ttl:    h.config.TTL,
-							}
-							a := &dns.AAAA{Hdr: rrHeader, AAAA: nullroutev6}
-							m.Answer = append(m.Answer, a)
-						}
-					}
-
-					h.WriteReplyMsg(w, m)
-
-					stats.AddQueryBlocked()
-					logger.Noticef("%s found in blocklist", Q.Qname)
-				}
+	group := h.groups.Lookup(w, req)
+	filter := group.Filter()
+	if group != nil {
+		logger.Debugf("%s from client group %s", Q.String(), group.Name)
+	}
+
+	up := h.upstreamFor(group)
+	key := cacheKey(up.prefix, Q.Qname, q.Qtype)
+
+	// Blocked names are checked for every qtype
+	if stats.BlockingActive() {
+		if source, ok := blocker.Match(h.cache, Q.Qname, filter); ok {
+			logger.Debugf("%s was blocked by %s", Q.String(), source)
+			if source == blocker.SourceDefaultDeny {
+				stats.AddQueryDenied()
 			}
+			h.writeBlocked(w, req, group, Q.Qname, source)
+			return
 		}
 
-		// Query hosts
-		if h.config.Hosts.Enable && IPQuery > 0 {
-			if ips, ok := h.hosts.Get(Q.Qname, IPQuery); ok {
-				mesg := new(dns.Msg)
-				mesg.SetReply(req)
-
-				switch IPQuery {
-				case utils.IPv4Query:
-					rr_header := dns.RR_Header{
-						Name:   q.Name,
-						Rrtype: dns.TypeA,
-						Class:  dns.ClassINET,
-						Ttl:    h.config.TTL,
-					}
-					for _, ip := range ips {
-						a := &dns.A{
-							Hdr: rr_header,
-							A:   ip,
-						}
-						mesg.Answer = append(mesg.Answer, a)
-					}
-				case utils.IPv6Query:
-					rr_header := dns.RR_Header{
-						Name:   q.Name,
-						Rrtype: dns.TypeAAAA,
-						Class:  dns.ClassINET,
-						Ttl:    h.config.TTL,
-					}
-					for _, ip := range ips {
-						aaaa := &dns.AAAA{
-							Hdr:  rr_header,
-							AAAA: ip,
-						}
-						mesg.Answer = append(mesg.Answer, aaaa)
-					}
-				}
+		// Names whose answers were blocked stay blocked until they expire
+		if record, ok := h.verdict(up, Q.Qname); ok {
+			logger.Debugf("%s was blocked by its answer in %s", Q.String(), record.Sources[0])
+			if record.Reason == r.ReasonAddress {
+				stats.AddQueryBlockedIP()
+			}
+			h.writeBlocked(w, req, group, Q.Qname, record.Sources[0])
+			return
+		}
+	}
 
-				w.WriteMsg(mesg)
+	// Rewrite search engines to their safe-search endpoints
+	if h.safeSearchEnabled(group) {
+		if target, ok := h.safeSearch.Target(Q.Qname); ok {
+			logger.Debugf("%s rewritten to safe search %s", Q.String(), target)
+			h.writeSafeSearch(Net, w, req, target, up)
+			return
+		}
+	}
 
-				ttl := time.Duration(h.config.TTL) * time.Second
-				h.cache.Set(key, r.NewCustomRecord(mesg, ttl))
-				logger.Debug("%s found in hosts file", Q.Qname)
-				stats.AddCustomDomain()
-				return
-			} else {
-				logger.Debug("%s didn't found in hosts file", Q.Qname)
-			}
+	// Answer rewritten names with their addresses or target names
+	if m, ok := h.rewriteAnswer(Net, req, up); ok {
+		logger.Debugf("%s answered from rewrites", Q.String())
+		h.WriteReplyMsg(w, m)
+		return
+	}
+
+	// Answer the custom records of the API
+	if m, ok := h.customAnswer(Net, req, up); ok {
+		logger.Debugf("%s answered from custom records", Q.String())
+		h.WriteReplyMsg(w, m)
+		return
+	}
+
+	// Answer the names of the local zones authoritatively
+	if m, ok := h.zones.Answer(req); ok {
+		logger.Debugf("%s answered from local zone", Q.String())
+		h.WriteReplyMsg(w, m)
+		return
+	}
+
+	// Answer reverse lookups of the local addresses
+	if m, ok := h.reverse(req); ok {
+		logger.Debugf("%s answered from local addresses", Q.String())
+		h.WriteReplyMsg(w, m)
+		return
+	}
+
+	// Resolve the hostnames of the DHCP leases, they expire with the lease
+	if m, ok := h.leasesAnswer(req); ok {
+		logger.Debugf("%s found in DHCP leases", Q.String())
+		h.WriteReplyMsg(w, m)
+		return
+	}
+
+	// Keep the special-use domains from the cache and the upstream
+	if m, ok := h.specialUseAnswer(req); ok {
+		logger.Debugf("%s answered as special-use domain", Q.String())
+		h.WriteReplyMsg(w, m)
+		return
+	}
+
+	// Only serve answers from cache when qtype == 'A'|'AAAA' , qclass == 'IN'
+	if stats.CachingActive() {
+		record, err := h.cache.Get(key)
+		if err != nil {
+			logger.Debugf("%s didn't hit cache", Q.String())
+		} else if !record.Blocked && IPQuery > 0 {
+			logger.Debugf("%s hit cache", Q.String())
+
+			// we need this copy against concurrent modification of Id
+			msg := *record.Msg
+			msg.Id = req.Id
+			h.WriteReplyMsg(w, &msg)
+			return
 		}
 	}
 
-	// Resolve from upstream DNS servers
-	mesg, err := h.resolver.Lookup(Net, req, h.config.Timeout, h.config.Interval, h.config.Nameservers, h.config.DoH.Enable, h.config.DoH.Endpoint)
+	// Query hosts, names of the hosts files are not forwarded and the
+	// missing family is answered with NODATA
+	if m, ok := h.hostsAnswer(req); ok {
+		h.WriteReplyMsg(w, m)
+		if len(m.Answer) == 0 {
+			logger.Debugf("%s has no %s record in hosts file", Q.Qname, Q.Qtype)
+			return
+		}
 
+		ttl := time.Duration(h.config.TTL) * time.Second
+		h.cache.Set(key, r.NewCustomRecord(m, ttl))
+		logger.Debugf("%s found in hosts file", Q.Qname)
+		stats.AddCustomDomain()
+		return
+	}
+
+	// Keep single-label names from leaking to the upstream
+	if m, ok := h.unqualifiedAnswer(req); ok {
+		logger.Debugf("%s answered as single-label name", Q.String())
+		h.WriteReplyMsg(w, m)
+		return
+	}
+
+	// Resolve from upstream DNS servers
+	mesg, err := h.lookup(Net, req, up)
 	if err != nil {
 		logger.Errorf("resolve query error %v", err)
 		h.HandleFailed(w, req)
@@ -193,17 +315,212 @@ func (h *DNSHandler) do(Net string, w dns.ResponseWriter, req *dns.Msg) {
 		return
 	}
 
+	ttl := h.minTTL(mesg)
+
+	if m, ok := h.screen(req, Q.Qname, mesg, up, ttl); ok {
+		if m != nil {
+			h.WriteReplyMsg(w, m)
+		}
+		return
+	}
+
+	h.WriteReplyMsg(w, mesg)
+
+	h.cacheAnswer(key, mesg, ttl)
+}
+
+// upstream is where queries are forwarded to
+type upstream struct {
+	nameservers []string
+	doh         bool
+	// prefix of the cache keys of the answers
+	prefix string
+	// group whose policy the answers pass, nil for the global one
+	group *ClientGroup
+}
+
+// upstreamFor returns the upstream of a client group. The answers to a group
+// are cached apart, they passed its own nameservers and filter.
+func (h *DNSHandler) upstreamFor(group *ClientGroup) *upstream {
+	up := &upstream{h.config.Nameservers, h.config.DoH.Enable, c.GlobalPrefix, group}
+	if group != nil {
+		up.prefix = group.Name + "@"
+		if len(group.nameservers) > 0 {
+			up.nameservers, up.doh = group.nameservers, false
+		}
+	}
+
+	return up
+}
+
+// lookup resolves req on the upstream, retrying truncated answers over tcp
+func (h *DNSHandler) lookup(Net string, req *dns.Msg, up *upstream) (*dns.Msg, error) {
+	mesg, err := h.resolver.Lookup(Net, req, h.config.Timeout, h.config.Interval, up.nameservers, up.doh, h.config.DoH.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
 	if mesg.Truncated && Net == "udp" {
-		mesg, err = h.resolver.Lookup("tcp", req, h.config.Timeout, h.config.Interval, h.config.Nameservers, h.config.DoH.Enable, h.config.DoH.Endpoint)
+		mesg, err = h.resolver.Lookup("tcp", req, h.config.Timeout, h.config.Interval, up.nameservers, up.doh, h.config.DoH.Endpoint)
 		if err != nil {
-			logger.Errorf("resolve tcp query error %v", err)
-			h.HandleFailed(w, req)
+			return nil, err
+		}
+	}
 
-			return
+	return mesg, nil
+}
+
+// screen checks the upstream answer mesg to name against CNAME cloaking, the
+// IP blocklist and DNS rebinding. A screened answer is replaced by the block
+// or refused reply to req, nil when a blocked query is dropped.
+func (h *DNSHandler) screen(req *dns.Msg, name string, mesg *dns.Msg, up *upstream, ttl time.Duration) (*dns.Msg, bool) {
+	filter := up.group.Filter()
+
+	// Block CNAME cloaked trackers hiding behind a first-party name
+	if stats.BlockingActive() && h.config.BlockCNAME && !filter.Whitelisted(name) {
+		if elem, source, ok := blocker.MatchChain(h.cache, mesg, filter); ok {
+			logger.Noticef("%s answer chain element %s found in blocklist", name, elem)
+			h.cacheVerdict(up, name, r.NewCloakedRecord(source, r.ReasonCNAME, ttl))
+			return h.blockedReply(req, up.group, name, source), true
+		}
+	}
+
+	// Block answers resolving into banned networks
+	if stats.BlockingActive() && !filter.Whitelisted(name) {
+		if ip, source, ok := blocker.MatchAddresses(mesg, filter); ok {
+			logger.Noticef("%s answer address %s found in IP blocklist %s", name, ip, source)
+			stats.AddQueryBlockedIP()
+			h.cacheVerdict(up, name, r.NewCloakedRecord(source, r.ReasonAddress, ttl))
+			return h.blockedReply(req, up.group, name, source), true
+		}
+	}
+
+	// Keep public names from resolving into the LAN
+	if h.protectRebinding(name, mesg) {
+		m := new(dns.Msg)
+		m.SetRcode(req, dns.RcodeRefused)
+		return m, true
+	}
+
+	return nil, false
+}
+
+// errDropped is returned for names whose blocked queries are dropped
+var errDropped = errors.New("blocked query dropped")
+
+// lookupName resolves name with the qtype of req through the cache and the
+// upstream, as the normal path would. Its answer is screened as the ones of
+// the queried names, a blocked name is answered with its block reply.
+func (h *DNSHandler) lookupName(Net string, req *dns.Msg, name string, up *upstream) (*dns.Msg, error) {
+	q := req.Question[0]
+	key := cacheKey(up.prefix, utils.UnFqdn(name), q.Qtype)
+	IPQuery := utils.IsIPQuery(q)
+
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), q.Qtype)
+	m.Question[0].Qclass = q.Qclass
+	m.RecursionDesired = true
+
+	if record, ok := h.verdict(up, utils.UnFqdn(name)); ok && stats.BlockingActive() {
+		if reply := h.blockedReply(m, up.group, utils.UnFqdn(name), record.Sources[0]); reply != nil {
+			return reply, nil
+		}
+		return nil, errDropped
+	}
+
+	if stats.CachingActive() && IPQuery > 0 {
+		if record, err := h.cache.Get(key); err == nil && !record.Blocked {
+			return record.Msg.Copy(), nil
+		}
+	}
+
+	mesg, err := h.lookup(Net, m, up)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := h.minTTL(mesg)
+	if reply, ok := h.screen(m, utils.UnFqdn(name), mesg, up, ttl); ok {
+		if reply == nil {
+			return nil, errDropped
+		}
+		return reply, nil
+	}
+
+	h.cacheAnswer(key, mesg, ttl)
+
+	return mesg, nil
+}
+
+// addressReply answers the A or AAAA query req with ips, no ips is NODATA
+func addressReply(req *dns.Msg, ips []net.IP, ttl uint32) *dns.Msg {
+	q := req.Question[0]
+	m := new(dns.Msg)
+	m.SetReply(req)
+
+	header := dns.RR_Header{
+		Name:   q.Name,
+		Rrtype: q.Qtype,
+		Class:  dns.ClassINET,
+		Ttl:    ttl,
+	}
+	for _, ip := range ips {
+		switch q.Qtype {
+		case dns.TypeA:
+			m.Answer = append(m.Answer, &dns.A{Hdr: header, A: ip})
+		case dns.TypeAAAA:
+			m.Answer = append(m.Answer, &dns.AAAA{Hdr: header, AAAA: ip})
 		}
 	}
 
-	//find the smallest ttl
+	return m
+}
+
+// hostsAnswer answers the address queries of the names of the hosts files
+func (h *DNSHandler) hostsAnswer(req *dns.Msg) (*dns.Msg, bool) {
+	q := req.Question[0]
+	IPQuery := utils.IsIPQuery(q)
+	if !h.config.Hosts.Enable || IPQuery <= 0 || !stats.HostsActive() {
+		return nil, false
+	}
+
+	ips, ok := h.hosts.Get(utils.UnFqdn(q.Name), IPQuery)
+	if !ok {
+		return nil, false
+	}
+	return addressReply(req, ips, h.config.TTL), true
+}
+
+// leasesAnswer answers the address queries of the names of the DHCP leases,
+// for no longer than the configured TTL
+func (h *DNSHandler) leasesAnswer(req *dns.Msg) (*dns.Msg, bool) {
+	q := req.Question[0]
+	IPQuery := utils.IsIPQuery(q)
+	if h.leases == nil || IPQuery <= 0 {
+		return nil, false
+	}
+
+	ips, ttl, ok := h.leases.Get(utils.UnFqdn(q.Name), IPQuery)
+	if !ok {
+		return nil, false
+	}
+	if ttl > h.config.TTL {
+		ttl = h.config.TTL
+	}
+	return addressReply(req, ips, ttl), true
+}
+
+// cacheKey is the key of the answers to name, AAAA answers are cached apart
+// from the A ones
+func cacheKey(prefix string, name string, qtype uint16) string {
+	if qtype == dns.TypeAAAA {
+		return prefix + name + ":AAAA"
+	}
+	return prefix + name
+}
+
+// minTTL finds the smallest ttl of an answer, capped by the configured TTL
+func (h *DNSHandler) minTTL(mesg *dns.Msg) time.Duration {
 	ttl := time.Duration(h.config.TTL) * time.Second
 	var candidateTTL time.Duration
 
@@ -215,16 +532,104 @@ func (h *DNSHandler) do(Net string, w dns.ResponseWriter, req *dns.Msg) {
 		}
 	}
 
-	h.WriteReplyMsg(w, mesg)
+	return ttl
+}
 
-	if IPQuery > 0 && len(mesg.Answer) > 0 {
-		err = h.cache.Set(key, r.NewResolvedRecord(mesg, ttl))
-		if err != nil {
-			logger.Errorf("set %s cache failed: %v", Q.String(), err)
+// cacheAnswer caches a non-empty answer to an A/AAAA query
+func (h *DNSHandler) cacheAnswer(key string, mesg *dns.Msg, ttl time.Duration) {
+	if utils.IsIPQuery(mesg.Question[0]) == 0 || len(mesg.Answer) == 0 {
+		return
+	}
+
+	err := h.cache.Set(key, r.NewResolvedRecord(mesg, ttl))
+	if err != nil {
+		logger.Errorf("set %s cache failed: %v", key, err)
+	}
+	logger.Debugf("insert %s into cache with ttl %ds", key, ttl/time.Second)
+	stats.AddNormalDomain()
+}
+
+// verdictKey is the key of the cloaked record of name under the policy of
+// the answers with prefix
+func verdictKey(prefix string, name string) string {
+	return prefix + name + ":verdict"
+}
+
+// cacheVerdict caches a cloaked record of name for the policy of up,
+// replacing an older one
+func (h *DNSHandler) cacheVerdict(up *upstream, name string, record *r.Record) {
+	key := verdictKey(up.prefix, name)
+
+	h.cache.Remove(key)
+	if err := h.cache.Set(key, record); err != nil {
+		logger.Errorf("set %s cache failed: %v", key, err)
+	}
+}
+
+// verdict returns the unexpired cloaked record of name for the policy of up,
+// while its source is enabled
+func (h *DNSHandler) verdict(up *upstream, name string) (*r.Record, bool) {
+	record, err := h.cache.Get(verdictKey(up.prefix, name))
+	if err != nil || !record.Blocked || !up.group.Filter().Enabled(record.Sources[0]) {
+		return nil, false
+	}
+	return record, true
+}
+
+// NewBlockResponse returns the default response for blocked queries
+func NewBlockResponse(config *conf.DNSResolverConfig) (*blocker.Response, error) {
+	block, err := blocker.NewResponse(&config.Block)
+	if err != nil {
+		return nil, err
+	}
+
+	if block.Mode == blocker.ModeInherit {
+		block.Mode = blocker.ModeNull
+		if config.NXDomainOnBlock {
+			block.Mode = blocker.ModeNXDomain
 		}
-		logger.Debugf("insert %s into cache with ttl %ds", Q.String(), ttl/time.Second)
-		stats.AddNormalDomain()
 	}
+
+	if block.TTL == 0 {
+		block.TTL = config.TTL
+	}
+
+	if err := block.Validate(); err != nil {
+		return nil, err
+	}
+
+	return block, nil
+}
+
+// writeBlocked answers a blocked query as configured for its source,
+// the block response of the client group takes precedence
+func (h *DNSHandler) writeBlocked(w dns.ResponseWriter, req *dns.Msg, group *ClientGroup, name string, source string) {
+	m := h.blockedReply(req, group, name, source)
+	if m == nil {
+		logger.Debugf("%s dropped", name)
+		return
+	}
+
+	h.WriteReplyMsg(w, m)
+}
+
+// blockedReply returns the reply to a query of name blocked by source, nil
+// when it is dropped
+func (h *DNSHandler) blockedReply(req *dns.Msg, group *ClientGroup, name string, source string) *dns.Msg {
+	stats.AddQueryBlocked()
+
+	categories := blocker.Categories(source)
+	for _, category := range categories {
+		stats.AddQueryBlockedCategory(category)
+	}
+	logger.Noticef("%s found in blocklist %s [%s]", name, source, strings.Join(categories, ","))
+
+	resp := blocker.ResponseFor(name, source).Inherit(h.block)
+	if group != nil {
+		resp = group.block.Inherit(resp)
+	}
+
+	return resp.Reply(req)
 }
 
 // DoTCP begins a tcp query
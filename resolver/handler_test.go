@@ -0,0 +1,265 @@
+package resolver
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	conf "github.com/ray-g/dnsproxy/config"
+	"github.com/ray-g/dnsproxy/stats"
+)
+
+func TestBlockResponses(t *testing.T) {
+	up := startUpstream(t, "www.example. 60 IN A 192.0.2.1")
+	config := testConfig(t, up)
+	config.Resolver.Block = conf.BlockResponseConfig{TTL: 42}
+	config.Blocker.Blocklist = []string{"ads.example"}
+	config.Blocker.Rules = []conf.BlockRule{{Domain: "Rule.example", Block: conf.BlockResponseConfig{Mode: "refused"}}}
+	addSource(t, config, conf.DNSBlockSource{Name: "malware", Block: conf.BlockResponseConfig{Mode: "nxdomain"}}, "0.0.0.0 malware.example\n")
+	addSource(t, config, conf.DNSBlockSource{Name: "sinkhole", Block: conf.BlockResponseConfig{Mode: "sinkhole", IPv4: "10.0.0.80"}}, "sinkhole.example\n")
+	addSource(t, config, conf.DNSBlockSource{Name: "silent", Block: conf.BlockResponseConfig{Mode: "drop"}}, "silent.example\n")
+	config.Resolver.Groups = []conf.ClientGroupConfig{
+		{Name: "kids", Clients: []string{"192.168.2.0/24"}, Block: conf.BlockResponseConfig{Mode: "nodata"}},
+	}
+	h := newTestHandler(t, config)
+
+	tests := []struct {
+		client  string
+		name    string
+		qtype   uint16
+		rcode   int
+		answers []string
+		soa     bool
+	}{
+		{"192.168.1.10", "ads.example", dns.TypeA, dns.RcodeSuccess, []string{"0.0.0.0"}, false},
+		{"192.168.1.10", "ADS.example", dns.TypeAAAA, dns.RcodeSuccess, []string{"::"}, false},
+		{"192.168.1.10", "ads.example", dns.TypeHTTPS, dns.RcodeSuccess, nil, true},
+		{"192.168.1.10", "ads.example", dns.TypeMX, dns.RcodeSuccess, nil, true},
+		{"192.168.1.10", "malware.example", dns.TypeA, dns.RcodeNameError, nil, true},
+		{"192.168.1.10", "malware.example", dns.TypeTXT, dns.RcodeNameError, nil, true},
+		{"192.168.1.10", "sinkhole.example", dns.TypeA, dns.RcodeSuccess, []string{"10.0.0.80"}, false},
+		{"192.168.1.10", "sinkhole.example", dns.TypeAAAA, dns.RcodeSuccess, nil, true},
+		{"192.168.1.10", "rule.example", dns.TypeA, dns.RcodeRefused, nil, false},
+		{"192.168.1.10", "www.example", dns.TypeA, dns.RcodeSuccess, []string{"192.0.2.1"}, false},
+		{"192.168.2.10", "ads.example", dns.TypeA, dns.RcodeSuccess, nil, true},
+		{"192.168.2.10", "rule.example", dns.TypeA, dns.RcodeSuccess, nil, true},
+		{"192.168.2.10", "malware.example", dns.TypeA, dns.RcodeSuccess, nil, true},
+	}
+
+	for _, test := range tests {
+		m := exchange(t, h, test.client, test.name, test.qtype)
+		if m == nil {
+			t.Errorf("%s %s from %s was dropped", test.name, dns.TypeToString[test.qtype], test.client)
+			continue
+		}
+		if m.Rcode != test.rcode || !reflect.DeepEqual(answers(m), test.answers) || hasSOA(m) != test.soa {
+			t.Errorf("%s %s from %s = %s %v soa %v, want %s %v soa %v", test.name, dns.TypeToString[test.qtype], test.client,
+				dns.RcodeToString[m.Rcode], answers(m), hasSOA(m), dns.RcodeToString[test.rcode], test.answers, test.soa)
+		}
+		for _, rr := range append(m.Answer, m.Ns...) {
+			if rr.Header().Ttl != 42 && test.name != "www.example" {
+				t.Errorf("%s %s from %s: TTL of %s, want 42", test.name, dns.TypeToString[test.qtype], test.client, rr)
+			}
+		}
+	}
+
+	if m := exchange(t, h, "192.168.1.10", "silent.example", dns.TypeA); m != nil {
+		t.Errorf("dropped name answered %v", m)
+	}
+}
+
+func TestBlockEveryQtype(t *testing.T) {
+	up := startUpstream(t, "www.example. 60 IN MX 10 mail.example.")
+	config := testConfig(t, up)
+	config.Blocker.Blocklist = []string{"Ads.Example"}
+	h := newTestHandler(t, config)
+
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA, dns.TypeMX, dns.TypeTXT, dns.TypeHTTPS, dns.TypeSVCB, dns.TypeSRV, dns.TypeCNAME, dns.TypeANY} {
+		// only the address queries get the null addresses, the others none
+		addresses := qtype == dns.TypeA || qtype == dns.TypeAAAA
+		for _, name := range []string{"ads.example", "ADS.EXAMPLE."} {
+			m := exchange(t, h, "192.168.1.10", name, qtype)
+			if m.Rcode != dns.RcodeSuccess || (len(m.Answer) > 0) != addresses {
+				t.Errorf("blocked %s %s = %s %v", name, dns.TypeToString[qtype], dns.RcodeToString[m.Rcode], answers(m))
+			}
+		}
+	}
+	if n := up.received(); n != 0 {
+		t.Errorf("upstream received %d queries for a blocked name", n)
+	}
+
+	if got := answers(exchange(t, h, "192.168.1.10", "www.example", dns.TypeMX)); !reflect.DeepEqual(got, []string{"10 mail.example."}) {
+		t.Errorf("www.example MX = %v, want the upstream answer", got)
+	}
+}
+
+func TestCNAMECloaking(t *testing.T) {
+	up := startUpstream(t,
+		"www.shop.example. 60 IN CNAME shop.tracker.example.",
+		"shop.tracker.example. 60 IN A 192.0.2.5",
+		"www.clean.example. 60 IN CNAME cdn.example.",
+		"cdn.example. 60 IN A 192.0.2.6",
+	)
+	config := testConfig(t, up)
+	config.Blocker.Blocklist = []string{"shop.tracker.example"}
+	config.Resolver.Groups = []conf.ClientGroupConfig{
+		{Name: "servers", Clients: []string{"10.0.0.0/8"}, Whitelist: []string{"www.shop.example"}},
+	}
+	h := newTestHandler(t, config)
+
+	tests := []struct {
+		client  string
+		name    string
+		answers []string
+	}{
+		{"192.168.1.10", "www.shop.example", []string{"0.0.0.0"}},
+		{"192.168.1.10", "www.shop.example", []string{"0.0.0.0"}},
+		{"192.168.1.10", "www.clean.example", []string{"cdn.example.", "192.0.2.6"}},
+		{"10.0.0.10", "www.shop.example", []string{"shop.tracker.example.", "192.0.2.5"}},
+	}
+
+	for _, test := range tests {
+		m := exchange(t, h, test.client, test.name, dns.TypeA)
+		if got := answers(m); !reflect.DeepEqual(got, test.answers) {
+			t.Errorf("%s from %s = %v, want %v", test.name, test.client, got, test.answers)
+		}
+	}
+
+	// the cloaked verdict is cached, the name is not looked up again
+	received := up.received()
+	exchange(t, h, "192.168.1.10", "www.shop.example", dns.TypeA)
+	if up.received() != received {
+		t.Error("cloaked name looked up again")
+	}
+
+	config.Resolver.BlockCNAME = false
+	h = newTestHandler(t, config)
+	if got := answers(exchange(t, h, "192.168.1.10", "www.shop.example", dns.TypeA)); len(got) != 2 {
+		t.Errorf("cloaked name with BlockCNAME disabled = %v", got)
+	}
+}
+
+func TestIPBlocklist(t *testing.T) {
+	up := startUpstream(t,
+		"bad.example. 60 IN A 198.51.100.7",
+		"bad.example. 60 IN A 203.0.113.7",
+		"alias.example. 60 IN CNAME bad.example.",
+		"good.example. 60 IN A 192.0.2.1",
+	)
+	config := testConfig(t, up)
+	config.Blocker.IPBlocklist = []string{"203.0.113.0/24"}
+	config.Resolver.Block = conf.BlockResponseConfig{Mode: "nxdomain"}
+	config.Resolver.Groups = []conf.ClientGroupConfig{
+		{Name: "servers", Clients: []string{"10.0.0.0/8"}, Whitelist: []string{"bad.example"}},
+	}
+	h := newTestHandler(t, config)
+
+	blockedIP := func() int32 { return stats.Dump()["query_blocked_ip"].(int32) }
+
+	tests := []struct {
+		client string
+		name   string
+		rcode  int
+		count  int32
+	}{
+		{"192.168.1.10", "bad.example", dns.RcodeNameError, 1},
+		{"192.168.1.10", "bad.example", dns.RcodeNameError, 1},
+		{"192.168.1.10", "alias.example", dns.RcodeNameError, 1},
+		{"192.168.1.10", "good.example", dns.RcodeSuccess, 0},
+		{"10.0.0.10", "bad.example", dns.RcodeSuccess, 0},
+	}
+
+	for _, test := range tests {
+		before := blockedIP()
+		m := exchange(t, h, test.client, test.name, dns.TypeA)
+		if m.Rcode != test.rcode || blockedIP()-before != test.count {
+			t.Errorf("%s from %s = %s counting %d IP blocks, want %s counting %d", test.name, test.client,
+				dns.RcodeToString[m.Rcode], blockedIP()-before, dns.RcodeToString[test.rcode], test.count)
+		}
+	}
+}
+
+func TestSwitches(t *testing.T) {
+	up := startUpstream(t, "ads.example. 60 IN A 192.0.2.1", "www.example. 60 IN A 192.0.2.2")
+	config := testConfig(t, up)
+	config.Blocker.Blocklist = []string{"ads.example"}
+	h := newTestHandler(t, config)
+
+	blocking, _ := stats.GetSwitch("blocking")
+	caching, _ := stats.GetSwitch("caching")
+	t.Cleanup(func() {
+		blocking.TurnOn()
+		caching.TurnOn()
+	})
+
+	blocking.Pause(time.Minute)
+	if got := answers(exchange(t, h, "192.168.1.10", "ads.example", dns.TypeA)); !reflect.DeepEqual(got, []string{"192.0.2.1"}) {
+		t.Errorf("ads.example with blocking paused = %v", got)
+	}
+	blocking.TurnOn()
+	if got := answers(exchange(t, h, "192.168.1.10", "ads.example", dns.TypeA)); !reflect.DeepEqual(got, []string{"0.0.0.0"}) {
+		t.Errorf("ads.example with blocking on = %v", got)
+	}
+
+	exchange(t, h, "192.168.1.10", "www.example", dns.TypeA)
+	received := up.received()
+	exchange(t, h, "192.168.1.10", "www.example", dns.TypeA)
+	if up.received() != received {
+		t.Error("cached answer looked up again")
+	}
+
+	caching.TurnOff()
+	exchange(t, h, "192.168.1.10", "www.example", dns.TypeA)
+	if up.received() != received+1 {
+		t.Error("answer served from cache with caching off")
+	}
+}
+
+func TestDefaultDeny(t *testing.T) {
+	up := startUpstream(t,
+		"www.allowed.example. 60 IN A 192.0.2.1",
+		"www.kiosk.example. 60 IN A 192.0.2.2",
+		"www.other.example. 60 IN A 192.0.2.3",
+	)
+	config := testConfig(t, up)
+	config.Blocker.DefaultDeny = true
+	config.Blocker.Allowlist = []string{"*.allowed.example"}
+	config.Resolver.Block = conf.BlockResponseConfig{Mode: "refused"}
+	open := false
+	config.Resolver.Groups = []conf.ClientGroupConfig{
+		{Name: "kiosk", Clients: []string{"172.20.0.0/16"}, Allowlist: []string{"www.kiosk.example"}},
+		{Name: "admins", Clients: []string{"10.0.0.0/8"}, DefaultDeny: &open},
+	}
+	h := newTestHandler(t, config)
+
+	denied := func() int32 { return stats.Dump()["query_denied"].(int32) }
+
+	tests := []struct {
+		client string
+		name   string
+		rcode  int
+	}{
+		{"192.168.1.10", "www.allowed.example", dns.RcodeSuccess},
+		{"192.168.1.10", "www.kiosk.example", dns.RcodeRefused},
+		{"192.168.1.10", "www.other.example", dns.RcodeRefused},
+		{"172.20.0.10", "www.allowed.example", dns.RcodeSuccess},
+		{"172.20.0.10", "www.kiosk.example", dns.RcodeSuccess},
+		{"172.20.0.10", "www.other.example", dns.RcodeRefused},
+		{"10.0.0.10", "www.other.example", dns.RcodeSuccess},
+	}
+
+	for _, test := range tests {
+		before := denied()
+		m := exchange(t, h, test.client, test.name, dns.TypeA)
+		count := int32(0)
+		if test.rcode == dns.RcodeRefused {
+			count = 1
+		}
+		if m.Rcode != test.rcode || denied()-before != count {
+			t.Errorf("%s from %s = %s counting %d denied, want %s", test.name, test.client,
+				dns.RcodeToString[m.Rcode], denied()-before, dns.RcodeToString[test.rcode])
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package resolver
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestHostsAnswers(t *testing.T) {
+	up := startUpstream(t, "www.example. 60 IN A 192.0.2.9")
+	config := testConfig(t, up)
+
+	file := filepath.Join(t.TempDir(), "hosts")
+	if err := ioutil.WriteFile(file, []byte("192.0.2.1 router.lan\n2001:db8::1 router.lan\n192.0.2.2 router.lan\n192.0.2.3 nas.lan\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config.Resolver.Hosts.Enable = true
+	config.Resolver.Hosts.HostsFiles = []string{file}
+	config.Resolver.Hosts.Watch = false
+	config.Resolver.Hosts.RefreshInterval = 0
+	h := newTestHandler(t, config)
+
+	tests := []struct {
+		name    string
+		qtype   uint16
+		answers []string
+	}{
+		{"router.lan", dns.TypeA, []string{"192.0.2.1", "192.0.2.2"}},
+		{"Router.LAN", dns.TypeAAAA, []string{"2001:db8::1"}},
+		{"nas.lan", dns.TypeA, []string{"192.0.2.3"}},
+		{"nas.lan", dns.TypeAAAA, nil},
+		{"nas.lan", dns.TypeAAAA, nil},
+	}
+
+	for _, test := range tests {
+		m := exchange(t, h, "192.168.1.10", test.name, test.qtype)
+		if m.Rcode != dns.RcodeSuccess || !reflect.DeepEqual(answers(m), test.answers) {
+			t.Errorf("%s %s = %s %v, want %v", test.name, dns.TypeToString[test.qtype], dns.RcodeToString[m.Rcode], answers(m), test.answers)
+		}
+	}
+
+	// the names of the hosts file are not forwarded
+	if n := up.received(); n != 0 {
+		t.Errorf("upstream received %d queries for hosts names", n)
+	}
+
+	if got := answers(exchange(t, h, "192.168.1.10", "www.example", dns.TypeA)); !reflect.DeepEqual(got, []string{"192.0.2.9"}) {
+		t.Errorf("www.example = %v, want the upstream answer", got)
+	}
+}
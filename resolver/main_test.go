@@ -0,0 +1,207 @@
+package resolver
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"github.com/ray-g/dnsproxy/blocker"
+	"github.com/ray-g/dnsproxy/cache/memcache"
+	conf "github.com/ray-g/dnsproxy/config"
+	"github.com/ray-g/dnsproxy/logger"
+	"github.com/ray-g/dnsproxy/stats"
+)
+
+func TestMain(m *testing.M) {
+	logger.SetOutput(ioutil.Discard)
+	logger.InitLogger("resolver", false)
+	stats.Activate()
+	os.Exit(m.Run())
+}
+
+// fakeUpstream answers queries from records in zone file format, following
+// their CNAMEs. Names without records are NXDOMAIN.
+type fakeUpstream struct {
+	addr    string
+	queries int32
+}
+
+func startUpstream(t *testing.T, records ...string) *fakeUpstream {
+	var rrs []dns.RR
+	for _, s := range records {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rrs = append(rrs, rr)
+	}
+
+	up := &fakeUpstream{}
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		atomic.AddInt32(&up.queries, 1)
+		q := req.Question[0]
+
+		m := new(dns.Msg)
+		m.SetReply(req)
+		known := false
+		for name, depth := q.Name, 0; name != "" && depth < 8; depth++ {
+			next := ""
+			for _, rr := range rrs {
+				if !strings.EqualFold(rr.Header().Name, name) {
+					continue
+				}
+				known = true
+				if cname, ok := rr.(*dns.CNAME); ok && q.Qtype != dns.TypeCNAME {
+					m.Answer = append(m.Answer, rr)
+					next = cname.Target
+				} else if rr.Header().Rrtype == q.Qtype {
+					m.Answer = append(m.Answer, rr)
+				}
+			}
+			name = next
+		}
+		if !known {
+			m.Rcode = dns.RcodeNameError
+		}
+		w.WriteMsg(m)
+	})
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	server := &dns.Server{PacketConn: pc, Handler: handler, NotifyStartedFunc: func() { close(started) }}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+	<-started
+
+	up.addr = pc.LocalAddr().String()
+	return up
+}
+
+// received returns the number of queries the upstream received
+func (up *fakeUpstream) received() int {
+	return int(atomic.LoadInt32(&up.queries))
+}
+
+// testConfig returns the default config resolving through up, with the
+// hosts files disabled and the sources kept in a temporary directory
+func testConfig(t *testing.T, up *fakeUpstream) *conf.Config {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dnsproxy.yaml")
+	if err := ioutil.WriteFile(path, []byte("LogLevel: Info\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := conf.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config.Resolver.Nameservers = []string{up.addr}
+	config.Resolver.Timeout = 1
+	config.Resolver.Hosts.Enable = false
+	config.Blocker.SourceDir = filepath.Join(dir, "sources")
+	config.Blocker.IPSourceDir = filepath.Join(dir, "ipsources")
+	config.Blocker.Whitelist = nil
+
+	return config
+}
+
+// addSource adds source to config with content as its downloaded list
+func addSource(t *testing.T, config *conf.Config, source conf.DNSBlockSource, content string) {
+	os.MkdirAll(config.Blocker.SourceDir, 0755)
+	path := filepath.Join(config.Blocker.SourceDir, source.Name+".list")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	source.URL = "http://127.0.0.1:1/" + source.Name
+	config.Blocker.SourceURLs = append(config.Blocker.SourceURLs, source)
+}
+
+// newTestHandler returns the handler of config with its blocklist loaded
+func newTestHandler(t *testing.T, config *conf.Config) *DNSHandler {
+	cache := memcache.NewCache()
+	h := NewHandler(&config.Resolver, cache)
+	t.Cleanup(h.Close)
+
+	blocker.PerformUpdate(&config.Blocker, cache, false)
+	return h
+}
+
+// fakeWriter records the replies to a client
+type fakeWriter struct {
+	remote net.Addr
+	msgs   []*dns.Msg
+}
+
+func (w *fakeWriter) LocalAddr() net.Addr         { return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53} }
+func (w *fakeWriter) RemoteAddr() net.Addr        { return w.remote }
+func (w *fakeWriter) WriteMsg(m *dns.Msg) error   { w.msgs = append(w.msgs, m); return nil }
+func (w *fakeWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *fakeWriter) Close() error                { return nil }
+func (w *fakeWriter) TsigStatus() error           { return nil }
+func (w *fakeWriter) TsigTimersOnly(bool)         {}
+func (w *fakeWriter) Hijack()                     {}
+
+// exchange sends a query of name from client with the EDNS0 options opts
+// to h, a dropped query has no reply
+func exchange(t *testing.T, h *DNSHandler, client string, name string, qtype uint16, opts ...dns.EDNS0) *dns.Msg {
+	req := new(dns.Msg)
+	req.SetQuestion(dns.Fqdn(name), qtype)
+	if len(opts) > 0 {
+		req.SetEdns0(4096, false)
+		opt := req.IsEdns0()
+		opt.Option = append(opt.Option, opts...)
+	}
+
+	w := &fakeWriter{remote: &net.UDPAddr{IP: net.ParseIP(client), Port: 5353}}
+	h.do("udp", w, req)
+
+	switch len(w.msgs) {
+	case 0:
+		return nil
+	case 1:
+		return w.msgs[0]
+	}
+	t.Fatalf("%s %s from %s answered %d times", name, dns.TypeToString[qtype], client, len(w.msgs))
+	return nil
+}
+
+// answers returns the data of the answer records of m
+func answers(m *dns.Msg) []string {
+	var list []string
+	for _, rr := range m.Answer {
+		switch v := rr.(type) {
+		case *dns.A:
+			list = append(list, v.A.String())
+		case *dns.AAAA:
+			list = append(list, v.AAAA.String())
+		case *dns.CNAME:
+			list = append(list, v.Target)
+		case *dns.PTR:
+			list = append(list, v.Ptr)
+		default:
+			list = append(list, strings.TrimPrefix(rr.String(), rr.Header().String()))
+		}
+	}
+	return list
+}
+
+// hasSOA reports whether the authority section of m holds an SOA record
+func hasSOA(m *dns.Msg) bool {
+	for _, rr := range m.Ns {
+		if rr.Header().Rrtype == dns.TypeSOA {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package resolver
+
+import (
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"github.com/ray-g/dnsproxy/iptree"
+	"github.com/ray-g/dnsproxy/logger"
+	"github.com/ray-g/dnsproxy/utils"
+)
+
+var privateNetworks = iptree.New()
+
+func init() {
+	for _, cidr := range []string{
+		"0.0.0.0/8",      // this network
+		"10.0.0.0/8",     // RFC 1918
+		"100.64.0.0/10",  // carrier-grade NAT
+		"127.0.0.0/8",    // loopback
+		"169.254.0.0/16", // link-local
+		"172.16.0.0/12",  // RFC 1918
+		"192.168.0.0/16", // RFC 1918
+		"::/128",         // unspecified
+		"::1/128",        // loopback
+		"fc00::/7",       // unique local
+		"fe80::/10",      // link-local
+	} {
+		privateNetworks.InsertString(cidr, cidr)
+	}
+}
+
+// IsPrivateIP reports whether ip is private, loopback or link-local
+func IsPrivateIP(ip net.IP) bool {
+	return privateNetworks.Contains(ip)
+}
+
+// rebindingAllowed reports whether name may resolve to private addresses
+func (h *DNSHandler) rebindingAllowed(name string) bool {
+	for _, domain := range h.config.Rebinding.AllowDomains {
+		if utils.HasDomainSuffix(name, domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// protectRebinding strips private addresses from the upstream answer of a
+// public name, it returns true when the whole answer must be rejected instead
+func (h *DNSHandler) protectRebinding(name string, mesg *dns.Msg) bool {
+	if !h.config.Rebinding.Enable || h.rebindingAllowed(name) {
+		return false
+	}
+
+	answer := mesg.Answer[:0]
+	for _, rr := range mesg.Answer {
+		var ip net.IP
+
+		switch v := rr.(type) {
+		case *dns.A:
+			ip = v.A
+		case *dns.AAAA:
+			ip = v.AAAA
+		}
+
+		if ip != nil && IsPrivateIP(ip) {
+			logger.Warningf("possible DNS rebinding: %s answered with %s", name, ip)
+			if strings.ToLower(h.config.Rebinding.Mode) == "reject" {
+				return true
+			}
+			continue
+		}
+
+		answer = append(answer, rr)
+	}
+	mesg.Answer = answer
+
+	return false
+}
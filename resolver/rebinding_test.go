@@ -0,0 +1,83 @@
+package resolver
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestIsPrivateIP(t *testing.T) {
+	tests := []struct {
+		ip      string
+		private bool
+	}{
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"172.32.0.1", false},
+		{"192.168.1.1", true},
+		{"127.0.0.1", true},
+		{"169.254.1.1", true},
+		{"100.64.0.1", true},
+		{"0.0.0.0", true},
+		{"8.8.8.8", false},
+		{"::1", true},
+		{"::", true},
+		{"fd00::1", true},
+		{"fe80::1", true},
+		{"2001:db8::1", false},
+	}
+
+	for _, test := range tests {
+		if private := IsPrivateIP(net.ParseIP(test.ip)); private != test.private {
+			t.Errorf("IsPrivateIP(%s) = %v, want %v", test.ip, private, test.private)
+		}
+	}
+}
+
+func TestRebinding(t *testing.T) {
+	up := startUpstream(t,
+		"mixed.example. 60 IN A 192.0.2.1",
+		"mixed.example. 60 IN A 192.168.1.1",
+		"private.example. 60 IN A 10.0.0.1",
+		"intranet.corp.example. 60 IN A 10.0.0.2",
+		"public.example. 60 IN A 192.0.2.2",
+	)
+
+	tests := []struct {
+		mode    string
+		name    string
+		rcode   int
+		answers []string
+	}{
+		{"strip", "mixed.example", dns.RcodeSuccess, []string{"192.0.2.1"}},
+		{"strip", "private.example", dns.RcodeSuccess, nil},
+		{"strip", "intranet.corp.example", dns.RcodeSuccess, []string{"10.0.0.2"}},
+		{"Reject", "mixed.example", dns.RcodeRefused, nil},
+		{"Reject", "private.example", dns.RcodeRefused, nil},
+		{"Reject", "intranet.corp.example", dns.RcodeSuccess, []string{"10.0.0.2"}},
+		{"Reject", "public.example", dns.RcodeSuccess, []string{"192.0.2.2"}},
+	}
+
+	handlers := make(map[string]*DNSHandler)
+	for _, test := range tests {
+		h, ok := handlers[test.mode]
+		if !ok {
+			config := testConfig(t, up)
+			config.Resolver.Rebinding.Enable = true
+			config.Resolver.Rebinding.Mode = test.mode
+			config.Resolver.Rebinding.AllowDomains = []string{"corp.example"}
+			h = newTestHandler(t, config)
+			handlers[test.mode] = h
+		}
+
+		// the second answer comes from the cache
+		for i := 0; i < 2; i++ {
+			m := exchange(t, h, "192.168.1.10", test.name, dns.TypeA)
+			if m.Rcode != test.rcode || !reflect.DeepEqual(answers(m), test.answers) {
+				t.Errorf("%s %s = %s %v, want %s %v", test.mode, test.name, dns.RcodeToString[m.Rcode], answers(m), dns.RcodeToString[test.rcode], test.answers)
+			}
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package resolver
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"github.com/ray-g/dnsproxy/logger"
+	"github.com/ray-g/dnsproxy/records"
+)
+
+// maxChain is the longest CNAME chain followed through the custom records
+const maxChain = 8
+
+// customAnswer answers the names of the custom records, a CNAME is followed
+// through the custom records and then the upstream. A chain that loops or
+// outgrows maxChain is answered SERVFAIL.
+func (h *DNSHandler) customAnswer(Net string, req *dns.Msg, up *upstream) (*dns.Msg, bool) {
+	q := req.Question[0]
+	if q.Qclass != dns.ClassINET {
+		return nil, false
+	}
+
+	answer, ok := records.Lookup(q.Name, q.Qtype)
+	if !ok {
+		return nil, false
+	}
+
+	m := new(dns.Msg)
+	m.SetReply(req)
+	m.RecursionAvailable = true
+	m.Answer = answer
+
+	visited := map[string]bool{strings.ToLower(dns.Fqdn(q.Name)): true}
+	for depth := 0; depth < maxChain && len(m.Answer) > 0; depth++ {
+		cname, ok := m.Answer[len(m.Answer)-1].(*dns.CNAME)
+		if !ok || q.Qtype == dns.TypeCNAME || q.Qtype == dns.TypeANY {
+			break
+		}
+
+		// a chain back to one of its names never ends
+		target := strings.ToLower(dns.Fqdn(cname.Target))
+		if visited[target] || depth == maxChain-1 {
+			logger.Errorf("custom records of %s loop or chain too long at %s", q.Name, cname.Target)
+			m.Rcode = dns.RcodeServerFailure
+			break
+		}
+		visited[target] = true
+
+		if answer, ok := records.Lookup(cname.Target, q.Qtype); ok {
+			m.Answer = append(m.Answer, answer...)
+			continue
+		}
+
+		mesg, err := h.lookupName(Net, req, cname.Target, up)
+		if err != nil {
+			logger.Errorf("resolve %s error %v", cname.Target, err)
+			m.Rcode = dns.RcodeServerFailure
+			break
+		}
+		m.Answer = append(m.Answer, mesg.Answer...)
+		m.Rcode = mesg.Rcode
+		break
+	}
+
+	// a custom name without records of qtype is NODATA
+	if len(m.Answer) == 0 && m.Rcode == dns.RcodeSuccess {
+		m.Ns = append(m.Ns, negativeSOA(q.Name, h.config.Records.TTL))
+	}
+
+	return m, true
+}
+
+// negativeSOA makes the NODATA answers of the custom names cacheable for ttl
+// seconds
+func negativeSOA(name string, ttl uint32) dns.RR {
+	return &dns.SOA{
+		Hdr: dns.RR_Header{
+			Name:   name,
+			Rrtype: dns.TypeSOA,
+			Class:  dns.ClassINET,
+			Ttl:    ttl,
+		},
+		Ns:      "fake-for-negative-caching.dnsproxy.",
+		Mbox:    "hostmaster." + name,
+		Serial:  1,
+		Refresh: 1800,
+		Retry:   900,
+		Expire:  604800,
+		Minttl:  ttl,
+	}
+}
@@ -0,0 +1,90 @@
+package resolver
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	conf "github.com/ray-g/dnsproxy/config"
+	"github.com/ray-g/dnsproxy/records"
+)
+
+// loadRecords replaces the custom records by list until the test ends
+func loadRecords(t *testing.T, list []records.Record) {
+	load := func() {
+		if err := records.Load(&conf.RecordsConfig{StateFile: filepath.Join(t.TempDir(), "records.json"), TTL: 120}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	load()
+	t.Cleanup(load)
+
+	for _, r := range list {
+		if _, err := records.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCustomAnswers(t *testing.T) {
+	up := startUpstream(t, "www.example. 60 IN A 192.0.2.1")
+	config := testConfig(t, up)
+	config.Resolver.Records.TTL = 120
+	h := newTestHandler(t, config)
+
+	list := []records.Record{
+		{Name: "nas.lan", Type: "A", Value: "192.168.1.2"},
+		{Name: "nas.lan", Type: "A", Value: "192.168.1.3"},
+		{Name: "www.lan", Type: "CNAME", Value: "nas.lan"},
+		{Name: "ext.lan", Type: "CNAME", Value: "www.example"},
+		{Name: "gone.lan", Type: "CNAME", Value: "missing.example"},
+		{Name: "loop1.lan", Type: "CNAME", Value: "loop2.lan"},
+		{Name: "loop2.lan", Type: "CNAME", Value: "Loop1.LAN."},
+		{Name: "self.lan", Type: "CNAME", Value: "self.lan"},
+	}
+	// a chain longer than maxChain
+	for i := 0; i < maxChain+1; i++ {
+		list = append(list, records.Record{Name: fmt.Sprintf("chain%d.lan", i), Type: "CNAME", Value: fmt.Sprintf("chain%d.lan", i+1)})
+	}
+	list = append(list, records.Record{Name: fmt.Sprintf("chain%d.lan", maxChain+1), Type: "A", Value: "192.168.1.9"})
+	loadRecords(t, list)
+
+	tests := []struct {
+		name    string
+		qtype   uint16
+		rcode   int
+		answers []string
+		soa     bool
+	}{
+		{"nas.lan", dns.TypeA, dns.RcodeSuccess, []string{"192.168.1.2", "192.168.1.3"}, false},
+		{"NAS.lan", dns.TypeAAAA, dns.RcodeSuccess, nil, true},
+		{"nas.lan", dns.TypeTXT, dns.RcodeSuccess, nil, true},
+		{"www.lan", dns.TypeA, dns.RcodeSuccess, []string{"nas.lan.", "192.168.1.2", "192.168.1.3"}, false},
+		{"www.lan", dns.TypeCNAME, dns.RcodeSuccess, []string{"nas.lan."}, false},
+		{"ext.lan", dns.TypeA, dns.RcodeSuccess, []string{"www.example.", "192.0.2.1"}, false},
+		{"gone.lan", dns.TypeA, dns.RcodeNameError, []string{"missing.example."}, false},
+		{"loop1.lan", dns.TypeA, dns.RcodeServerFailure, []string{"loop2.lan.", "Loop1.LAN."}, false},
+		{"self.lan", dns.TypeA, dns.RcodeServerFailure, []string{"self.lan."}, false},
+	}
+
+	for _, test := range tests {
+		m := exchange(t, h, "192.168.1.10", test.name, test.qtype)
+		if m.Rcode != test.rcode || !reflect.DeepEqual(answers(m), test.answers) || hasSOA(m) != test.soa {
+			t.Errorf("%s %s = %s %v, SOA %v, want %s %v, SOA %v", test.name, dns.TypeToString[test.qtype],
+				dns.RcodeToString[m.Rcode], answers(m), hasSOA(m), dns.RcodeToString[test.rcode], test.answers, test.soa)
+		}
+	}
+
+	if m := exchange(t, h, "192.168.1.10", "chain0.lan", dns.TypeA); m.Rcode != dns.RcodeServerFailure {
+		t.Errorf("chain of %d CNAMEs = %s, want SERVFAIL", maxChain+1, dns.RcodeToString[m.Rcode])
+	}
+
+	// the negative answers are cacheable for the records TTL
+	m := exchange(t, h, "192.168.1.10", "nas.lan", dns.TypeAAAA)
+	if len(m.Ns) != 1 || m.Ns[0].Header().Ttl != 120 || m.Ns[0].(*dns.SOA).Minttl != 120 {
+		t.Errorf("NODATA of nas.lan has authority %v", m.Ns)
+	}
+}
@@ -0,0 +1,106 @@
+package resolver
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"github.com/ray-g/dnsproxy/records"
+	"github.com/ray-g/dnsproxy/stats"
+)
+
+// privateReverseZones are the reverse zones of the RFC 1918 networks
+var privateReverseZones = []string{"10.in-addr.arpa.", "168.192.in-addr.arpa."}
+
+func init() {
+	for i := 16; i < 32; i++ {
+		privateReverseZones = append(privateReverseZones, fmt.Sprintf("%d.172.in-addr.arpa.", i))
+	}
+}
+
+// privateReverse reports whether name is below an RFC 1918 reverse zone
+func privateReverse(name string) bool {
+	for _, zone := range privateReverseZones {
+		if name != zone && dns.IsSubDomain(zone, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// reverseNames returns the local names of the address of the reverse name
+// arpa, from the custom records, the hosts files, the local zones and the
+// DHCP leases
+func (h *DNSHandler) reverseNames(arpa string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	add := func(list []string) {
+		for _, name := range list {
+			name = dns.Fqdn(name)
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+
+	if list, ok := records.Reverse(arpa); ok {
+		add(list)
+	}
+	if h.hosts != nil && stats.HostsActive() {
+		if list, ok := h.hosts.Reverse(arpa); ok {
+			add(list)
+		}
+	}
+	if list, ok := h.zones.Reverse(arpa); ok {
+		add(list)
+	}
+	if h.leases != nil {
+		if list, ok := h.leases.Reverse(arpa); ok {
+			add(list)
+		}
+	}
+
+	return names
+}
+
+// reverse answers the reverse lookups of local addresses, the remaining
+// private reverse names are answered with NXDOMAIN when configured
+func (h *DNSHandler) reverse(req *dns.Msg) (*dns.Msg, bool) {
+	q := req.Question[0]
+	if !h.config.Reverse.Enable || q.Qclass != dns.ClassINET {
+		return nil, false
+	}
+
+	name := strings.ToLower(dns.Fqdn(q.Name))
+
+	if q.Qtype == dns.TypePTR {
+		if names := h.reverseNames(name); len(names) > 0 {
+			m := new(dns.Msg)
+			m.SetReply(req)
+			m.RecursionAvailable = true
+			for _, target := range names {
+				m.Answer = append(m.Answer, &dns.PTR{
+					Hdr: dns.RR_Header{
+						Name:   q.Name,
+						Rrtype: dns.TypePTR,
+						Class:  dns.ClassINET,
+						Ttl:    h.config.TTL,
+					},
+					Ptr: target,
+				})
+			}
+			return m, true
+		}
+	}
+
+	if h.config.Reverse.PrivateNXDomain && privateReverse(name) {
+		m := new(dns.Msg)
+		m.SetRcode(req, dns.RcodeNameError)
+		m.RecursionAvailable = true
+		return m, true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,87 @@
+package resolver
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	conf "github.com/ray-g/dnsproxy/config"
+)
+
+func TestPrivateReverse(t *testing.T) {
+	tests := []struct {
+		name    string
+		private bool
+	}{
+		{"1.2.3.10.in-addr.arpa.", true},
+		{"1.1.168.192.in-addr.arpa.", true},
+		{"1.0.16.172.in-addr.arpa.", true},
+		{"1.0.31.172.in-addr.arpa.", true},
+		{"1.0.32.172.in-addr.arpa.", false},
+		{"8.8.8.8.in-addr.arpa.", false},
+		{"10.in-addr.arpa.", false},
+		{"168.192.in-addr.arpa.", false},
+		{"www.10.in-addr.arpa.example.", false},
+	}
+
+	for _, test := range tests {
+		if private := privateReverse(test.name); private != test.private {
+			t.Errorf("privateReverse(%s) = %v, want %v", test.name, private, test.private)
+		}
+	}
+}
+
+func TestReverseAnswers(t *testing.T) {
+	up := startUpstream(t, "8.8.8.8.in-addr.arpa. 60 IN PTR dns.google.")
+	dir := t.TempDir()
+
+	hosts := filepath.Join(dir, "hosts")
+	if err := ioutil.WriteFile(hosts, []byte("192.168.1.1 router.lan gw.lan\nfd00::1 router.lan\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	zone := filepath.Join(dir, "home.lan.zone")
+	if err := ioutil.WriteFile(zone, []byte("@ 3600 IN SOA ns.home.lan. admin.home.lan. 1 3600 600 86400 300\n"+
+		"router 3600 IN A 192.168.1.1\ngw 3600 IN A 192.168.1.1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		privateNXDomain bool
+		name            string
+		rcode           int
+		answers         []string
+		forwarded       bool
+	}{
+		{false, "1.1.168.192.in-addr.arpa", dns.RcodeSuccess, []string{"gw.lan.", "router.lan.", "router.home.lan.", "gw.home.lan."}, false},
+		{false, "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.d.f.ip6.arpa", dns.RcodeSuccess, []string{"router.lan."}, false},
+		{false, "8.8.8.8.in-addr.arpa", dns.RcodeSuccess, []string{"dns.google."}, true},
+		{false, "2.1.168.192.in-addr.arpa", dns.RcodeNameError, nil, true},
+		{true, "2.1.168.192.in-addr.arpa", dns.RcodeNameError, nil, false},
+		{true, "1.1.168.192.in-addr.arpa", dns.RcodeSuccess, []string{"gw.lan.", "router.lan.", "router.home.lan.", "gw.home.lan."}, false},
+		{true, "8.8.8.8.in-addr.arpa", dns.RcodeSuccess, []string{"dns.google."}, true},
+	}
+
+	for _, test := range tests {
+		config := testConfig(t, up)
+		config.Resolver.Hosts.Enable = true
+		config.Resolver.Hosts.HostsFiles = []string{hosts}
+		config.Resolver.Hosts.Watch = false
+		config.Resolver.Hosts.RefreshInterval = 0
+		config.Resolver.Zones = []conf.ZoneConfig{{Origin: "home.lan", File: zone}}
+		config.Resolver.Reverse.PrivateNXDomain = test.privateNXDomain
+		h := newTestHandler(t, config)
+
+		before := up.received()
+		m := exchange(t, h, "192.168.1.10", test.name, dns.TypePTR)
+		if m.Rcode != test.rcode || !reflect.DeepEqual(answers(m), test.answers) {
+			t.Errorf("%s (private NXDOMAIN %v) = %s %v, want %s %v", test.name, test.privateNXDomain,
+				dns.RcodeToString[m.Rcode], answers(m), dns.RcodeToString[test.rcode], test.answers)
+		}
+		if forwarded := up.received() > before; forwarded != test.forwarded {
+			t.Errorf("%s (private NXDOMAIN %v) forwarded %v, want %v", test.name, test.privateNXDomain, forwarded, test.forwarded)
+		}
+	}
+}
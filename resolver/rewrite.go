@@ -0,0 +1,182 @@
+package resolver
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	conf "github.com/ray-g/dnsproxy/config"
+	"github.com/ray-g/dnsproxy/logger"
+	"github.com/ray-g/dnsproxy/utils"
+)
+
+// rewrite is the answer of a rewritten domain, either addresses or a target
+// name resolved through the upstream
+type rewrite struct {
+	ips    []net.IP
+	target string
+}
+
+// Rewrites answer domains with configured addresses or names, "*.domain"
+// covers the names below domain but not domain itself
+type Rewrites struct {
+	rules map[string]*rewrite
+}
+
+// NewRewrites validates the rewrite rules, the addresses of a domain are
+// merged while a domain rewritten to a name can't have another answer
+func NewRewrites(rules []conf.RewriteRule) (*Rewrites, error) {
+	rw := &Rewrites{rules: make(map[string]*rewrite)}
+
+	for _, rule := range rules {
+		domain := strings.ToLower(utils.UnFqdn(strings.TrimSpace(rule.Domain)))
+		answer := strings.TrimSpace(rule.Answer)
+
+		if !validName(strings.TrimPrefix(domain, "*.")) {
+			return nil, fmt.Errorf("invalid rewrite domain %q", rule.Domain)
+		}
+
+		r, ok := rw.rules[domain]
+		if !ok {
+			r = &rewrite{}
+			rw.rules[domain] = r
+		}
+
+		ip := net.ParseIP(answer)
+		target := strings.ToLower(utils.UnFqdn(answer))
+		switch {
+		case ip == nil && !validName(target):
+			return nil, fmt.Errorf("invalid rewrite answer %q of %s", rule.Answer, rule.Domain)
+		case r.target != "" || (ip == nil && len(r.ips) > 0):
+			return nil, fmt.Errorf("rewrite of %s has more than one answer", rule.Domain)
+		case ip != nil:
+			r.ips = append(r.ips, ip)
+		default:
+			r.target = target
+		}
+	}
+
+	return rw, nil
+}
+
+// validName reports whether name is a domain name, TLDs are not checked
+func validName(name string) bool {
+	_, ok := dns.IsDomainName(name)
+	return ok && name != "" && !strings.Contains(name, "*")
+}
+
+// match returns the rewrite of name, an exact rule wins over the wildcards
+// and the longest wildcard over the shorter ones
+func (rw *Rewrites) match(name string) (*rewrite, bool) {
+	if len(rw.rules) == 0 {
+		return nil, false
+	}
+
+	name = strings.ToLower(utils.UnFqdn(name))
+	r, ok := rw.rules[name]
+	for off, end := dns.NextLabel(name, 0); !ok && !end; off, end = dns.NextLabel(name, off) {
+		r, ok = rw.rules["*."+name[off:]]
+	}
+
+	// a name rewritten to itself is excluded from the wildcards
+	if !ok || r.target == name {
+		return nil, false
+	}
+	return r, true
+}
+
+// rewriteAnswer answers a rewritten name. Addresses answer the A and AAAA
+// queries of their family, a target is answered as a CNAME followed by the
+// answer of the target, chained through the rewrites of the target.
+// Targets resolve as the queries of clients do, local sources first.
+func (h *DNSHandler) rewriteAnswer(Net string, req *dns.Msg, up *upstream) (*dns.Msg, bool) {
+	q := req.Question[0]
+	if q.Qclass != dns.ClassINET {
+		return nil, false
+	}
+
+	r, ok := h.rewrites.match(q.Name)
+	if !ok {
+		return nil, false
+	}
+
+	m := new(dns.Msg)
+	m.SetReply(req)
+	m.RecursionAvailable = true
+
+	name := dns.Fqdn(q.Name)
+	for depth := 0; ok; depth++ {
+		if depth == maxChain {
+			logger.Warningf("rewrite chain of %s is longer than %d", q.Name, maxChain)
+			m.Answer = nil
+			m.Rcode = dns.RcodeServerFailure
+			return m, true
+		}
+
+		if r.target == "" {
+			var ips []net.IP
+			for _, ip := range r.ips {
+				if (q.Qtype == dns.TypeA) == (ip.To4() != nil) {
+					ips = append(ips, ip)
+				}
+			}
+
+			for _, rr := range addressReply(req, ips, h.config.TTL).Answer {
+				rr.Header().Name = name
+				m.Answer = append(m.Answer, rr)
+			}
+			return m, true
+		}
+
+		m.Answer = append(m.Answer, &dns.CNAME{
+			Hdr: dns.RR_Header{
+				Name:   name,
+				Rrtype: dns.TypeCNAME,
+				Class:  dns.ClassINET,
+				Ttl:    h.config.TTL,
+			},
+			Target: dns.Fqdn(r.target),
+		})
+		if q.Qtype == dns.TypeCNAME {
+			return m, true
+		}
+
+		name = dns.Fqdn(r.target)
+		r, ok = h.rewrites.match(name)
+	}
+
+	mesg, err := h.targetAnswer(Net, req, name, up)
+	if err != nil {
+		logger.Errorf("resolve rewrite target %s error %v", name, err)
+		m.Rcode = dns.RcodeServerFailure
+		return m, true
+	}
+	m.Answer = append(m.Answer, mesg.Answer...)
+	m.Rcode = mesg.Rcode
+
+	return m, true
+}
+
+// targetAnswer resolves the rewrite target name with the qtype of req from
+// the local zones, the custom records, the DHCP leases and the hosts files
+// before the cache and the upstream
+func (h *DNSHandler) targetAnswer(Net string, req *dns.Msg, name string, up *upstream) (*dns.Msg, error) {
+	r := req.Copy()
+	r.Question[0].Name = name
+
+	if m, ok := h.zones.Answer(r); ok {
+		return m, nil
+	}
+	if m, ok := h.customAnswer(Net, r, up); ok {
+		return m, nil
+	}
+	if m, ok := h.leasesAnswer(r); ok {
+		return m, nil
+	}
+	if m, ok := h.hostsAnswer(r); ok {
+		return m, nil
+	}
+	return h.lookupName(Net, req, name, up)
+}
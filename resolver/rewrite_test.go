@@ -0,0 +1,127 @@
+package resolver
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	conf "github.com/ray-g/dnsproxy/config"
+)
+
+func TestNewRewrites(t *testing.T) {
+	tests := []struct {
+		rules []conf.RewriteRule
+		valid bool
+	}{
+		{[]conf.RewriteRule{{Domain: "nas.lan", Answer: "192.168.1.2"}, {Domain: "nas.lan", Answer: "fd00::2"}}, true},
+		{[]conf.RewriteRule{{Domain: "*.staging.example.com", Answer: "ingress.internal."}}, true},
+		{[]conf.RewriteRule{{Domain: "nas.lan", Answer: "192.168.1.2"}, {Domain: "nas.lan", Answer: "nas.example"}}, false},
+		{[]conf.RewriteRule{{Domain: "nas.lan", Answer: "nas.example"}, {Domain: "nas.lan", Answer: "192.168.1.2"}}, false},
+		{[]conf.RewriteRule{{Domain: "nas.lan", Answer: "nas.example"}, {Domain: "NAS.lan.", Answer: "other.example"}}, false},
+		{[]conf.RewriteRule{{Domain: "bad..lan", Answer: "192.168.1.2"}}, false},
+		{[]conf.RewriteRule{{Domain: "*", Answer: "192.168.1.2"}}, false},
+		{[]conf.RewriteRule{{Domain: "nas.lan", Answer: "*.example"}}, false},
+		{[]conf.RewriteRule{{Domain: "nas.lan", Answer: ""}}, false},
+	}
+
+	for _, test := range tests {
+		if _, err := NewRewrites(test.rules); (err == nil) != test.valid {
+			t.Errorf("NewRewrites(%+v) = %v, want valid %v", test.rules, err, test.valid)
+		}
+	}
+}
+
+func TestRewritesMatch(t *testing.T) {
+	rw, err := NewRewrites([]conf.RewriteRule{
+		{Domain: "*.example.com", Answer: "192.0.2.1"},
+		{Domain: "*.staging.example.com", Answer: "ingress.internal"},
+		{Domain: "api.staging.example.com", Answer: "192.0.2.2"},
+		{Domain: "*.self.example", Answer: "www.self.example"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		ips    []string
+		ok     bool
+	}{
+		{"www.example.com", "", []string{"192.0.2.1"}, true},
+		{"example.com", "", nil, false},
+		{"web.staging.example.com.", "ingress.internal", nil, true},
+		{"a.b.Staging.Example.com", "ingress.internal", nil, true},
+		{"staging.example.com", "", []string{"192.0.2.1"}, true},
+		{"API.staging.example.com", "", []string{"192.0.2.2"}, true},
+		{"www.self.example", "", nil, false},
+		{"api.self.example", "www.self.example", nil, true},
+		{"www.example.org", "", nil, false},
+	}
+
+	for _, test := range tests {
+		r, ok := rw.match(test.name)
+		var target string
+		var ips []string
+		if ok {
+			target = r.target
+			for _, ip := range r.ips {
+				ips = append(ips, ip.String())
+			}
+		}
+		if ok != test.ok || target != test.target || !reflect.DeepEqual(ips, test.ips) {
+			t.Errorf("match(%s) = %q %v, %v, want %q %v, %v", test.name, target, ips, ok, test.target, test.ips, test.ok)
+		}
+	}
+}
+
+func TestRewriteAnswers(t *testing.T) {
+	up := startUpstream(t,
+		"ingress.internal. 60 IN A 192.0.2.10",
+		"ingress.internal. 60 IN AAAA 2001:db8::10",
+		"tracker.example. 60 IN A 203.0.113.7",
+		"home.example. 60 IN A 192.168.1.1",
+	)
+	config := testConfig(t, up)
+	config.Blocker.IPBlocklist = []string{"203.0.113.0/24"}
+	config.Resolver.Rebinding.Enable = true
+	config.Resolver.Rebinding.Mode = "strip"
+	config.Resolver.Rewrites = []conf.RewriteRule{
+		{Domain: "nas.lan", Answer: "192.168.1.2"},
+		{Domain: "nas.lan", Answer: "fd00::2"},
+		{Domain: "*.staging.example.com", Answer: "ingress.internal"},
+		{Domain: "alias.lan", Answer: "web.staging.example.com"},
+		{Domain: "tracked.lan", Answer: "tracker.example"},
+		{Domain: "home.lan", Answer: "home.example"},
+		{Domain: "loop1.lan", Answer: "loop2.lan"},
+		{Domain: "loop2.lan", Answer: "loop1.lan"},
+	}
+	h := newTestHandler(t, config)
+
+	tests := []struct {
+		name    string
+		qtype   uint16
+		rcode   int
+		answers []string
+	}{
+		{"nas.lan", dns.TypeA, dns.RcodeSuccess, []string{"192.168.1.2"}},
+		{"nas.lan", dns.TypeAAAA, dns.RcodeSuccess, []string{"fd00::2"}},
+		{"nas.lan", dns.TypeTXT, dns.RcodeSuccess, nil},
+		{"web.staging.example.com", dns.TypeA, dns.RcodeSuccess, []string{"ingress.internal.", "192.0.2.10"}},
+		{"web.staging.example.com", dns.TypeAAAA, dns.RcodeSuccess, []string{"ingress.internal.", "2001:db8::10"}},
+		{"web.staging.example.com", dns.TypeCNAME, dns.RcodeSuccess, []string{"ingress.internal."}},
+		{"alias.lan", dns.TypeA, dns.RcodeSuccess, []string{"web.staging.example.com.", "ingress.internal.", "192.0.2.10"}},
+		{"tracked.lan", dns.TypeA, dns.RcodeSuccess, []string{"tracker.example.", "0.0.0.0"}},
+		{"home.lan", dns.TypeA, dns.RcodeSuccess, []string{"home.example."}},
+		{"loop1.lan", dns.TypeA, dns.RcodeServerFailure, nil},
+	}
+
+	for _, test := range tests {
+		m := exchange(t, h, "192.168.1.10", test.name, test.qtype)
+		if m.Rcode != test.rcode || !reflect.DeepEqual(answers(m), test.answers) {
+			t.Errorf("%s %s = %s %v, want %s %v", test.name, dns.TypeToString[test.qtype],
+				dns.RcodeToString[m.Rcode], answers(m), dns.RcodeToString[test.rcode], test.answers)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package resolver
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+
+	conf "github.com/ray-g/dnsproxy/config"
+	"github.com/ray-g/dnsproxy/logger"
+	"github.com/ray-g/dnsproxy/utils"
+)
+
+const (
+	googleSafeSearch     = "forcesafesearch.google.com"
+	bingSafeSearch       = "strict.bing.com"
+	duckDuckGoSafeSearch = "safe.duckduckgo.com"
+	youTubeSafeSearch    = "restrict.youtube.com"
+)
+
+// googleDomains are the search domains of Google, from google.com/supported_domains
+var googleDomains = []string{
+	"com", "ad", "ae", "com.af", "com.ag", "al", "am", "co.ao", "com.ar", "as",
+	"at", "com.au", "az", "ba", "com.bd", "be", "bf", "bg", "com.bh", "bi",
+	"bj", "com.bn", "com.bo", "com.br", "bs", "bt", "co.bw", "by", "com.bz", "ca",
+	"cat", "cd", "cf", "cg", "ch", "ci", "co.ck", "cl", "cm", "cn",
+	"com.co", "co.cr", "com.cu", "cv", "com.cy", "cz", "de", "dj", "dk", "dm",
+	"com.do", "dz", "com.ec", "ee", "com.eg", "es", "com.et", "fi", "com.fj", "fm",
+	"fr", "ga", "ge", "gg", "com.gh", "com.gi", "gl", "gm", "gr", "com.gt",
+	"gy", "com.hk", "hn", "hr", "ht", "hu", "co.id", "ie", "co.il", "im",
+	"co.in", "iq", "is", "it", "je", "com.jm", "jo", "co.jp", "co.ke", "com.kh",
+	"ki", "kg", "co.kr", "com.kw", "kz", "la", "com.lb", "li", "lk", "co.ls",
+	"lt", "lu", "lv", "com.ly", "co.ma", "md", "me", "mg", "mk", "ml",
+	"com.mm", "mn", "com.mt", "mu", "mv", "mw", "com.mx", "com.my", "co.mz", "com.na",
+	"com.ng", "com.ni", "ne", "nl", "no", "com.np", "nr", "nu", "co.nz", "com.om",
+	"com.pa", "com.pe", "com.pg", "com.ph", "com.pk", "pl", "pn", "com.pr", "ps", "pt",
+	"com.py", "com.qa", "ro", "ru", "rw", "com.sa", "com.sb", "sc", "se", "com.sg",
+	"sh", "si", "sk", "com.sl", "sn", "so", "sm", "sr", "st", "com.sv",
+	"td", "tg", "co.th", "com.tj", "tl", "tm", "tn", "to", "com.tr", "tt",
+	"com.tw", "co.tz", "com.ua", "co.ug", "co.uk", "com.uy", "co.uz", "com.vc", "co.ve", "co.vi",
+	"com.vn", "vu", "ws", "rs", "co.za", "co.zm", "co.zw",
+}
+
+var builtinSafeSearch = map[string]string{
+	"www.bing.com":             bingSafeSearch,
+	"duckduckgo.com":           duckDuckGoSafeSearch,
+	"www.duckduckgo.com":       duckDuckGoSafeSearch,
+	"start.duckduckgo.com":     duckDuckGoSafeSearch,
+	"www.youtube.com":          youTubeSafeSearch,
+	"m.youtube.com":            youTubeSafeSearch,
+	"youtubei.googleapis.com":  youTubeSafeSearch,
+	"youtube.googleapis.com":   youTubeSafeSearch,
+	"www.youtube-nocookie.com": youTubeSafeSearch,
+}
+
+func init() {
+	for _, tld := range googleDomains {
+		builtinSafeSearch["google."+tld] = googleSafeSearch
+		builtinSafeSearch["www.google."+tld] = googleSafeSearch
+	}
+}
+
+// SafeSearch maps search engine names to their safe-search endpoints
+type SafeSearch struct {
+	targets map[string]string
+}
+
+// NewSafeSearch returns the built-in safe-search table extended by config
+func NewSafeSearch(config *conf.SafeSearchConfig) *SafeSearch {
+	s := &SafeSearch{targets: make(map[string]string)}
+
+	for domain, target := range builtinSafeSearch {
+		s.targets[domain] = target
+	}
+
+	for _, rule := range config.Rules {
+		s.targets[strings.ToLower(utils.UnFqdn(rule.Domain))] = utils.UnFqdn(rule.Target)
+	}
+
+	return s
+}
+
+// Target returns the safe-search endpoint of name
+func (s *SafeSearch) Target(name string) (string, bool) {
+	target, ok := s.targets[strings.ToLower(name)]
+	return target, ok
+}
+
+// safeSearchEnabled reports whether safe search is enforced for the group
+func (h *DNSHandler) safeSearchEnabled(group *ClientGroup) bool {
+	if group != nil && group.safeSearch != nil {
+		return *group.safeSearch
+	}
+
+	return h.config.SafeSearch.Enable
+}
+
+// writeSafeSearch answers req with a CNAME to target followed by the
+// answer of target
+func (h *DNSHandler) writeSafeSearch(Net string, w dns.ResponseWriter, req *dns.Msg, target string, up *upstream) {
+	q := req.Question[0]
+
+	resp, err := h.lookupName(Net, req, target, up)
+	if err != nil {
+		logger.Errorf("resolve safe search target %s error %v", target, err)
+		h.HandleFailed(w, req)
+		return
+	}
+
+	m := new(dns.Msg)
+	m.SetReply(req)
+	m.Rcode = resp.Rcode
+
+	cname := &dns.CNAME{
+		Hdr: dns.RR_Header{
+			Name:   q.Name,
+			Rrtype: dns.TypeCNAME,
+			Class:  dns.ClassINET,
+			Ttl:    h.config.TTL,
+		},
+		Target: dns.Fqdn(target),
+	}
+	m.Answer = append(m.Answer, cname)
+	m.Answer = append(m.Answer, resp.Answer...)
+
+	h.WriteReplyMsg(w, m)
+}
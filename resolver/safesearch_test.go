@@ -0,0 +1,86 @@
+package resolver
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	conf "github.com/ray-g/dnsproxy/config"
+)
+
+func TestSafeSearchTarget(t *testing.T) {
+	s := NewSafeSearch(&conf.SafeSearchConfig{Rules: []conf.SafeSearchRule{
+		{Domain: "Search.Example.", Target: "safe.search.example."},
+		{Domain: "www.bing.com", Target: "strict.example"},
+	}})
+
+	tests := []struct {
+		name   string
+		target string
+		ok     bool
+	}{
+		{"www.google.com", googleSafeSearch, true},
+		{"WWW.Google.co.uk", googleSafeSearch, true},
+		{"google.de", googleSafeSearch, true},
+		{"mail.google.com", "", false},
+		{"www.youtube.com", youTubeSafeSearch, true},
+		{"duckduckgo.com", duckDuckGoSafeSearch, true},
+		{"www.bing.com", "strict.example", true},
+		{"search.example", "safe.search.example", true},
+		{"www.example", "", false},
+	}
+
+	for _, test := range tests {
+		target, ok := s.Target(test.name)
+		if target != test.target || ok != test.ok {
+			t.Errorf("Target(%s) = %q, %v, want %q, %v", test.name, target, ok, test.target, test.ok)
+		}
+	}
+}
+
+func TestSafeSearchAnswers(t *testing.T) {
+	up := startUpstream(t,
+		"www.google.com. 60 IN A 192.0.2.1",
+		"forcesafesearch.google.com. 60 IN A 216.239.38.120",
+		"search.example. 60 IN A 192.0.2.2",
+		"safe.search.example. 60 IN A 203.0.113.7",
+	)
+	config := testConfig(t, up)
+	config.Blocker.IPBlocklist = []string{"203.0.113.7"}
+	config.Resolver.SafeSearch.Rules = []conf.SafeSearchRule{{Domain: "search.example", Target: "safe.search.example"}}
+	enabled, disabled := true, false
+	config.Resolver.Groups = []conf.ClientGroupConfig{
+		{Name: "kids", Clients: []string{"192.168.2.0/24"}, SafeSearch: &enabled},
+		{Name: "adults", Clients: []string{"192.168.3.0/24"}, SafeSearch: &disabled},
+	}
+	h := newTestHandler(t, config)
+
+	tests := []struct {
+		client  string
+		name    string
+		answers []string
+	}{
+		{"192.168.1.10", "www.google.com", []string{"192.0.2.1"}},
+		{"192.168.2.10", "www.google.com", []string{"forcesafesearch.google.com.", "216.239.38.120"}},
+		{"192.168.2.10", "www.google.com", []string{"forcesafesearch.google.com.", "216.239.38.120"}},
+		{"192.168.2.10", "search.example", []string{"safe.search.example.", "0.0.0.0"}},
+	}
+
+	for _, test := range tests {
+		if got := answers(exchange(t, h, test.client, test.name, dns.TypeA)); !reflect.DeepEqual(got, test.answers) {
+			t.Errorf("%s from %s = %v, want %v", test.name, test.client, got, test.answers)
+		}
+	}
+
+	config.Resolver.SafeSearch.Enable = true
+	h = newTestHandler(t, config)
+	for client, want := range map[string][]string{
+		"192.168.1.10": {"forcesafesearch.google.com.", "216.239.38.120"},
+		"192.168.3.10": {"192.0.2.1"},
+	} {
+		if got := answers(exchange(t, h, client, "www.google.com", dns.TypeA)); !reflect.DeepEqual(got, want) {
+			t.Errorf("www.google.com from %s with safe search on = %v, want %v", client, got, want)
+		}
+	}
+}
@@ -71,4 +71,6 @@ func (s *Server) Stop() {
 	if s.tcpServer != nil {
 		s.tcpServer.Shutdown()
 	}
+
+	s.handler.Close()
 }
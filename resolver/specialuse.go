@@ -0,0 +1,117 @@
+package resolver
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	conf "github.com/ray-g/dnsproxy/config"
+	"github.com/ray-g/dnsproxy/utils"
+)
+
+// actions of the special-use domains
+const (
+	specialLoopback = "loopback"
+	specialNXDomain = "nxdomain"
+	specialLocal    = "local"
+	specialForward  = "forward"
+)
+
+// builtinSpecialUse are the special-use domains of RFC 6761, RFC 6762
+// (local), RFC 7686 (onion) and RFC 8375 (home.arpa)
+var builtinSpecialUse = map[string]string{
+	"localhost": specialLoopback,
+	"invalid":   specialNXDomain,
+	"onion":     specialNXDomain,
+	"test":      specialLocal,
+	"local":     specialLocal,
+	"home.arpa": specialLocal,
+}
+
+// SpecialUse maps the special-use domains to their actions, a domain covers
+// its subdomains
+type SpecialUse struct {
+	actions map[string]string
+}
+
+// NewSpecialUse returns the built-in special-use domains overridden by config
+func NewSpecialUse(config *conf.SpecialUseConfig) (*SpecialUse, error) {
+	s := &SpecialUse{actions: make(map[string]string)}
+	if !config.Enable {
+		return s, nil
+	}
+
+	for domain, action := range builtinSpecialUse {
+		s.actions[domain] = action
+	}
+
+	for _, rule := range config.Rules {
+		action := strings.ToLower(rule.Action)
+		switch action {
+		case specialLoopback, specialNXDomain, specialLocal, specialForward:
+		default:
+			return nil, fmt.Errorf("unknown action %q of special-use domain %s", rule.Action, rule.Domain)
+		}
+		s.actions[strings.ToLower(utils.UnFqdn(rule.Domain))] = action
+	}
+
+	return s, nil
+}
+
+// Action returns the action of the closest special-use domain of name,
+// names that are forwarded have none
+func (s *SpecialUse) Action(name string) string {
+	if len(s.actions) == 0 {
+		return ""
+	}
+
+	name = strings.ToLower(dns.Fqdn(name))
+	for off, end := 0, false; !end; off, end = dns.NextLabel(name, off) {
+		if action, ok := s.actions[utils.UnFqdn(name[off:])]; ok {
+			if action == specialForward {
+				return ""
+			}
+			return action
+		}
+	}
+	return ""
+}
+
+// specialUseAnswer answers the names of the special-use domains without the
+// upstream. localhost names resolve to the loopback addresses, local names
+// only from the local zones, hosts files and DHCP leases.
+func (h *DNSHandler) specialUseAnswer(req *dns.Msg) (*dns.Msg, bool) {
+	q := req.Question[0]
+	if q.Qclass != dns.ClassINET {
+		return nil, false
+	}
+
+	var m *dns.Msg
+	switch h.specialUse.Action(q.Name) {
+	case specialLoopback:
+		var ips []net.IP
+		switch q.Qtype {
+		case dns.TypeA:
+			ips = []net.IP{net.IPv4(127, 0, 0, 1)}
+		case dns.TypeAAAA:
+			ips = []net.IP{net.IPv6loopback}
+		}
+		m = addressReply(req, ips, h.config.TTL)
+	case specialLocal:
+		if local, ok := h.localAnswer(req, q.Name); ok {
+			m = local
+			break
+		}
+		fallthrough
+	case specialNXDomain:
+		m = new(dns.Msg)
+		m.SetRcode(req, dns.RcodeNameError)
+	default:
+		return nil, false
+	}
+
+	m.RecursionAvailable = true
+	return m, true
+}
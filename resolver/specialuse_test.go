@@ -0,0 +1,104 @@
+package resolver
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	conf "github.com/ray-g/dnsproxy/config"
+)
+
+func TestSpecialUseAction(t *testing.T) {
+	s, err := NewSpecialUse(&conf.SpecialUseConfig{Enable: true, Rules: []conf.SpecialUseRule{
+		{Domain: "Corp.Test.", Action: "Forward"},
+		{Domain: "internal", Action: "local"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		action string
+	}{
+		{"localhost.", specialLoopback},
+		{"www.LOCALHOST", specialLoopback},
+		{"invalid", specialNXDomain},
+		{"hidden.onion.", specialNXDomain},
+		{"printer.local", specialLocal},
+		{"router.home.arpa", specialLocal},
+		{"nas.test", specialLocal},
+		{"www.corp.test", ""},
+		{"nas.internal", specialLocal},
+		{"www.example.com", ""},
+		{"arpa", ""},
+		{"notlocalhost", ""},
+	}
+
+	for _, test := range tests {
+		if action := s.Action(test.name); action != test.action {
+			t.Errorf("Action(%s) = %q, want %q", test.name, action, test.action)
+		}
+	}
+
+	if s, _ := NewSpecialUse(&conf.SpecialUseConfig{}); s.Action("localhost") != "" {
+		t.Error("disabled special-use domains answered")
+	}
+	if _, err := NewSpecialUse(&conf.SpecialUseConfig{Enable: true, Rules: []conf.SpecialUseRule{{Domain: "lan", Action: "drop"}}}); err == nil {
+		t.Error("unknown action accepted")
+	}
+}
+
+func TestSpecialUseAnswers(t *testing.T) {
+	up := startUpstream(t,
+		"www.corp.test. 60 IN A 192.0.2.1",
+		"localhost.example. 60 IN A 192.0.2.2",
+	)
+
+	hosts := filepath.Join(t.TempDir(), "hosts")
+	if err := ioutil.WriteFile(hosts, []byte("192.168.1.2 printer.local\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := testConfig(t, up)
+	config.Resolver.Hosts.Enable = true
+	config.Resolver.Hosts.HostsFiles = []string{hosts}
+	config.Resolver.Hosts.Watch = false
+	config.Resolver.Hosts.RefreshInterval = 0
+	config.Resolver.SpecialUse.Rules = []conf.SpecialUseRule{{Domain: "corp.test", Action: "forward"}}
+	h := newTestHandler(t, config)
+
+	tests := []struct {
+		name      string
+		qtype     uint16
+		rcode     int
+		answers   []string
+		forwarded bool
+	}{
+		{"localhost", dns.TypeA, dns.RcodeSuccess, []string{"127.0.0.1"}, false},
+		{"app.localhost", dns.TypeAAAA, dns.RcodeSuccess, []string{"::1"}, false},
+		{"localhost", dns.TypeMX, dns.RcodeSuccess, nil, false},
+		{"www.invalid", dns.TypeA, dns.RcodeNameError, nil, false},
+		{"hidden.onion", dns.TypeA, dns.RcodeNameError, nil, false},
+		{"printer.local", dns.TypeA, dns.RcodeSuccess, []string{"192.168.1.2"}, false},
+		{"printer.local", dns.TypeAAAA, dns.RcodeSuccess, nil, false},
+		{"scanner.local", dns.TypeA, dns.RcodeNameError, nil, false},
+		{"router.home.arpa", dns.TypeA, dns.RcodeNameError, nil, false},
+		{"www.corp.test", dns.TypeA, dns.RcodeSuccess, []string{"192.0.2.1"}, true},
+		{"localhost.example", dns.TypeA, dns.RcodeSuccess, []string{"192.0.2.2"}, true},
+	}
+
+	for _, test := range tests {
+		before := up.received()
+		m := exchange(t, h, "192.168.1.10", test.name, test.qtype)
+		if m.Rcode != test.rcode || !reflect.DeepEqual(answers(m), test.answers) {
+			t.Errorf("%s %s = %s %v, want %s %v", test.name, dns.TypeToString[test.qtype],
+				dns.RcodeToString[m.Rcode], answers(m), dns.RcodeToString[test.rcode], test.answers)
+		}
+		if forwarded := up.received() > before; forwarded != test.forwarded {
+			t.Errorf("%s %s forwarded %v, want %v", test.name, dns.TypeToString[test.qtype], forwarded, test.forwarded)
+		}
+	}
+}
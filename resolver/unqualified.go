@@ -0,0 +1,94 @@
+package resolver
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/publicsuffix"
+
+	"github.com/ray-g/dnsproxy/utils"
+)
+
+// unqualified reports whether name is a single-label name, top-level domains
+// of the public suffix list are not
+func unqualified(name string) bool {
+	name = strings.ToLower(utils.UnFqdn(name))
+	if name == "" || strings.Contains(name, ".") {
+		return false
+	}
+
+	_, icann := publicsuffix.PublicSuffix(name)
+	return !icann
+}
+
+// localAnswer answers req for name from the local zones, the hosts files
+// and the DHCP leases, names missing from their zone are not local
+func (h *DNSHandler) localAnswer(req *dns.Msg, name string) (*dns.Msg, bool) {
+	r := req.Copy()
+	r.Question[0].Name = name
+
+	if m, ok := h.zones.Answer(r); ok {
+		return m, m.Rcode != dns.RcodeNameError
+	}
+	if m, ok := h.hostsAnswer(r); ok {
+		return m, true
+	}
+	return h.leasesAnswer(r)
+}
+
+// localName reports whether name has addresses in the local sources, as
+// zones, hosts files and DHCP leases answer only some qtypes
+func (h *DNSHandler) localName(req *dns.Msg, name string) bool {
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		r := req.Copy()
+		r.Question[0].Qtype = qtype
+		if _, ok := h.localAnswer(r, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// unqualifiedAnswer answers a single-label name with a CNAME to the name
+// qualified by the local domain when that resolves locally, followed by its
+// answer or none for the qtypes it lacks. Other single-label names are
+// answered NXDOMAIN unless they are forwarded.
+func (h *DNSHandler) unqualifiedAnswer(req *dns.Msg) (*dns.Msg, bool) {
+	q := req.Question[0]
+	if q.Qclass != dns.ClassINET || !unqualified(q.Name) {
+		return nil, false
+	}
+
+	if domain := strings.Trim(h.config.Unqualified.Domain, "."); domain != "" {
+		target := dns.Fqdn(strings.ToLower(utils.UnFqdn(q.Name)) + "." + strings.ToLower(domain))
+		m, ok := h.localAnswer(req, target)
+		if ok || h.localName(req, target) {
+			cname := &dns.CNAME{
+				Hdr: dns.RR_Header{
+					Name:   q.Name,
+					Rrtype: dns.TypeCNAME,
+					Class:  dns.ClassINET,
+					Ttl:    h.config.TTL,
+				},
+				Target: target,
+			}
+			if !ok || q.Qtype == dns.TypeCNAME {
+				m = new(dns.Msg)
+				m.SetReply(req)
+				m.RecursionAvailable = true
+			}
+			m.Question = req.Question
+			m.Answer = append([]dns.RR{cname}, m.Answer...)
+			return m, true
+		}
+	}
+
+	if h.config.Unqualified.Forward {
+		return nil, false
+	}
+
+	m := new(dns.Msg)
+	m.SetRcode(req, dns.RcodeNameError)
+	m.RecursionAvailable = true
+	return m, true
+}
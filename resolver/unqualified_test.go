@@ -0,0 +1,87 @@
+package resolver
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestUnqualified(t *testing.T) {
+	tests := []struct {
+		name        string
+		unqualified bool
+	}{
+		{"nas", true},
+		{"NAS.", true},
+		{"lan", true},
+		{"nas.lan", false},
+		{"com", false},
+		{"uk.", false},
+		{"", false},
+		{".", false},
+	}
+
+	for _, test := range tests {
+		if unqualified := unqualified(test.name); unqualified != test.unqualified {
+			t.Errorf("unqualified(%q) = %v, want %v", test.name, unqualified, test.unqualified)
+		}
+	}
+}
+
+func TestUnqualifiedAnswers(t *testing.T) {
+	up := startUpstream(t, "printer. 60 IN A 192.0.2.1")
+
+	hosts := filepath.Join(t.TempDir(), "hosts")
+	if err := ioutil.WriteFile(hosts, []byte("192.168.1.2 nas.lan\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		forward   bool
+		name      string
+		qtype     uint16
+		rcode     int
+		answers   []string
+		forwarded bool
+	}{
+		{false, "nas", dns.TypeA, dns.RcodeSuccess, []string{"nas.lan.", "192.168.1.2"}, false},
+		{false, "NAS", dns.TypeA, dns.RcodeSuccess, []string{"nas.lan.", "192.168.1.2"}, false},
+		{false, "nas", dns.TypeAAAA, dns.RcodeSuccess, []string{"nas.lan."}, false},
+		{false, "nas", dns.TypeMX, dns.RcodeSuccess, []string{"nas.lan."}, false},
+		{false, "nas", dns.TypeCNAME, dns.RcodeSuccess, []string{"nas.lan."}, false},
+		{false, "printer", dns.TypeA, dns.RcodeNameError, nil, false},
+		{false, "printer", dns.TypeTXT, dns.RcodeNameError, nil, false},
+		{false, "com", dns.TypeNS, dns.RcodeNameError, nil, true},
+		{true, "nas", dns.TypeA, dns.RcodeSuccess, []string{"nas.lan.", "192.168.1.2"}, false},
+		{true, "printer", dns.TypeA, dns.RcodeSuccess, []string{"192.0.2.1"}, true},
+	}
+
+	handlers := make(map[bool]*DNSHandler)
+	for _, test := range tests {
+		h, ok := handlers[test.forward]
+		if !ok {
+			config := testConfig(t, up)
+			config.Resolver.Hosts.Enable = true
+			config.Resolver.Hosts.HostsFiles = []string{hosts}
+			config.Resolver.Hosts.Watch = false
+			config.Resolver.Hosts.RefreshInterval = 0
+			config.Resolver.Unqualified.Domain = "lan."
+			config.Resolver.Unqualified.Forward = test.forward
+			h = newTestHandler(t, config)
+			handlers[test.forward] = h
+		}
+
+		before := up.received()
+		m := exchange(t, h, "192.168.1.10", test.name, test.qtype)
+		if m.Rcode != test.rcode || !reflect.DeepEqual(answers(m), test.answers) {
+			t.Errorf("%s %s (forward %v) = %s %v, want %s %v", test.name, dns.TypeToString[test.qtype], test.forward,
+				dns.RcodeToString[m.Rcode], answers(m), dns.RcodeToString[test.rcode], test.answers)
+		}
+		if forwarded := up.received() > before; forwarded != test.forwarded {
+			t.Errorf("%s %s (forward %v) forwarded %v, want %v", test.name, dns.TypeToString[test.qtype], test.forward, forwarded, test.forwarded)
+		}
+	}
+}
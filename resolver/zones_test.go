@@ -0,0 +1,50 @@
+package resolver
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	conf "github.com/ray-g/dnsproxy/config"
+)
+
+func TestZoneAnswers(t *testing.T) {
+	up := startUpstream(t, "host.sub.home.lan. 60 IN A 192.0.2.40")
+	config := testConfig(t, up)
+
+	file := filepath.Join(t.TempDir(), "home.lan.zone")
+	zone := "@ 3600 IN SOA ns.home.lan. admin.home.lan. 1 3600 600 86400 300\n" +
+		"router 3600 IN A 192.168.1.1\n" +
+		"sub 3600 IN NS ns.sub\n"
+	if err := ioutil.WriteFile(file, []byte(zone), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config.Resolver.Zones = []conf.ZoneConfig{{Origin: "home.lan", File: file}}
+	h := newTestHandler(t, config)
+
+	tests := []struct {
+		name     string
+		rcode    int
+		answers  []string
+		soa      bool
+		received int
+	}{
+		{"router.home.lan", dns.RcodeSuccess, []string{"192.168.1.1"}, false, 0},
+		{"missing.home.lan", dns.RcodeNameError, nil, true, 0},
+		{"host.sub.home.lan", dns.RcodeSuccess, []string{"192.0.2.40"}, false, 1},
+	}
+
+	for _, test := range tests {
+		m := exchange(t, h, "192.168.1.10", test.name, dns.TypeA)
+		if m.Rcode != test.rcode || !reflect.DeepEqual(answers(m), test.answers) || hasSOA(m) != test.soa {
+			t.Errorf("%s = %s %v, SOA %v, want %s %v, SOA %v", test.name, dns.RcodeToString[m.Rcode], answers(m), hasSOA(m),
+				dns.RcodeToString[test.rcode], test.answers, test.soa)
+		}
+		if n := up.received(); n != test.received {
+			t.Errorf("%s: upstream received %d queries, want %d", test.name, n, test.received)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package stats
+
+import (
+	"sync"
+	"time"
+)
+
+// categoryStats counts blocked queries per blocklist category, since start
+// and for the current day
+type categoryStats struct {
+	sync.Mutex
+	day   string
+	total map[string]int32
+	today map[string]int32
+}
+
+func (c *categoryStats) reset() {
+	c.Lock()
+	defer c.Unlock()
+
+	c.day = time.Now().Format("2006-01-02")
+	c.total = make(map[string]int32)
+	c.today = make(map[string]int32)
+}
+
+// rollover starts a new day of counts, c must be locked
+func (c *categoryStats) rollover() {
+	if day := time.Now().Format("2006-01-02"); day != c.day {
+		c.day = day
+		c.today = make(map[string]int32)
+	}
+}
+
+func (c *categoryStats) add(category string) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.rollover()
+	c.total[category]++
+	c.today[category]++
+}
+
+func (c *categoryStats) dump() (map[string]int32, map[string]int32) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.rollover()
+	total := make(map[string]int32, len(c.total))
+	for k, v := range c.total {
+		total[k] = v
+	}
+	today := make(map[string]int32, len(c.today))
+	for k, v := range c.today {
+		today[k] = v
+	}
+	return total, today
+}
@@ -0,0 +1,31 @@
+package stats
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCategoryStats(t *testing.T) {
+	var c categoryStats
+	c.reset()
+
+	c.add("ads")
+	c.add("ads")
+	c.add("malware")
+
+	total, today := c.dump()
+	if want := map[string]int32{"ads": 2, "malware": 1}; !reflect.DeepEqual(total, want) || !reflect.DeepEqual(today, want) {
+		t.Errorf("counts %v, today %v, want %v", total, today, want)
+	}
+
+	// a new day keeps the totals
+	c.day = "2000-01-01"
+	c.add("ads")
+	total, today = c.dump()
+	if want := map[string]int32{"ads": 3, "malware": 1}; !reflect.DeepEqual(total, want) {
+		t.Errorf("counts %v after a new day, want %v", total, want)
+	}
+	if want := map[string]int32{"ads": 1}; !reflect.DeepEqual(today, want) {
+		t.Errorf("today %v after a new day, want %v", today, want)
+	}
+}
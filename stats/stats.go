@@ -7,18 +7,24 @@ import (
 )
 
 type Stats struct {
-	active        int32
-	domainCount   int32
-	domainNormal  int32
-	domainBlocked int32
-	domainCustom  int32
-	queryCount    int32
-	queryBlocked  int32
-	qpsAverage    int32
-	qps           []int32
-	timeStarted   int64
-	lastTime      int64
-	lastCount     int32
+	active         Switch
+	blocking       Switch
+	caching        Switch
+	hosts          Switch
+	domainCount    int32
+	domainNormal   int32
+	domainBlocked  int32
+	domainCustom   int32
+	queryCount     int32
+	queryBlocked   int32
+	queryBlockedIP int32
+	queryDenied    int32
+	qpsAverage     int32
+	qps            []int32
+	timeStarted    int64
+	lastTime       int64
+	lastCount      int32
+	categories     categoryStats
 }
 
 var (
@@ -31,6 +37,7 @@ var (
 
 func init() {
 	s.reset()
+	s.active.TurnOff()
 
 	once.Do(func() {
 		stop = make(chan bool)
@@ -68,7 +75,10 @@ func (s *Stats) reset() {
 	reset(&s.domainCustom)
 	reset(&s.queryCount)
 	reset(&s.queryBlocked)
+	reset(&s.queryBlockedIP)
+	reset(&s.queryDenied)
 	reset(&s.qpsAverage)
+	s.categories.reset()
 	atomic.StoreInt64(&s.timeStarted, time.Now().Unix())
 	s.qps = make([]int32, 0)
 }
@@ -103,6 +113,11 @@ func (s *Stats) removeBlockedDomain() {
 	decrease(&s.domainCount)
 }
 
+func (s *Stats) setBlockedDomains(n int32) {
+	old := atomic.SwapInt32(&s.domainBlocked, n)
+	atomic.AddInt32(&s.domainCount, n-old)
+}
+
 func (s *Stats) addQuery() {
 	increase(&s.queryCount)
 }
@@ -111,16 +126,52 @@ func (s *Stats) addQueryBlocked() {
 	increase(&s.queryBlocked)
 }
 
+func (s *Stats) addQueryBlockedIP() {
+	increase(&s.queryBlockedIP)
+}
+
+func (s *Stats) addQueryDenied() {
+	increase(&s.queryDenied)
+}
+
+func (s *Stats) addQueryBlockedCategory(category string) {
+	s.categories.add(category)
+}
+
 func (s *Stats) activate() {
-	atomic.CompareAndSwapInt32(&s.active, 0, 1)
+	s.active.TurnOn()
 }
 
 func (s *Stats) deactivate() {
-	atomic.CompareAndSwapInt32(&s.active, 1, 0)
+	s.active.TurnOff()
 }
 
 func (s *Stats) Active() bool {
-	return atomic.LoadInt32(&s.active) == 1
+	return s.active.On()
+}
+
+// Switch returns the named switch: active, blocking, caching or hosts
+func (s *Stats) Switch(name string) (*Switch, bool) {
+	switch name {
+	case "active":
+		return &s.active, true
+	case "blocking":
+		return &s.blocking, true
+	case "caching":
+		return &s.caching, true
+	case "hosts":
+		return &s.hosts, true
+	}
+	return nil, false
+}
+
+func (s *Stats) DumpSwitches() map[string]interface{} {
+	return map[string]interface{}{
+		"active":   s.active.Dump(),
+		"blocking": s.blocking.Dump(),
+		"caching":  s.caching.Dump(),
+		"hosts":    s.hosts.Dump(),
+	}
 }
 
 const maxQPSCount = 3600
@@ -173,6 +224,14 @@ func (s *Stats) QueryBlocked() int32 {
 	return atomic.LoadInt32(&s.queryBlocked)
 }
 
+func (s *Stats) QueryBlockedIP() int32 {
+	return atomic.LoadInt32(&s.queryBlockedIP)
+}
+
+func (s *Stats) QueryDenied() int32 {
+	return atomic.LoadInt32(&s.queryDenied)
+}
+
 func (s *Stats) QpsAverage() int32 {
 	return atomic.LoadInt32(&s.qpsAverage)
 }
@@ -199,17 +258,22 @@ func (s *Stats) LastCount() int32 {
 }
 
 func (s *Stats) Dump() map[string]interface{} {
+	categories, categoriesToday := s.categories.dump()
 	return map[string]interface{}{
-		"domain_count":   s.DomainCount(),
-		"domain_normal":  s.DomainNormal(),
-		"domain_blocked": s.DomainBlocked(),
-		"domain_custom":  s.DomainCustom(),
-		"query_count":    s.QueryCount(),
-		"query_blocked":  s.QueryBlocked(),
-		"qps_average":    s.QpsAverage(),
-		"time_started":   s.TimeStarted(),
-		"time_last":      s.LastTime(),
-		"qps":            s.Qps(),
+		"domain_count":                   s.DomainCount(),
+		"domain_normal":                  s.DomainNormal(),
+		"domain_blocked":                 s.DomainBlocked(),
+		"domain_custom":                  s.DomainCustom(),
+		"query_count":                    s.QueryCount(),
+		"query_blocked":                  s.QueryBlocked(),
+		"query_blocked_ip":               s.QueryBlockedIP(),
+		"query_denied":                   s.QueryDenied(),
+		"query_blocked_categories":       categories,
+		"query_blocked_categories_today": categoriesToday,
+		"qps_average":                    s.QpsAverage(),
+		"time_started":                   s.TimeStarted(),
+		"time_last":                      s.LastTime(),
+		"qps":                            s.Qps(),
 	}
 }
 
@@ -241,6 +305,11 @@ func RemoveBlockedDomain() {
 	s.removeBlockedDomain()
 }
 
+// SetBlockedDomains replaces the number of blocked domains
+func SetBlockedDomains(n int) {
+	s.setBlockedDomains(int32(n))
+}
+
 func AddQuery() {
 	s.addQuery()
 }
@@ -249,10 +318,46 @@ func AddQueryBlocked() {
 	s.addQueryBlocked()
 }
 
+func AddQueryBlockedIP() {
+	s.addQueryBlockedIP()
+}
+
+// AddQueryDenied counts a query denied by the default policy
+func AddQueryDenied() {
+	s.addQueryDenied()
+}
+
+func AddQueryBlockedCategory(category string) {
+	s.addQueryBlockedCategory(category)
+}
+
 func Active() bool {
 	return s.Active()
 }
 
+// BlockingActive reports whether blocked names are filtered
+func BlockingActive() bool {
+	return s.Active() && s.blocking.On()
+}
+
+// CachingActive reports whether answers are served from cache
+func CachingActive() bool {
+	return s.Active() && s.caching.On()
+}
+
+// HostsActive reports whether names are resolved from hosts
+func HostsActive() bool {
+	return s.Active() && s.hosts.On()
+}
+
+func GetSwitch(name string) (*Switch, bool) {
+	return s.Switch(name)
+}
+
+func DumpSwitches() map[string]interface{} {
+	return s.DumpSwitches()
+}
+
 func Activate() {
 	s.activate()
 }
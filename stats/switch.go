@@ -0,0 +1,57 @@
+package stats
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const switchOff = -1
+
+// Switch is an on/off toggle which can be turned off for a while
+type Switch struct {
+	// 0 is on, -1 is off, otherwise off until this unix nano time
+	resumeAt int64
+}
+
+// On reports whether s is on, a paused switch is on again once its pause ended
+func (s *Switch) On() bool {
+	resumeAt := atomic.LoadInt64(&s.resumeAt)
+	return resumeAt == 0 || (resumeAt > 0 && time.Now().UnixNano() >= resumeAt)
+}
+
+// TurnOn turns s on, ending a pause
+func (s *Switch) TurnOn() {
+	atomic.StoreInt64(&s.resumeAt, 0)
+}
+
+// TurnOff turns s off until it is turned on again
+func (s *Switch) TurnOff() {
+	atomic.StoreInt64(&s.resumeAt, switchOff)
+}
+
+// Pause turns s off for d, then it turns on again by itself
+func (s *Switch) Pause(d time.Duration) {
+	atomic.StoreInt64(&s.resumeAt, time.Now().Add(d).UnixNano())
+}
+
+// ResumeIn returns the remaining pause time, 0 when s is on or off for good
+func (s *Switch) ResumeIn() time.Duration {
+	resumeAt := atomic.LoadInt64(&s.resumeAt)
+	if resumeAt <= 0 {
+		return 0
+	}
+
+	remaining := time.Until(time.Unix(0, resumeAt))
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// Dump returns the state of s
+func (s *Switch) Dump() map[string]interface{} {
+	return map[string]interface{}{
+		"on":        s.On(),
+		"resume_in": int64(s.ResumeIn() / time.Second),
+	}
+}
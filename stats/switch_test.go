@@ -0,0 +1,68 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSwitch(t *testing.T) {
+	var sw Switch
+	if !sw.On() || sw.ResumeIn() != 0 {
+		t.Errorf("new switch on %v, resuming in %s", sw.On(), sw.ResumeIn())
+	}
+
+	sw.TurnOff()
+	if sw.On() || sw.ResumeIn() != 0 {
+		t.Errorf("switch turned off on %v, resuming in %s", sw.On(), sw.ResumeIn())
+	}
+
+	sw.Pause(time.Hour)
+	if sw.On() || sw.ResumeIn() <= 59*time.Minute || sw.ResumeIn() > time.Hour {
+		t.Errorf("paused switch on %v, resuming in %s", sw.On(), sw.ResumeIn())
+	}
+
+	sw.TurnOn()
+	if !sw.On() || sw.ResumeIn() != 0 {
+		t.Errorf("switch turned on %v, resuming in %s", sw.On(), sw.ResumeIn())
+	}
+
+	sw.Pause(10 * time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if !sw.On() || sw.ResumeIn() != 0 {
+		t.Errorf("switch after its pause on %v, resuming in %s", sw.On(), sw.ResumeIn())
+	}
+}
+
+func TestSwitches(t *testing.T) {
+	Activate()
+	t.Cleanup(func() {
+		for _, name := range []string{"blocking", "caching", "hosts"} {
+			sw, _ := GetSwitch(name)
+			sw.TurnOn()
+		}
+	})
+
+	blocking, _ := GetSwitch("blocking")
+	blocking.Pause(time.Minute)
+	if BlockingActive() || !CachingActive() || !HostsActive() {
+		t.Errorf("paused blocking: blocking %v, caching %v, hosts %v", BlockingActive(), CachingActive(), HostsActive())
+	}
+
+	caching, _ := GetSwitch("caching")
+	caching.TurnOff()
+	blocking.TurnOn()
+	if !BlockingActive() || CachingActive() || !HostsActive() {
+		t.Errorf("caching off: blocking %v, caching %v, hosts %v", BlockingActive(), CachingActive(), HostsActive())
+	}
+
+	Deactivate()
+	caching.TurnOn()
+	if BlockingActive() || CachingActive() || HostsActive() {
+		t.Error("switches active while the application is not")
+	}
+	Activate()
+
+	if _, ok := GetSwitch("dhcp"); ok {
+		t.Error("unknown switch found")
+	}
+}
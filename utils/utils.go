@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/signal"
 	"regexp"
+	"strings"
 	"syscall"
 
 	"github.com/miekg/dns"
@@ -41,11 +42,20 @@ func UnFqdn(s string) string {
 	return s
 }
 
+// HasDomainSuffix reports whether domain is suffix or one of its subdomains,
+// a leading "*." in suffix is ignored
+func HasDomainSuffix(domain string, suffix string) bool {
+	domain = strings.ToLower(UnFqdn(domain))
+	suffix = strings.ToLower(UnFqdn(strings.TrimPrefix(suffix, "*.")))
+
+	return domain == suffix || strings.HasSuffix(domain, "."+suffix)
+}
+
 func IsDomain(domain string) bool {
 	if IsIP(domain) {
 		return false
 	}
-	match, _ := regexp.MatchString(`^([a-zA-Z0-9\*]([a-zA-Z0-9\-]{0,61}[a-zA-Z0-9])?\.)+[a-zA-Z]{2,6}$`, domain)
+	match, _ := regexp.MatchString(`^([a-zA-Z0-9\*]([a-zA-Z0-9\-]{0,61}[a-zA-Z0-9])?\.)+([a-zA-Z]{2,63}|xn--[a-zA-Z0-9\-]{1,59})$`, domain)
 	return match
 }
 
@@ -0,0 +1,153 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/ray-g/dnsproxy/logger"
+)
+
+// Watcher calls reload when files change, once the change notifications
+// settled for a delay. Without notifications the files are reloaded at an
+// interval.
+type Watcher struct {
+	paths    []string
+	delay    time.Duration
+	interval time.Duration
+	reload   func()
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New starts watching paths, files or directories of files. Polling is used
+// when notify is off or watching fails, an interval of 0 disables it.
+func New(paths []string, notify bool, delay time.Duration, interval time.Duration, reload func()) *Watcher {
+	w := &Watcher{
+		paths:    make([]string, len(paths)),
+		delay:    delay,
+		interval: interval,
+		reload:   reload,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for i, path := range paths {
+		w.paths[i] = filepath.Clean(path)
+	}
+
+	var fw *fsnotify.Watcher
+	if notify {
+		var err error
+		if fw, err = w.notifier(); err != nil {
+			logger.Warningf("watching %s failed, polling every %s: %s", strings.Join(w.paths, ", "), interval, err)
+		}
+	}
+
+	go w.run(fw)
+
+	return w
+}
+
+// Stop ends watching, reload is not called anymore once it returns
+func (w *Watcher) Stop() {
+	select {
+	case <-w.stop:
+	default:
+		close(w.stop)
+	}
+	<-w.done
+}
+
+// Ignored skips hidden, backup and partially written files of directories
+func Ignored(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~") ||
+		strings.HasSuffix(name, ".swp") || strings.HasSuffix(name, ".tmp")
+}
+
+// notifier watches the directories of the files, files are replaced by
+// renames so their directory is watched rather than the file
+func (w *Watcher) notifier() (*fsnotify.Watcher, error) {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	dirs := make(map[string]bool)
+	for _, path := range w.paths {
+		dir := path
+		if info, err := os.Stat(path); err != nil || !info.IsDir() {
+			dir = filepath.Dir(path)
+		}
+
+		if dirs[dir] {
+			continue
+		}
+		dirs[dir] = true
+
+		if err := fw.Add(dir); err != nil {
+			fw.Close()
+			return nil, err
+		}
+	}
+
+	return fw, nil
+}
+
+// watches reports whether name is one of the files or in one of the
+// directories
+func (w *Watcher) watches(name string) bool {
+	name = filepath.Clean(name)
+	for _, path := range w.paths {
+		if name == path || (filepath.Dir(name) == path && !Ignored(filepath.Base(name))) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Watcher) run(fw *fsnotify.Watcher) {
+	defer close(w.done)
+
+	if fw == nil {
+		if w.interval == 0 {
+			<-w.stop
+			return
+		}
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+				w.reload()
+			}
+		}
+	}
+
+	defer fw.Close()
+
+	var pending <-chan time.Time
+	for {
+		select {
+		case <-w.stop:
+			return
+		case event := <-fw.Events:
+			if w.watches(event.Name) {
+				logger.Debugf("%s changed: %s", event.Name, event.Op)
+				pending = time.After(w.delay)
+			}
+		case err := <-fw.Errors:
+			logger.Warningf("watching %s: %s", strings.Join(w.paths, ", "), err)
+		case <-pending:
+			pending = nil
+			w.reload()
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package watcher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ray-g/dnsproxy/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.SetOutput(ioutil.Discard)
+	logger.InitLogger("watcher", false)
+	os.Exit(m.Run())
+}
+
+func TestIgnored(t *testing.T) {
+	tests := []struct {
+		name    string
+		ignored bool
+	}{
+		{"hosts", false},
+		{"hosts.lan", false},
+		{".hosts", true},
+		{"hosts~", true},
+		{".hosts.swp", true},
+		{"hosts.swp", true},
+		{"hosts.tmp", true},
+	}
+
+	for _, test := range tests {
+		if ignored := Ignored(test.name); ignored != test.ignored {
+			t.Errorf("Ignored(%s) = %v, want %v", test.name, ignored, test.ignored)
+		}
+	}
+}
+
+func TestWatches(t *testing.T) {
+	w := &Watcher{paths: []string{"/etc/hosts", "/etc/hosts.d"}}
+
+	tests := []struct {
+		name    string
+		watches bool
+	}{
+		{"/etc/hosts", true},
+		{"/etc//hosts", true},
+		{"/etc/resolv.conf", false},
+		{"/etc/hosts.d/lan", true},
+		{"/etc/hosts.d/lan.swp", false},
+		{"/etc/hosts.d/.lan", false},
+		{"/etc/hosts.d/sub/lan", false},
+	}
+
+	for _, test := range tests {
+		if watches := w.watches(test.name); watches != test.watches {
+			t.Errorf("watches(%s) = %v, want %v", test.name, watches, test.watches)
+		}
+	}
+}
+
+// waitFor polls until count reached at least n, it reports the last value
+func waitFor(count *int32, n int32, timeout time.Duration) int32 {
+	deadline := time.Now().Add(timeout)
+	for atomic.LoadInt32(count) < n && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return atomic.LoadInt32(count)
+}
+
+func TestNotify(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "hosts")
+	if err := ioutil.WriteFile(file, []byte("192.0.2.1 router.lan\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var reloads int32
+	w := New([]string{file}, true, 100*time.Millisecond, 0, func() { atomic.AddInt32(&reloads, 1) })
+	defer w.Stop()
+
+	// other files of the directory are not watched
+	if err := ioutil.WriteFile(filepath.Join(dir, "other"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if n := atomic.LoadInt32(&reloads); n != 0 {
+		t.Fatalf("%d reloads for another file", n)
+	}
+
+	// a burst of writes settles into a single reload
+	for i := 0; i < 5; i++ {
+		if err := ioutil.WriteFile(file, []byte("192.0.2.2 router.lan\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := waitFor(&reloads, 1, 2*time.Second); n != 1 {
+		t.Fatalf("%d reloads after writing the file, want 1", n)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if n := atomic.LoadInt32(&reloads); n != 1 {
+		t.Errorf("%d reloads once the writes settled, want 1", n)
+	}
+}
+
+func TestPoll(t *testing.T) {
+	var reloads int32
+	w := New([]string{filepath.Join(t.TempDir(), "hosts")}, false, 0, 50*time.Millisecond, func() { atomic.AddInt32(&reloads, 1) })
+
+	if n := waitFor(&reloads, 2, 2*time.Second); n < 2 {
+		t.Errorf("%d reloads while polling, want at least 2", n)
+	}
+
+	w.Stop()
+	w.Stop()
+	n := atomic.LoadInt32(&reloads)
+	time.Sleep(150 * time.Millisecond)
+	if after := atomic.LoadInt32(&reloads); after != n {
+		t.Errorf("%d reloads after Stop", after-n)
+	}
+}
+
+func TestStopWithoutPolling(t *testing.T) {
+	w := New(nil, false, 0, 0, func() { t.Error("reload without notifications or polling") })
+
+	stopped := make(chan struct{})
+	go func() {
+		w.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Error("Stop did not return")
+	}
+}
@@ -0,0 +1,296 @@
+package zones
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	conf "github.com/ray-g/dnsproxy/config"
+	"github.com/ray-g/dnsproxy/logger"
+)
+
+// maxChain is the longest CNAME chain followed inside a zone
+const maxChain = 8
+
+// Zone is a zone loaded from an RFC 1035 zone file
+type Zone struct {
+	Origin  string
+	soa     *dns.SOA
+	records map[string]map[uint16][]dns.RR
+	// names holds every owner name and the empty non-terminals above them
+	names map[string]bool
+	// reverse maps the reverse names of the addresses to their owners
+	reverse map[string][]string
+}
+
+// Load reads the zone file, origin defaults to the owner of its SOA record
+func Load(origin string, file string) (*Zone, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if origin != "" {
+		origin = dns.CanonicalName(origin)
+	}
+
+	var rrs []dns.RR
+	zp := dns.NewZoneParser(f, origin, file)
+	zp.SetIncludeAllowed(true)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		rr.Header().Name = dns.CanonicalName(rr.Header().Name)
+		rrs = append(rrs, rr)
+
+		if soa, ok := rr.(*dns.SOA); ok && origin == "" {
+			origin = soa.Hdr.Name
+		}
+	}
+	if err := zp.Err(); err != nil {
+		return nil, err
+	}
+
+	z := &Zone{
+		Origin:  origin,
+		records: make(map[string]map[uint16][]dns.RR),
+		names:   map[string]bool{origin: true},
+		reverse: make(map[string][]string),
+	}
+
+	for _, rr := range rrs {
+		name := rr.Header().Name
+		if !dns.IsSubDomain(origin, name) {
+			logger.Warningf("%s: ignoring out-of-zone record %s", file, rr)
+			continue
+		}
+
+		if soa, ok := rr.(*dns.SOA); ok && name == origin {
+			z.soa = soa
+		}
+
+		rrsets, ok := z.records[name]
+		if !ok {
+			rrsets = make(map[uint16][]dns.RR)
+			z.records[name] = rrsets
+		}
+		rrsets[rr.Header().Rrtype] = append(rrsets[rr.Header().Rrtype], rr)
+
+		for off, end := 0, false; !end && !z.names[name[off:]]; off, end = dns.NextLabel(name, off) {
+			z.names[name[off:]] = true
+		}
+
+		var ip string
+		switch v := rr.(type) {
+		case *dns.A:
+			ip = v.A.String()
+		case *dns.AAAA:
+			ip = v.AAAA.String()
+		}
+		if arpa, err := dns.ReverseAddr(ip); err == nil && !strings.HasPrefix(name, "*.") {
+			z.reverse[arpa] = append(z.reverse[arpa], name)
+		}
+	}
+
+	if z.soa == nil {
+		return nil, fmt.Errorf("%s: zone %s has no SOA record", file, origin)
+	}
+
+	return z, nil
+}
+
+// delegated reports whether name is at or below a zone cut
+func (z *Zone) delegated(name string) bool {
+	for off, end := 0, false; !end; off, end = dns.NextLabel(name, off) {
+		if name[off:] == z.Origin {
+			return false
+		}
+		if len(z.records[name[off:]][dns.TypeNS]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encloser returns the closest existing ancestor of name
+func (z *Zone) encloser(name string) string {
+	for off, end := 0, false; !end; off, end = dns.NextLabel(name, off) {
+		if z.names[name[off:]] {
+			return name[off:]
+		}
+	}
+	return z.Origin
+}
+
+// negative is the SOA of negative answers, its TTL is the negative cache TTL
+func (z *Zone) negative() []dns.RR {
+	soa := dns.Copy(z.soa).(*dns.SOA)
+	if soa.Minttl < soa.Hdr.Ttl {
+		soa.Hdr.Ttl = soa.Minttl
+	}
+	return []dns.RR{soa}
+}
+
+// resolve adds the records of name to m, following CNAMEs inside the zone
+func (z *Zone) resolve(m *dns.Msg, name string, qtype uint16, depth int) {
+	rrsets, ok := z.records[name]
+	if !ok && !z.names[name] {
+		// a wildcard only covers names that don't exist
+		rrsets, ok = z.records["*."+z.encloser(name)]
+		if !ok {
+			m.Rcode = dns.RcodeNameError
+			m.Ns = z.negative()
+			return
+		}
+	}
+
+	var answer []dns.RR
+	switch {
+	case len(rrsets[qtype]) > 0:
+		answer = rrsets[qtype]
+	case qtype == dns.TypeANY:
+		for _, rrs := range rrsets {
+			answer = append(answer, rrs...)
+		}
+	case len(rrsets[dns.TypeCNAME]) > 0:
+		answer = rrsets[dns.TypeCNAME]
+	}
+
+	if len(answer) == 0 {
+		m.Ns = z.negative()
+		return
+	}
+
+	for _, rr := range answer {
+		rr = dns.Copy(rr)
+		rr.Header().Name = name
+		m.Answer = append(m.Answer, rr)
+	}
+
+	if cname, ok := answer[0].(*dns.CNAME); ok && qtype != dns.TypeCNAME {
+		target := dns.CanonicalName(cname.Target)
+		if depth < maxChain && dns.IsSubDomain(z.Origin, target) && !z.delegated(target) {
+			z.resolve(m, target, qtype, depth+1)
+		}
+	}
+}
+
+// additional adds the in-zone addresses of the targets of the answer
+func (z *Zone) additional(m *dns.Msg) {
+	for _, rr := range m.Answer {
+		var target string
+		switch v := rr.(type) {
+		case *dns.MX:
+			target = v.Mx
+		case *dns.SRV:
+			target = v.Target
+		case *dns.NS:
+			target = v.Ns
+		default:
+			continue
+		}
+
+		rrsets := z.records[dns.CanonicalName(target)]
+		m.Extra = append(m.Extra, rrsets[dns.TypeA]...)
+		m.Extra = append(m.Extra, rrsets[dns.TypeAAAA]...)
+	}
+}
+
+// Answer returns the authoritative reply to req, names below a zone cut are
+// left to the upstream
+func (z *Zone) Answer(req *dns.Msg) (*dns.Msg, bool) {
+	q := req.Question[0]
+	name := dns.CanonicalName(q.Name)
+	if z.delegated(name) {
+		return nil, false
+	}
+
+	m := new(dns.Msg)
+	m.SetReply(req)
+	m.Authoritative = true
+	m.RecursionAvailable = true
+
+	z.resolve(m, name, q.Qtype, 0)
+	z.additional(m)
+
+	return m, true
+}
+
+// Zones are the local zones, a name belongs to the zone with the longest
+// origin
+type Zones struct {
+	zones map[string]*Zone
+}
+
+// New loads the zone files of configs
+func New(configs []conf.ZoneConfig) (*Zones, error) {
+	zs := &Zones{zones: make(map[string]*Zone)}
+
+	for _, config := range configs {
+		z, err := Load(config.Origin, config.File)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := zs.zones[z.Origin]; ok {
+			return nil, fmt.Errorf("zone %s is loaded twice", z.Origin)
+		}
+		zs.zones[z.Origin] = z
+
+		logger.Infof("zone %s loaded with %d names from %s", z.Origin, len(z.records), config.File)
+	}
+
+	return zs, nil
+}
+
+// Find returns the zone of name, nil when it is not local
+func (zs *Zones) Find(name string) *Zone {
+	if zs == nil || len(zs.zones) == 0 {
+		return nil
+	}
+
+	name = dns.CanonicalName(name)
+	for off, end := 0, false; !end; off, end = dns.NextLabel(name, off) {
+		if z, ok := zs.zones[name[off:]]; ok {
+			return z
+		}
+	}
+	return nil
+}
+
+// Reverse returns the owners of the address of the reverse name arpa
+func (zs *Zones) Reverse(arpa string) ([]string, bool) {
+	if zs == nil {
+		return nil, false
+	}
+
+	arpa = dns.CanonicalName(arpa)
+	origins := make([]string, 0, len(zs.zones))
+	for origin := range zs.zones {
+		origins = append(origins, origin)
+	}
+	sort.Strings(origins)
+
+	var names []string
+	for _, origin := range origins {
+		names = append(names, zs.zones[origin].reverse[arpa]...)
+	}
+	return names, len(names) > 0
+}
+
+// Answer returns the authoritative reply to a query for a local zone
+func (zs *Zones) Answer(req *dns.Msg) (*dns.Msg, bool) {
+	q := req.Question[0]
+	if q.Qclass != dns.ClassINET {
+		return nil, false
+	}
+
+	z := zs.Find(q.Name)
+	if z == nil {
+		return nil, false
+	}
+
+	return z.Answer(req)
+}
@@ -0,0 +1,222 @@
+package zones
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	conf "github.com/ray-g/dnsproxy/config"
+	"github.com/ray-g/dnsproxy/logger"
+)
+
+const homeZone = `$ORIGIN home.lan.
+$TTL 3600
+@             IN SOA   ns.home.lan. admin.home.lan. 1 3600 600 86400 300
+@             IN NS    ns
+ns            IN A     192.168.1.1
+router        IN A     192.168.1.1
+router        IN AAAA  fd00::1
+www           IN CNAME router
+ext           IN CNAME www.example.com.
+mail          IN MX    10 router
+*.apps        IN A     192.168.1.20
+explicit.apps IN TXT   "here"
+a.b.c         IN A     192.168.1.30
+sub           IN NS    ns.sub
+ns.sub        IN A     192.168.1.40
+loop1         IN CNAME loop2
+loop2         IN CNAME loop1
+other.lan.    IN A     192.168.1.50
+`
+
+func TestMain(m *testing.M) {
+	logger.SetOutput(ioutil.Discard)
+	logger.InitLogger("zones", false)
+	os.Exit(m.Run())
+}
+
+func writeZone(t *testing.T, content string) string {
+	file := filepath.Join(t.TempDir(), "zone")
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// data returns the data of the records of rrs
+func data(rrs []dns.RR) []string {
+	var list []string
+	for _, rr := range rrs {
+		list = append(list, strings.TrimPrefix(rr.String(), rr.Header().String()))
+	}
+	return list
+}
+
+func TestZoneAnswer(t *testing.T) {
+	z, err := Load("", writeZone(t, homeZone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if z.Origin != "home.lan." {
+		t.Errorf("Origin = %s, want the owner of the SOA", z.Origin)
+	}
+
+	tests := []struct {
+		name    string
+		qtype   uint16
+		ok      bool
+		rcode   int
+		answers []string
+		soa     bool
+	}{
+		{"router.home.lan.", dns.TypeA, true, dns.RcodeSuccess, []string{"192.168.1.1"}, false},
+		{"ROUTER.Home.Lan.", dns.TypeAAAA, true, dns.RcodeSuccess, []string{"fd00::1"}, false},
+		{"router.home.lan.", dns.TypeTXT, true, dns.RcodeSuccess, nil, true},
+		{"www.home.lan.", dns.TypeA, true, dns.RcodeSuccess, []string{"router.home.lan.", "192.168.1.1"}, false},
+		{"www.home.lan.", dns.TypeCNAME, true, dns.RcodeSuccess, []string{"router.home.lan."}, false},
+		{"ext.home.lan.", dns.TypeA, true, dns.RcodeSuccess, []string{"www.example.com."}, false},
+		{"mail.home.lan.", dns.TypeMX, true, dns.RcodeSuccess, []string{"10 router.home.lan."}, false},
+		{"x.apps.home.lan.", dns.TypeA, true, dns.RcodeSuccess, []string{"192.168.1.20"}, false},
+		{"y.x.apps.home.lan.", dns.TypeA, true, dns.RcodeSuccess, []string{"192.168.1.20"}, false},
+		{"x.apps.home.lan.", dns.TypeAAAA, true, dns.RcodeSuccess, nil, true},
+		{"explicit.apps.home.lan.", dns.TypeA, true, dns.RcodeSuccess, nil, true},
+		{"apps.home.lan.", dns.TypeA, true, dns.RcodeSuccess, nil, true},
+		{"b.c.home.lan.", dns.TypeA, true, dns.RcodeSuccess, nil, true},
+		{"x.b.c.home.lan.", dns.TypeA, true, dns.RcodeNameError, nil, true},
+		{"missing.home.lan.", dns.TypeA, true, dns.RcodeNameError, nil, true},
+		{"other.lan.", dns.TypeA, true, dns.RcodeNameError, nil, true},
+		{"sub.home.lan.", dns.TypeNS, false, 0, nil, false},
+		{"ns.sub.home.lan.", dns.TypeA, false, 0, nil, false},
+		{"host.sub.home.lan.", dns.TypeA, false, 0, nil, false},
+	}
+
+	for _, test := range tests {
+		req := new(dns.Msg)
+		req.SetQuestion(test.name, test.qtype)
+
+		m, ok := z.Answer(req)
+		if ok != test.ok {
+			t.Errorf("%s %s answered %v, want %v", test.name, dns.TypeToString[test.qtype], ok, test.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		var answers []string
+		for _, rr := range m.Answer {
+			switch v := rr.(type) {
+			case *dns.CNAME:
+				answers = append(answers, v.Target)
+			default:
+				answers = append(answers, data([]dns.RR{rr})...)
+			}
+		}
+		soa := len(m.Ns) == 1 && m.Ns[0].Header().Rrtype == dns.TypeSOA
+		if m.Rcode != test.rcode || !reflect.DeepEqual(answers, test.answers) || soa != test.soa || !m.Authoritative {
+			t.Errorf("%s %s = %s %v, SOA %v, want %s %v, SOA %v", test.name, dns.TypeToString[test.qtype],
+				dns.RcodeToString[m.Rcode], answers, soa, dns.RcodeToString[test.rcode], test.answers, test.soa)
+		}
+		if soa && m.Ns[0].Header().Ttl != 300 {
+			t.Errorf("%s: negative TTL %d, want the SOA minimum 300", test.name, m.Ns[0].Header().Ttl)
+		}
+	}
+}
+
+func TestZoneAdditional(t *testing.T) {
+	z, err := Load("", writeZone(t, homeZone))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion("mail.home.lan.", dns.TypeMX)
+	m, _ := z.Answer(req)
+	if got := data(m.Extra); !reflect.DeepEqual(got, []string{"192.168.1.1", "fd00::1"}) {
+		t.Errorf("additional of MX = %v", got)
+	}
+}
+
+func TestZoneCNAMELoop(t *testing.T) {
+	z, err := Load("", writeZone(t, homeZone))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion("loop1.home.lan.", dns.TypeA)
+	m, _ := z.Answer(req)
+	if len(m.Answer) != maxChain+1 {
+		t.Errorf("CNAME loop answered with %d records, want %d", len(m.Answer), maxChain+1)
+	}
+}
+
+func TestZones(t *testing.T) {
+	home := writeZone(t, homeZone)
+	iot := writeZone(t, `$TTL 60
+@      IN SOA ns.home.lan. admin.home.lan. 1 3600 600 86400 60
+camera IN A   192.168.1.1
+`)
+
+	zs, err := New([]conf.ZoneConfig{{File: home}, {Origin: "IoT.Home.Lan", File: iot}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, origin := range map[string]string{
+		"router.home.lan.":     "home.lan.",
+		"home.lan.":            "home.lan.",
+		"camera.iot.home.lan.": "iot.home.lan.",
+		"Camera.IOT.home.lan":  "iot.home.lan.",
+		"home.lan.example.":    "",
+		"lan.":                 "",
+	} {
+		var got string
+		if z := zs.Find(name); z != nil {
+			got = z.Origin
+		}
+		if got != origin {
+			t.Errorf("Find(%s) = %q, want %q", name, got, origin)
+		}
+	}
+
+	if names, ok := zs.Reverse("1.1.168.192.in-addr.arpa."); !ok ||
+		!reflect.DeepEqual(names, []string{"ns.home.lan.", "router.home.lan.", "camera.iot.home.lan."}) {
+		t.Errorf("Reverse(192.168.1.1) = %v, %v", names, ok)
+	}
+	if names, ok := zs.Reverse("20.1.168.192.in-addr.arpa."); ok {
+		t.Errorf("wildcard address reversed to %v", names)
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion("router.home.lan.", dns.TypeA)
+	req.Question[0].Qclass = dns.ClassCHAOS
+	if _, ok := zs.Answer(req); ok {
+		t.Error("CHAOS query answered from a zone")
+	}
+}
+
+func TestZonesInvalid(t *testing.T) {
+	home := writeZone(t, homeZone)
+
+	tests := []struct {
+		name    string
+		configs []conf.ZoneConfig
+	}{
+		{"missing file", []conf.ZoneConfig{{File: filepath.Join(t.TempDir(), "missing")}}},
+		{"no SOA", []conf.ZoneConfig{{Origin: "home.lan", File: writeZone(t, "www 60 IN A 192.168.1.1\n")}}},
+		{"syntax", []conf.ZoneConfig{{Origin: "home.lan", File: writeZone(t, "www 60 IN A not-an-ip\n")}}},
+		{"loaded twice", []conf.ZoneConfig{{File: home}, {Origin: "home.lan.", File: home}}},
+	}
+
+	for _, test := range tests {
+		if _, err := New(test.configs); err == nil {
+			t.Errorf("%s: zones loaded", test.name)
+		}
+	}
+}